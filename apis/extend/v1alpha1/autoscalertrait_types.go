@@ -0,0 +1,111 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// A CustomMetricTarget scales a workload on a metric that is reported by its
+// pods through the custom metrics API.
+type CustomMetricTarget struct {
+	// Name of the metric.
+	Name string `json:"name"`
+
+	// Selector narrows down the metric series by their labels.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// TargetAverageValue of the metric across all the pods.
+	TargetAverageValue resource.Quantity `json:"targetAverageValue"`
+}
+
+// An AutoscalerTraitSpec defines the desired state of an AutoscalerTrait.
+type AutoscalerTraitSpec struct {
+	// MinReplicas of the workload. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas of the workload.
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilization is the average CPU utilization of the pods in
+	// percent of their requests.
+	// +optional
+	TargetCPUUtilization *int32 `json:"targetCPUUtilization,omitempty"`
+
+	// TargetMemoryUtilization is the average memory utilization of the pods
+	// in percent of their requests.
+	// +optional
+	TargetMemoryUtilization *int32 `json:"targetMemoryUtilization,omitempty"`
+
+	// CustomMetrics the workload is scaled on.
+	// +optional
+	CustomMetrics []CustomMetricTarget `json:"customMetrics,omitempty"`
+
+	// WorkloadReference to the workload this trait applies to.
+	WorkloadReference runtimev1alpha1.TypedReference `json:"workloadRef"`
+}
+
+// An AutoscaledResource is a resource of the workload that is scaled by a
+// HorizontalPodAutoscaler.
+type AutoscaledResource struct {
+	// ResourceReference to the scaled resource.
+	ResourceReference runtimev1alpha1.TypedReference `json:"resourceRef"`
+
+	// HorizontalPodAutoscaler is the name of the autoscaler of the resource.
+	HorizontalPodAutoscaler string `json:"horizontalPodAutoscaler"`
+
+	// CurrentReplicas of the resource as last seen by its autoscaler.
+	CurrentReplicas int32 `json:"currentReplicas"`
+
+	// DesiredReplicas of the resource as last calculated by its autoscaler.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+}
+
+// An AutoscalerTraitStatus represents the observed state of an
+// AutoscalerTrait.
+type AutoscalerTraitStatus struct {
+	runtimev1alpha1.ConditionedStatus `json:",inline"`
+
+	// Resources that are scaled by the trait.
+	Resources []AutoscaledResource `json:"resources,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// An AutoscalerTrait scales a workload with HorizontalPodAutoscalers.
+// +kubebuilder:resource:categories={crossplane,oam}
+// +kubebuilder:subresource:status
+type AutoscalerTrait struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AutoscalerTraitSpec   `json:"spec,omitempty"`
+	Status AutoscalerTraitStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AutoscalerTraitList contains a list of AutoscalerTrait.
+type AutoscalerTraitList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AutoscalerTrait `json:"items"`
+}
@@ -0,0 +1,87 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// This code is manually implemented, but should be generated in the future.
+
+package v1alpha1
+
+import (
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+
+	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam"
+)
+
+var _ oam.Trait = &ScheduledScalerTrait{}
+var _ oam.Trait = &AutoscalerTrait{}
+
+// GetCondition of this ScheduledScalerTrait.
+func (tr *ScheduledScalerTrait) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return tr.Status.GetCondition(ct)
+}
+
+// SetConditions of this ScheduledScalerTrait.
+func (tr *ScheduledScalerTrait) SetConditions(c ...runtimev1alpha1.Condition) {
+	tr.Status.SetConditions(c...)
+}
+
+// GetWorkloadReference of this ScheduledScalerTrait.
+func (tr *ScheduledScalerTrait) GetWorkloadReference() runtimev1alpha1.TypedReference {
+	return tr.Spec.WorkloadReference
+}
+
+// SetWorkloadReference of this ScheduledScalerTrait.
+func (tr *ScheduledScalerTrait) SetWorkloadReference(r runtimev1alpha1.TypedReference) {
+	tr.Spec.WorkloadReference = r
+}
+
+// GetCondition of this AutoscalerTrait.
+func (tr *AutoscalerTrait) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return tr.Status.GetCondition(ct)
+}
+
+// SetConditions of this AutoscalerTrait.
+func (tr *AutoscalerTrait) SetConditions(c ...runtimev1alpha1.Condition) {
+	tr.Status.SetConditions(c...)
+}
+
+// GetWorkloadReference of this AutoscalerTrait.
+func (tr *AutoscalerTrait) GetWorkloadReference() runtimev1alpha1.TypedReference {
+	return tr.Spec.WorkloadReference
+}
+
+// SetWorkloadReference of this AutoscalerTrait.
+func (tr *AutoscalerTrait) SetWorkloadReference(r runtimev1alpha1.TypedReference) {
+	tr.Spec.WorkloadReference = r
+}
+
+// GetCondition of this NotificationSink.
+func (s *NotificationSink) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return s.Status.GetCondition(ct)
+}
+
+// SetConditions of this NotificationSink.
+func (s *NotificationSink) SetConditions(c ...runtimev1alpha1.Condition) {
+	s.Status.SetConditions(c...)
+}
+
+// GetCondition of this ScaleReport.
+func (r *ScaleReport) GetCondition(ct runtimev1alpha1.ConditionType) runtimev1alpha1.Condition {
+	return r.Status.GetCondition(ct)
+}
+
+// SetConditions of this ScaleReport.
+func (r *ScaleReport) SetConditions(c ...runtimev1alpha1.Condition) {
+	r.Status.SetConditions(c...)
+}
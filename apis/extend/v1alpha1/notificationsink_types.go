@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// A NotificationSinkSpec defines the desired state of a NotificationSink.
+type NotificationSinkSpec struct {
+	// URL the notifications are POSTed to.
+	URL string `json:"url"`
+
+	// Headers added to every notification request.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// BodyTemplate is a Go template rendering the JSON body of a
+	// notification, e.g. `{"text": {{ json .Message }}}`. The notification
+	// is sent as is unless it is set.
+	// +optional
+	BodyTemplate string `json:"bodyTemplate,omitempty"`
+
+	// SigningSecretRef selects a key of a Secret in the namespace of the sink.
+	// The body of every notification is signed with it using HMAC-SHA256 and
+	// the signature sent in the X-OAM-Signature header.
+	// +optional
+	SigningSecretRef *corev1.SecretKeySelector `json:"signingSecretRef,omitempty"`
+
+	// ScopeSelector selects the HealthScopes in the namespace of the sink
+	// whose health transitions are delivered. Every scope is selected unless
+	// it is set.
+	// +optional
+	ScopeSelector *metav1.LabelSelector `json:"scopeSelector,omitempty"`
+
+	// MaxRetries of a notification that could not be delivered. Defaults to 3.
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+
+	// Backoff before the first retry, which doubles for every following
+	// retry. Defaults to 1s.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+
+	// Timeout of a single notification request. Defaults to 10s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// A NotificationDelivery is the outcome of delivering a notification.
+type NotificationDelivery struct {
+	// Scope whose health transition was delivered.
+	Scope string `json:"scope"`
+
+	// Transition that was delivered, e.g. "healthy -> unhealthy".
+	Transition string `json:"transition"`
+
+	// Time the delivery completed.
+	Time metav1.Time `json:"time"`
+
+	// Attempts made to deliver the notification.
+	Attempts int32 `json:"attempts"`
+
+	// Succeeded is true if the notification was delivered.
+	Succeeded bool `json:"succeeded"`
+
+	// StatusCode of the last response, if any.
+	// +optional
+	StatusCode int32 `json:"statusCode,omitempty"`
+
+	// Error of the last attempt, if it failed.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// A NotificationSinkStatus represents the observed state of a
+// NotificationSink.
+type NotificationSinkStatus struct {
+	runtimev1alpha1.ConditionedStatus `json:",inline"`
+
+	// LastDelivery to the sink.
+	// +optional
+	LastDelivery *NotificationDelivery `json:"lastDelivery,omitempty"`
+
+	// LastSuccessfulDeliveryTime is the last time a notification was
+	// delivered to the sink.
+	// +optional
+	LastSuccessfulDeliveryTime *metav1.Time `json:"lastSuccessfulDeliveryTime,omitempty"`
+
+	// FailedDeliveries is the number of notifications that could not be
+	// delivered since the last successful delivery.
+	// +optional
+	FailedDeliveries int32 `json:"failedDeliveries,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A NotificationSink receives the health transitions of HealthScopes through
+// an HTTP webhook.
+// +kubebuilder:resource:categories={crossplane,oam}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=".spec.url",name=URL,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.lastDelivery.succeeded",name=DELIVERED,type=boolean
+// +kubebuilder:printcolumn:JSONPath=".status.lastDelivery.time",name=LAST,type=string
+type NotificationSink struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NotificationSinkSpec   `json:"spec,omitempty"`
+	Status NotificationSinkStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NotificationSinkList contains a list of NotificationSink.
+type NotificationSinkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NotificationSink `json:"items"`
+}
@@ -0,0 +1,85 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+// Package type metadata.
+const (
+	Group   = "extend.oam.dev"
+	Version = "v1alpha1"
+)
+
+var (
+	// SchemeGroupVersion is group version used to register these objects
+	SchemeGroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: SchemeGroupVersion}
+)
+
+// ScheduledScalerTrait type metadata.
+var (
+	ScheduledScalerTraitKind             = reflect.TypeOf(ScheduledScalerTrait{}).Name()
+	ScheduledScalerTraitGroupKind        = schema.GroupKind{Group: Group, Kind: ScheduledScalerTraitKind}.String()
+	ScheduledScalerTraitKindAPIVersion   = ScheduledScalerTraitKind + "." + SchemeGroupVersion.String()
+	ScheduledScalerTraitGroupVersionKind = SchemeGroupVersion.WithKind(ScheduledScalerTraitKind)
+)
+
+// AutoscalerTrait type metadata.
+var (
+	AutoscalerTraitKind             = reflect.TypeOf(AutoscalerTrait{}).Name()
+	AutoscalerTraitGroupKind        = schema.GroupKind{Group: Group, Kind: AutoscalerTraitKind}.String()
+	AutoscalerTraitKindAPIVersion   = AutoscalerTraitKind + "." + SchemeGroupVersion.String()
+	AutoscalerTraitGroupVersionKind = SchemeGroupVersion.WithKind(AutoscalerTraitKind)
+)
+
+// NotificationSink type metadata.
+var (
+	NotificationSinkKind             = reflect.TypeOf(NotificationSink{}).Name()
+	NotificationSinkGroupKind        = schema.GroupKind{Group: Group, Kind: NotificationSinkKind}.String()
+	NotificationSinkKindAPIVersion   = NotificationSinkKind + "." + SchemeGroupVersion.String()
+	NotificationSinkGroupVersionKind = SchemeGroupVersion.WithKind(NotificationSinkKind)
+)
+
+// ReplicaBoundsPolicy type metadata.
+var (
+	ReplicaBoundsPolicyKind             = reflect.TypeOf(ReplicaBoundsPolicy{}).Name()
+	ReplicaBoundsPolicyGroupKind        = schema.GroupKind{Group: Group, Kind: ReplicaBoundsPolicyKind}.String()
+	ReplicaBoundsPolicyKindAPIVersion   = ReplicaBoundsPolicyKind + "." + SchemeGroupVersion.String()
+	ReplicaBoundsPolicyGroupVersionKind = SchemeGroupVersion.WithKind(ReplicaBoundsPolicyKind)
+)
+
+// ScaleReport type metadata.
+var (
+	ScaleReportKind             = reflect.TypeOf(ScaleReport{}).Name()
+	ScaleReportGroupKind        = schema.GroupKind{Group: Group, Kind: ScaleReportKind}.String()
+	ScaleReportKindAPIVersion   = ScaleReportKind + "." + SchemeGroupVersion.String()
+	ScaleReportGroupVersionKind = SchemeGroupVersion.WithKind(ScaleReportKind)
+)
+
+func init() {
+	SchemeBuilder.Register(&ScheduledScalerTrait{}, &ScheduledScalerTraitList{})
+	SchemeBuilder.Register(&AutoscalerTrait{}, &AutoscalerTraitList{})
+	SchemeBuilder.Register(&NotificationSink{}, &NotificationSinkList{})
+	SchemeBuilder.Register(&ReplicaBoundsPolicy{}, &ReplicaBoundsPolicyList{})
+	SchemeBuilder.Register(&ScaleReport{}, &ScaleReportList{})
+}
@@ -0,0 +1,62 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A ReplicaBoundsPolicySpec defines the replicas the ManualScalerTraits a
+// ReplicaBoundsPolicy applies to may scale their workloads to.
+type ReplicaBoundsPolicySpec struct {
+	// MinReplicas the traits may scale their workloads to.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas the traits may scale their workloads to.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// TraitSelector selects the ManualScalerTraits in the namespace of the
+	// policy it applies to. It applies to every trait unless it is set.
+	// +optional
+	TraitSelector *metav1.LabelSelector `json:"traitSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A ReplicaBoundsPolicy bounds the replicas of the ManualScalerTraits in its
+// namespace. A trait must satisfy every policy that applies to it.
+// +kubebuilder:resource:categories={crossplane,oam}
+// +kubebuilder:printcolumn:JSONPath=".spec.minReplicas",name=MIN,type=integer
+// +kubebuilder:printcolumn:JSONPath=".spec.maxReplicas",name=MAX,type=integer
+type ReplicaBoundsPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReplicaBoundsPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ReplicaBoundsPolicyList contains a list of ReplicaBoundsPolicy.
+type ReplicaBoundsPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ReplicaBoundsPolicy `json:"items"`
+}
@@ -0,0 +1,89 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// A ScaleReportSpec identifies the trait a ScaleReport reports on.
+type ScaleReportSpec struct {
+	// TraitReference to the ManualScalerTrait whose targets are reported.
+	TraitReference runtimev1alpha1.TypedReference `json:"traitRef"`
+}
+
+// A ScaledTarget is a resource scaled by a trait.
+type ScaledTarget struct {
+	// APIVersion of the scaled resource.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the scaled resource.
+	Kind string `json:"kind"`
+
+	// Name of the scaled resource.
+	Name string `json:"name"`
+
+	// UID of the scaled resource.
+	// +optional
+	UID types.UID `json:"uid,omitempty"`
+
+	// DesiredReplicas the resource was scaled to.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+
+	// ReadyReplicas the resource reports. Resources that do not report their
+	// ready replicas are reported with none.
+	ReadyReplicas int64 `json:"readyReplicas"`
+}
+
+// A ScaleReportStatus represents the observed state of the resources scaled
+// by a trait.
+type ScaleReportStatus struct {
+	runtimev1alpha1.ConditionedStatus `json:",inline"`
+
+	// Targets scaled by the trait.
+	// +optional
+	Targets []ScaledTarget `json:"targets,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A ScaleReport lists the resources a ManualScalerTrait scaled and how many
+// of their replicas are ready. It has the name of the trait and is deleted
+// with it; the status of a ManualScalerTrait is defined upstream and only
+// carries conditions.
+// +kubebuilder:resource:categories={crossplane,oam}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=".spec.traitRef.name",name=TRAIT,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type=='Ready')].status",name=READY,type=string
+type ScaleReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScaleReportSpec   `json:"spec,omitempty"`
+	Status ScaleReportStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScaleReportList contains a list of ScaleReport.
+type ScaleReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScaleReport `json:"items"`
+}
@@ -0,0 +1,105 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// A ScalingWindow is a recurring period of time during which a workload has a
+// given number of replicas.
+type ScalingWindow struct {
+	// Name of the window.
+	Name string `json:"name"`
+
+	// Schedule is a standard cron expression (minute, hour, day of month,
+	// month, day of week) of the start of the window, e.g. "0 8 * * 1-5".
+	Schedule string `json:"schedule"`
+
+	// Duration of the window, e.g. "10h".
+	Duration metav1.Duration `json:"duration"`
+
+	// ReplicaCount of the workload during the window.
+	ReplicaCount int32 `json:"replicaCount"`
+}
+
+// A ScheduledScalerTraitSpec defines the desired state of a
+// ScheduledScalerTrait.
+type ScheduledScalerTraitSpec struct {
+	// Windows during which the workload is scaled. The first window in the
+	// list wins if windows overlap.
+	Windows []ScalingWindow `json:"windows"`
+
+	// DefaultReplicaCount of the workload outside of all the windows.
+	DefaultReplicaCount int32 `json:"defaultReplicaCount"`
+
+	// TimeZone the schedules are in, e.g. "Europe/Berlin". Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// WorkloadReference to the workload this trait applies to.
+	WorkloadReference runtimev1alpha1.TypedReference `json:"workloadRef"`
+}
+
+// A ScheduledScalerTraitStatus represents the observed state of a
+// ScheduledScalerTrait.
+type ScheduledScalerTraitStatus struct {
+	runtimev1alpha1.ConditionedStatus `json:",inline"`
+
+	// CurrentWindow is the name of the active window, it is empty outside of
+	// all the windows.
+	CurrentWindow string `json:"currentWindow,omitempty"`
+
+	// CurrentReplicaCount is the number of replicas the workload is scaled to.
+	CurrentReplicaCount int32 `json:"currentReplicaCount,omitempty"`
+
+	// NextWindow is the name of the window that is active after the next
+	// transition, it is empty if no window is active after it.
+	NextWindow string `json:"nextWindow,omitempty"`
+
+	// NextReplicaCount is the number of replicas after the next transition.
+	NextReplicaCount int32 `json:"nextReplicaCount,omitempty"`
+
+	// NextTransitionTime is the time the workload is scaled next.
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// A ScheduledScalerTrait scales a workload according to recurring windows.
+// +kubebuilder:resource:categories={crossplane,oam}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=".status.currentWindow",name=WINDOW,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.currentReplicaCount",name=REPLICAS,type=integer
+// +kubebuilder:printcolumn:JSONPath=".status.nextTransitionTime",name=NEXT,type=string
+type ScheduledScalerTrait struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScheduledScalerTraitSpec   `json:"spec,omitempty"`
+	Status ScheduledScalerTraitStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScheduledScalerTraitList contains a list of ScheduledScalerTrait.
+type ScheduledScalerTraitList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScheduledScalerTrait `json:"items"`
+}
@@ -9,6 +9,8 @@ require (
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.1
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.1.0
+	github.com/robfig/cron/v3 v3.0.1
 	gomodules.xyz/jsonpatch/v2 v2.0.1
 	k8s.io/api v0.18.3
 	k8s.io/apimachinery v0.18.3
@@ -16,18 +16,24 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"io/ioutil"
 	"os"
 
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	oamapi "github.com/crossplane/oam-kubernetes-runtime/apis/core"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	extendapi "github.com/crossplane/oam-controllers/apis/extend"
 	oamcore "github.com/crossplane/oam-controllers/pkg/controller/core"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/scopes/healthscope"
 	"github.com/crossplane/oam-controllers/pkg/webhooks"
 	// +kubebuilder:scaffold:imports
 )
@@ -37,6 +43,7 @@ var scheme = runtime.NewScheme()
 func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = oamapi.AddToScheme(scheme)
+	_ = extendapi.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -44,10 +51,34 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var enableWebhook bool
+	var healthAddr string
+	var healthTokenFile string
+	var builtinCerts bool
+	var webhookService string
+	var webhookNamespace string
+	var webhookCertSecret string
+	var defaultCPURequest string
+	var defaultMemoryRequest string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.BoolVar(&enableWebhook, "enable-webhook", true, "Enable webhooks")
+	flag.StringVar(&healthAddr, "health-addr", "",
+		"The address the HealthScope health endpoint binds to. The endpoint is disabled unless it is set.")
+	flag.StringVar(&healthTokenFile, "health-token-file", "",
+		"The file holding the bearer token clients of the HealthScope health endpoint must present.")
+	flag.BoolVar(&builtinCerts, "builtin-certs", false,
+		"Generate and rotate the webhook certificates in process instead of relying on cert-manager.")
+	flag.StringVar(&webhookService, "webhook-service", "",
+		"The name of the webhook service the built-in certificates are generated for.")
+	flag.StringVar(&webhookNamespace, "webhook-namespace", "",
+		"The namespace of the webhook service, the built-in certificates are stored in it.")
+	flag.StringVar(&webhookCertSecret, "webhook-cert-secret", "webhook-server-cert",
+		"The name of the secret the built-in certificates are stored in.")
+	flag.StringVar(&defaultCPURequest, "default-cpu-request", "",
+		"The CPU requested by the containers of new ContainerizedWorkloads that do not say, e.g. 100m. Nothing is requested unless it is set.")
+	flag.StringVar(&defaultMemoryRequest, "default-memory-request", "",
+		"The memory requested by the containers of new ContainerizedWorkloads that do not say, e.g. 128Mi. Nothing is requested unless it is set.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
@@ -74,6 +105,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	if healthAddr != "" {
+		token, err := ioutil.ReadFile(healthTokenFile)
+		if err != nil {
+			oamLog.Error(err, "unable to read the health endpoint token", "file", healthTokenFile)
+			os.Exit(1)
+		}
+		hs, err := healthscope.NewHealthServer(healthAddr, string(token), logging.NewLogrLogger(oamLog.WithName("health endpoint")))
+		if err != nil {
+			oamLog.Error(err, "unable to create the health endpoint")
+			os.Exit(1)
+		}
+		if err = mgr.Add(hs); err != nil {
+			oamLog.Error(err, "unable to add the health endpoint to the controller manager")
+			os.Exit(1)
+		}
+	}
+
 	if enableWebhook {
 		if err = (&webhooks.ManualScalerTraitValidator{
 			Log: ctrl.Log.WithName("validator webhook").WithName("ManualScalerTrait"),
@@ -87,6 +135,57 @@ func main() {
 			oamLog.Error(err, "unable to create webhook", "webhook name", "ManualScalerTraitMutater")
 			os.Exit(1)
 		}
+		if err = (&webhooks.HealthScopeValidator{
+			Log: ctrl.Log.WithName("validator webhook").WithName("HealthScope"),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			oamLog.Error(err, "unable to create webhook", "webhook name", "HealthScopeValidator")
+			os.Exit(1)
+		}
+		if err = (&webhooks.ContainerizedWorkloadValidator{
+			Log: ctrl.Log.WithName("validator webhook").WithName("ContainerizedWorkload"),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			oamLog.Error(err, "unable to create webhook", "webhook name", "ContainerizedWorkloadValidator")
+			os.Exit(1)
+		}
+		cwMutater := &webhooks.ContainerizedWorkloadMutater{
+			Log: ctrl.Log.WithName("mutate webhook").WithName("ContainerizedWorkload"),
+		}
+		if cwMutater.CPU, err = parseQuantity(defaultCPURequest); err != nil {
+			oamLog.Error(err, "invalid default CPU request", "default-cpu-request", defaultCPURequest)
+			os.Exit(1)
+		}
+		if cwMutater.Memory, err = parseQuantity(defaultMemoryRequest); err != nil {
+			oamLog.Error(err, "invalid default memory request", "default-memory-request", defaultMemoryRequest)
+			os.Exit(1)
+		}
+		if err = cwMutater.SetupWebhookWithManager(mgr); err != nil {
+			oamLog.Error(err, "unable to create webhook", "webhook name", "ContainerizedWorkloadMutater")
+			os.Exit(1)
+		}
+		if builtinCerts {
+			c, err := client.New(mgr.GetConfig(), client.Options{Scheme: scheme})
+			if err != nil {
+				oamLog.Error(err, "unable to create a client for the webhook certificate manager")
+				os.Exit(1)
+			}
+			cm := &webhooks.CertManager{
+				Client:    c,
+				Log:       ctrl.Log.WithName("webhook cert manager"),
+				Service:   webhookService,
+				Namespace: webhookNamespace,
+				Secret:    webhookCertSecret,
+				CertDir:   webhooks.Cert_mount_path,
+			}
+			// the webhook server reads the certificates once it starts, so they are provisioned before the manager starts
+			if err = cm.Provision(context.Background()); err != nil {
+				oamLog.Error(err, "unable to provision the webhook certificates")
+				os.Exit(1)
+			}
+			if err = mgr.Add(cm); err != nil {
+				oamLog.Error(err, "unable to add the webhook certificate manager to the controller manager")
+				os.Exit(1)
+			}
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -96,3 +195,11 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseQuantity parses a resource quantity flag, an empty flag is a zero quantity.
+func parseQuantity(v string) (resource.Quantity, error) {
+	if v == "" {
+		return resource.Quantity{}, nil
+	}
+	return resource.ParseQuantity(v)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// How the health of a scope's workloads adds up to the health of the scope.
+// Every workload must be healthy unless these are set.
+const (
+	// AnnotationAggregationPolicy is the aggregation policy, "all", "majority" or "percentage"
+	AnnotationAggregationPolicy = "healthscope.extend.oam.dev/aggregation-policy"
+	// AnnotationHealthyThreshold is the percentage of healthy workloads the "percentage" policy requires, e.g. "75"
+	AnnotationHealthyThreshold = "healthscope.extend.oam.dev/healthy-threshold"
+	// AnnotationWorkloadWeights are the criticality weights of workloads by name, e.g. "api=3,worker=1,batch=0".
+	// Workloads weigh 1 by default; a workload weighing 0 does not affect the scope's health.
+	AnnotationWorkloadWeights = "healthscope.extend.oam.dev/workload-weights"
+)
+
+// Aggregation policies.
+const (
+	PolicyAll        = "all"
+	PolicyMajority   = "majority"
+	PolicyPercentage = "percentage"
+)
+
+// TypeHealthy indicates whether a HealthScope's workloads satisfy its
+// aggregation policy.
+const TypeHealthy v1alpha1.ConditionType = "Healthy"
+
+// Reasons a HealthScope is or is not healthy.
+const (
+	ReasonPolicySatisfied    v1alpha1.ConditionReason = "PolicySatisfied"
+	ReasonPolicyNotSatisfied v1alpha1.ConditionReason = "PolicyNotSatisfied"
+)
+
+// Aggregation error strings.
+const (
+	errInvalidAggregation     = "invalid aggregation annotations"
+	errUnknownPolicy          = "unknown aggregation policy %q"
+	errInvalidThreshold       = "invalid healthy threshold %q, must be a percentage between 0 and 100"
+	errMissingThreshold       = "the percentage policy requires a healthy threshold"
+	errInvalidWorkloadWeights = "invalid workload weight %q, must be <name>=<non-negative integer>"
+)
+
+// An aggregationPolicy decides whether a scope is healthy given the health of
+// its workloads.
+type aggregationPolicy struct {
+	policy    string
+	threshold int
+	weights   map[string]int
+}
+
+// parseAggregationPolicy builds the policy from the scope annotations.
+func parseAggregationPolicy(annotations map[string]string) (aggregationPolicy, error) {
+	policy, err := parsePolicy(annotations[AnnotationAggregationPolicy])
+	if err != nil {
+		return aggregationPolicy{}, err
+	}
+	p := aggregationPolicy{policy: policy}
+	if policy == PolicyPercentage {
+		if p.threshold, err = parseHealthyThreshold(annotations[AnnotationHealthyThreshold]); err != nil {
+			return aggregationPolicy{}, err
+		}
+	}
+	if p.weights, err = parseWorkloadWeights(annotations[AnnotationWorkloadWeights]); err != nil {
+		return aggregationPolicy{}, err
+	}
+	return p, nil
+}
+
+// parsePolicy returns the aggregation policy named by v, "all" if it is empty.
+func parsePolicy(v string) (string, error) {
+	switch policy := strings.ToLower(strings.TrimSpace(v)); policy {
+	case "":
+		return PolicyAll, nil
+	case PolicyAll, PolicyMajority, PolicyPercentage:
+		return policy, nil
+	default:
+		return "", errors.Errorf(errUnknownPolicy, policy)
+	}
+}
+
+// parseHealthyThreshold returns the percentage of v, which may end with "%".
+func parseHealthyThreshold(v string) (int, error) {
+	t := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "%"))
+	if len(t) == 0 {
+		return 0, errors.New(errMissingThreshold)
+	}
+	threshold, err := strconv.Atoi(t)
+	if err != nil || threshold < 0 || threshold > 100 {
+		return 0, errors.Errorf(errInvalidThreshold, t)
+	}
+	return threshold, nil
+}
+
+// parseWorkloadWeights returns the weights of the workloads named in v, a nil
+// map if it names none.
+func parseWorkloadWeights(v string) (map[string]int, error) {
+	var weights map[string]int
+	for _, w := range strings.Split(v, ",") {
+		w = strings.TrimSpace(w)
+		if len(w) == 0 {
+			continue
+		}
+		kv := strings.SplitN(w, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return nil, errors.Errorf(errInvalidWorkloadWeights, w)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || weight < 0 {
+			return nil, errors.Errorf(errInvalidWorkloadWeights, w)
+		}
+		if weights == nil {
+			weights = make(map[string]int)
+		}
+		weights[strings.TrimSpace(kv[0])] = weight
+	}
+	return weights, nil
+}
+
+func (p aggregationPolicy) weight(ref v1alpha1.TypedReference) int {
+	if w, ok := p.weights[ref.Name]; ok {
+		return w
+	}
+	return 1
+}
+
+// requirement describes what the policy requires of the workloads.
+func (p aggregationPolicy) requirement() string {
+	switch p.policy {
+	case PolicyMajority:
+		return "more than half of the workload weight to be healthy"
+	case PolicyPercentage:
+		return fmt.Sprintf("at least %d%% of the workload weight to be healthy", p.threshold)
+	}
+	return "every workload to be healthy"
+}
+
+// aggregate returns whether the supplied workloads satisfy the policy, and
+// an explanation of the decision. Workloads of unknown health count as
+// unhealthy.
+func (p aggregationPolicy) aggregate(workloads []workloadHealth) (bool, string) {
+	var healthy, total, healthyWeight, totalWeight int
+	var unhealthy, unknown []string
+	for _, w := range workloads {
+		weight := p.weight(w.Reference)
+		total++
+		totalWeight += weight
+		if w.Healthy {
+			healthy++
+			healthyWeight += weight
+			continue
+		}
+		if w.Unknown {
+			unknown = append(unknown, w.Reference.Name)
+			continue
+		}
+		unhealthy = append(unhealthy, w.Reference.Name)
+	}
+
+	var ok bool
+	switch {
+	case totalWeight == 0:
+		// A scope without workloads that affect its health is healthy.
+		ok = true
+	case p.policy == PolicyMajority:
+		ok = healthyWeight*2 > totalWeight
+	case p.policy == PolicyPercentage:
+		ok = healthyWeight*100 >= p.threshold*totalWeight
+	default:
+		ok = healthyWeight == totalWeight
+	}
+
+	msg := fmt.Sprintf("%d of %d workloads healthy, weighing %d of %d; the %s policy requires %s",
+		healthy, total, healthyWeight, totalWeight, p.policy, p.requirement())
+	if len(unhealthy) > 0 {
+		msg += "; unhealthy: " + strings.Join(unhealthy, ", ")
+	}
+	if len(unknown) > 0 {
+		msg += "; unknown: " + strings.Join(unknown, ", ")
+	}
+	return ok, msg
+}
+
+// healthyCondition reports the aggregate health of a scope and why.
+func healthyCondition(h scopeHealth) v1alpha1.Condition {
+	c := v1alpha1.Condition{
+		Type:               TypeHealthy,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPolicySatisfied,
+		Message:            h.Explanation,
+	}
+	if !h.Healthy {
+		c.Status = corev1.ConditionFalse
+		c.Reason = ReasonPolicyNotSatisfied
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("HealthScope aggregation policies", func() {
+	workload := func(name string, healthy bool) workloadHealth {
+		return workloadHealth{Reference: v1alpha1.TypedReference{Kind: "ContainerizedWorkload", Name: name}, Healthy: healthy}
+	}
+	// api and web are healthy, worker and batch are not.
+	workloads := []workloadHealth{
+		workload("api", true), workload("web", true), workload("worker", false), workload("batch", false),
+	}
+	policy := func(annotations map[string]string) aggregationPolicy {
+		p, err := parseAggregationPolicy(annotations)
+		Expect(err).ShouldNot(HaveOccurred())
+		return p
+	}
+
+	It("Test require every workload to be healthy by default", func() {
+		healthy, msg := policy(nil).aggregate(workloads)
+		Expect(healthy).Should(BeFalse())
+		Expect(msg).Should(Equal("2 of 4 workloads healthy, weighing 2 of 4; the all policy requires " +
+			"every workload to be healthy; unhealthy: worker, batch"))
+
+		healthy, _ = policy(nil).aggregate(workloads[:2])
+		Expect(healthy).Should(BeTrue())
+		healthy, _ = policy(nil).aggregate(nil)
+		Expect(healthy).Should(BeTrue())
+	})
+
+	It("Test require a majority of workloads to be healthy", func() {
+		majority := map[string]string{AnnotationAggregationPolicy: PolicyMajority}
+		healthy, _ := policy(majority).aggregate(workloads)
+		Expect(healthy).Should(BeFalse())
+		healthy, _ = policy(majority).aggregate(workloads[:3])
+		Expect(healthy).Should(BeTrue())
+	})
+
+	It("Test require a percentage of workloads to be healthy", func() {
+		half := map[string]string{AnnotationAggregationPolicy: PolicyPercentage, AnnotationHealthyThreshold: "50%"}
+		healthy, msg := policy(half).aggregate(workloads)
+		Expect(healthy).Should(BeTrue())
+		Expect(msg).Should(ContainSubstring("at least 50% of the workload weight"))
+
+		most := map[string]string{AnnotationAggregationPolicy: PolicyPercentage, AnnotationHealthyThreshold: "75"}
+		healthy, _ = policy(most).aggregate(workloads)
+		Expect(healthy).Should(BeFalse())
+	})
+
+	It("Test weigh workloads by criticality", func() {
+		healthy, _ := policy(map[string]string{
+			AnnotationAggregationPolicy: PolicyMajority,
+			AnnotationWorkloadWeights:   "api=3, worker=1",
+		}).aggregate(workloads)
+		Expect(healthy).Should(BeTrue())
+
+		healthy, msg := policy(map[string]string{AnnotationWorkloadWeights: "worker=0,batch=0"}).aggregate(workloads)
+		Expect(healthy).Should(BeTrue())
+		Expect(msg).Should(HavePrefix("2 of 4 workloads healthy, weighing 2 of 2"))
+	})
+
+	It("Test reject invalid aggregation annotations", func() {
+		for _, annotations := range []map[string]string{
+			{AnnotationAggregationPolicy: "any"},
+			{AnnotationAggregationPolicy: PolicyPercentage},
+			{AnnotationAggregationPolicy: PolicyPercentage, AnnotationHealthyThreshold: "120"},
+			{AnnotationWorkloadWeights: "api"},
+			{AnnotationWorkloadWeights: "api=-1"},
+			{AnnotationWorkloadWeights: "=2"},
+		} {
+			_, err := parseAggregationPolicy(annotations)
+			Expect(err).Should(HaveOccurred(), "%v", annotations)
+		}
+	})
+
+	It("Test explain the decision in the Healthy condition", func() {
+		c := healthyCondition(scopeHealth{Healthy: false, Explanation: "why"})
+		Expect(c.Type).Should(Equal(TypeHealthy))
+		Expect(c.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(c.Reason).Should(Equal(ReasonPolicyNotSatisfied))
+		Expect(c.Message).Should(Equal("why"))
+		Expect(healthyCondition(scopeHealth{Healthy: true}).Status).Should(Equal(corev1.ConditionTrue))
+	})
+})
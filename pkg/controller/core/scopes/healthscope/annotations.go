@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidateAnnotations returns an error for each annotation of a HealthScope
+// whose value the controller cannot use. The controller does not evaluate the
+// health of a scope with an invalid aggregation policy, workload selector or
+// probe, and ignores invalid availability windows and event heartbeats.
+func ValidateAnnotations(annotations map[string]string) field.ErrorList {
+	path := field.NewPath("metadata", "annotations")
+	var errs field.ErrorList
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Key(key), annotations[key], err.Error()))
+		}
+	}
+
+	policy, err := parsePolicy(annotations[AnnotationAggregationPolicy])
+	check(AnnotationAggregationPolicy, err)
+	if policy == PolicyPercentage {
+		_, err = parseHealthyThreshold(annotations[AnnotationHealthyThreshold])
+		check(AnnotationHealthyThreshold, err)
+	}
+	_, err = parseWorkloadWeights(annotations[AnnotationWorkloadWeights])
+	check(AnnotationWorkloadWeights, err)
+
+	if sel := strings.TrimSpace(annotations[AnnotationWorkloadSelector]); len(sel) != 0 {
+		_, err = labels.Parse(sel)
+		check(AnnotationWorkloadSelector, err)
+	}
+	_, err = parseWorkloadKinds(annotations[AnnotationWorkloadKinds])
+	check(AnnotationWorkloadKinds, err)
+
+	_, err = parseProbeProtocol(annotations[AnnotationProbe])
+	check(AnnotationProbe, err)
+	_, err = parseExpectedStatus(annotations[AnnotationProbeExpectedStatus])
+	check(AnnotationProbeExpectedStatus, err)
+
+	_, err = parseAvailabilityWindows(annotations)
+	check(AnnotationAvailabilityWindows, err)
+	_, err = eventHeartbeat(annotations)
+	check(AnnotationEventHeartbeat, err)
+	return errs
+}
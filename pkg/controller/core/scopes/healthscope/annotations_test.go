@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("HealthScope annotation validation", func() {
+	invalid := func(annotations map[string]string) []string {
+		var keys []string
+		for _, err := range ValidateAnnotations(annotations) {
+			Expect(err.Type).Should(Equal(field.ErrorTypeInvalid))
+			keys = append(keys, err.Field)
+		}
+		return keys
+	}
+	key := func(annotation string) string {
+		return field.NewPath("metadata", "annotations").Key(annotation).String()
+	}
+
+	It("accepts a scope without annotations", func() {
+		Expect(ValidateAnnotations(nil)).Should(BeEmpty())
+	})
+
+	It("accepts valid annotations", func() {
+		Expect(ValidateAnnotations(map[string]string{
+			AnnotationAggregationPolicy:   "Percentage",
+			AnnotationHealthyThreshold:    "75%",
+			AnnotationWorkloadWeights:     "api=3, batch=0",
+			AnnotationWorkloadSelector:    "app=shop",
+			AnnotationWorkloadKinds:       "Deployment.v1.apps,Pod.v1",
+			AnnotationProbe:               "http",
+			AnnotationProbePath:           "/healthz",
+			AnnotationProbeExpectedStatus: "204",
+			AnnotationProbePort:           "http",
+			AnnotationAvailabilityWindows: "1h,7d",
+			AnnotationEventHeartbeat:      "1h",
+			AnnotationHealthHistory:       "written by the controller",
+		})).Should(BeEmpty())
+	})
+
+	It("rejects each invalid annotation", func() {
+		for annotation, value := range map[string]string{
+			AnnotationAggregationPolicy:   "most",
+			AnnotationWorkloadWeights:     "api=-1",
+			AnnotationWorkloadSelector:    "app in shop",
+			AnnotationWorkloadKinds:       "Deployment",
+			AnnotationProbe:               "udp",
+			AnnotationProbeExpectedStatus: "ok",
+			AnnotationAvailabilityWindows: "weekly",
+			AnnotationEventHeartbeat:      "-1h",
+		} {
+			Expect(invalid(map[string]string{annotation: value})).Should(Equal([]string{key(annotation)}), annotation)
+		}
+	})
+
+	It("only requires a healthy threshold for the percentage policy", func() {
+		Expect(invalid(map[string]string{AnnotationAggregationPolicy: PolicyPercentage})).
+			Should(Equal([]string{key(AnnotationHealthyThreshold)}))
+		Expect(invalid(map[string]string{AnnotationAggregationPolicy: PolicyPercentage, AnnotationHealthyThreshold: "120"})).
+			Should(Equal([]string{key(AnnotationHealthyThreshold)}))
+		Expect(ValidateAnnotations(map[string]string{AnnotationAggregationPolicy: PolicyMajority, AnnotationHealthyThreshold: "120"})).
+			Should(BeEmpty())
+	})
+
+	It("reports every invalid annotation", func() {
+		Expect(invalid(map[string]string{AnnotationProbe: "udp", AnnotationEventHeartbeat: "hourly"})).
+			Should(ConsistOf(key(AnnotationProbe), key(AnnotationEventHeartbeat)))
+	})
+})
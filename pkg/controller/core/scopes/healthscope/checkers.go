@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// Health checker error strings.
+const (
+	errResourceNotFound       = "could not retrieve resource %q %q %q"
+	errDeploymentUnavailable  = "no ready instance found in %q %q %q"
+	errStatefulSetUnavailable = "%d of %d instances ready in %q %q %q"
+	errDaemonSetUnavailable   = "%d of %d scheduled instances ready in %q %q %q"
+	errJobFailed              = "job %q %q %q failed: %s"
+	errResourceNotReady       = "resource %q %q %q is not ready: %s"
+)
+
+// A HealthChecker checks the health of a resource of a workload referenced by
+// a HealthScope. It returns an error explaining why the resource is unhealthy.
+type HealthChecker interface {
+	Check(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error
+}
+
+// A HealthCheckerFn is a function that satisfies the HealthChecker interface.
+type HealthCheckerFn func(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error
+
+// Check the health of the referenced resource.
+func (fn HealthCheckerFn) Check(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	return fn(ctx, c, namespace, ref)
+}
+
+// HealthCheckers is a registry of health checkers keyed by the kind of
+// resource they check. Resources of a kind without a registered checker are
+// checked by the fallback checker.
+type HealthCheckers struct {
+	mu       sync.RWMutex
+	checkers map[schema.GroupVersionKind]HealthChecker
+	fallback HealthChecker
+}
+
+// NewHealthCheckers returns a registry that checks every resource using the
+// supplied fallback checker.
+func NewHealthCheckers(fallback HealthChecker) *HealthCheckers {
+	return &HealthCheckers{
+		checkers: make(map[schema.GroupVersionKind]HealthChecker),
+		fallback: fallback,
+	}
+}
+
+// DefaultHealthCheckers returns a registry with the built-in checkers for
+// Deployments, StatefulSets, DaemonSets and Jobs. Any other resource is
+// healthy if it exists and its Ready condition, if any, is true.
+func DefaultHealthCheckers() *HealthCheckers {
+	hc := NewHealthCheckers(HealthCheckerFn(readyConditionHealthStatus))
+	hc.Register(apps.SchemeGroupVersion.WithKind("Deployment"), HealthCheckerFn(deploymentHealthStatus))
+	hc.Register(apps.SchemeGroupVersion.WithKind("StatefulSet"), HealthCheckerFn(statefulSetHealthStatus))
+	hc.Register(apps.SchemeGroupVersion.WithKind("DaemonSet"), HealthCheckerFn(daemonSetHealthStatus))
+	hc.Register(batch.SchemeGroupVersion.WithKind("Job"), HealthCheckerFn(jobHealthStatus))
+	return hc
+}
+
+// Register the checker for resources of the supplied kind, replacing any
+// checker previously registered for it.
+func (hc *HealthCheckers) Register(gvk schema.GroupVersionKind, checker HealthChecker) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checkers[gvk] = checker
+}
+
+// For returns the checker for resources of the supplied kind.
+func (hc *HealthCheckers) For(gvk schema.GroupVersionKind) HealthChecker {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if checker, ok := hc.checkers[gvk]; ok {
+		return checker
+	}
+	return hc.fallback
+}
+
+// Check the health of the referenced resource using the checker for its kind.
+func (hc *HealthCheckers) Check(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	return hc.For(ref.GroupVersionKind()).Check(ctx, c, namespace, ref)
+}
+
+func deploymentHealthStatus(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	deployment := apps.Deployment{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &deployment); err != nil {
+		return errors.Wrapf(err, errResourceNotFound, ref.APIVersion, ref.Kind, ref.Name)
+	}
+
+	if deployment.Status.ReadyReplicas == 0 {
+		return errors.Errorf(errDeploymentUnavailable, ref.APIVersion, ref.Kind, ref.Name)
+	}
+	return nil
+}
+
+func statefulSetHealthStatus(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	sts := apps.StatefulSet{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &sts); err != nil {
+		return errors.Wrapf(err, errResourceNotFound, ref.APIVersion, ref.Kind, ref.Name)
+	}
+
+	// A StatefulSet without replicas set runs a single instance.
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+	if sts.Status.ReadyReplicas < desired {
+		return errors.Errorf(errStatefulSetUnavailable, sts.Status.ReadyReplicas, desired, ref.APIVersion, ref.Kind, ref.Name)
+	}
+	return nil
+}
+
+func daemonSetHealthStatus(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	ds := apps.DaemonSet{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &ds); err != nil {
+		return errors.Wrapf(err, errResourceNotFound, ref.APIVersion, ref.Kind, ref.Name)
+	}
+
+	if ds.Status.NumberReady < ds.Status.DesiredNumberScheduled {
+		return errors.Errorf(errDaemonSetUnavailable, ds.Status.NumberReady, ds.Status.DesiredNumberScheduled,
+			ref.APIVersion, ref.Kind, ref.Name)
+	}
+	return nil
+}
+
+// jobHealthStatus considers a Job healthy unless it failed; a Job that is
+// still running or completed successfully is healthy.
+func jobHealthStatus(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	job := batch.Job{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &job); err != nil {
+		return errors.Wrapf(err, errResourceNotFound, ref.APIVersion, ref.Kind, ref.Name)
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batch.JobFailed && cond.Status == corev1.ConditionTrue {
+			return errors.Errorf(errJobFailed, ref.APIVersion, ref.Kind, ref.Name, conditionMessage(cond.Reason, cond.Message))
+		}
+	}
+	return nil
+}
+
+// readyConditionHealthStatus considers a resource of any kind healthy if it
+// exists and the Ready condition in its status.conditions, if any, is true.
+func readyConditionHealthStatus(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) error {
+	object := unstructured.Unstructured{}
+	object.SetAPIVersion(ref.APIVersion)
+	object.SetKind(ref.Kind)
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &object); err != nil {
+		return errors.Wrapf(err, errResourceNotFound, ref.APIVersion, ref.Kind, ref.Name)
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, item := range conditions {
+		cond, ok := item.(map[string]interface{})
+		if !ok || cond["type"] != string(v1alpha1.TypeReady) {
+			continue
+		}
+		if cond["status"] == string(corev1.ConditionTrue) {
+			return nil
+		}
+		reason, _ := cond["reason"].(string)
+		message, _ := cond["message"].(string)
+		return errors.Errorf(errResourceNotReady, ref.APIVersion, ref.Kind, ref.Name, conditionMessage(reason, message))
+	}
+	return nil
+}
+
+func conditionMessage(reason, message string) string {
+	switch {
+	case len(message) == 0 && len(reason) == 0:
+		return "no reason given"
+	case len(message) == 0:
+		return reason
+	case len(reason) == 0:
+		return message
+	}
+	return reason + ": " + message
+}
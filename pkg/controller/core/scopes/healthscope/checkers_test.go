@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// objectClient returns a client whose Get returns a copy of the supplied object.
+func objectClient(obj runtime.Object) client.Client {
+	c := test.NewMockClient()
+	c.MockGet = test.NewMockGetFn(nil, func(o runtime.Object) error {
+		switch into := o.(type) {
+		case *apps.StatefulSet:
+			*into = *obj.(*apps.StatefulSet)
+		case *apps.DaemonSet:
+			*into = *obj.(*apps.DaemonSet)
+		case *batch.Job:
+			*into = *obj.(*batch.Job)
+		case *unstructured.Unstructured:
+			into.Object = obj.(*unstructured.Unstructured).DeepCopy().Object
+		}
+		return nil
+	})
+	return c
+}
+
+var _ = Describe("HealthScope health checkers", func() {
+	ctx := context.Background()
+	ref := func(apiVersion, kind string) v1alpha1.TypedReference {
+		return v1alpha1.TypedReference{APIVersion: apiVersion, Kind: kind, Name: "res"}
+	}
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	It("Test look up checkers by kind", func() {
+		hc := DefaultHealthCheckers()
+		custom := HealthCheckerFn(func(context.Context, client.Client, string, v1alpha1.TypedReference) error {
+			return nil
+		})
+		gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}
+		Expect(hc.For(gvk)).ShouldNot(BeNil())
+		hc.Register(gvk, custom)
+		Expect(hc.For(gvk)).Should(BeAssignableToTypeOf(custom))
+		Expect(hc.Check(ctx, nil, "default", v1alpha1.TypedReference{
+			APIVersion: "example.com/v1", Kind: "Database", Name: "db",
+		})).Should(Succeed())
+	})
+
+	It("Test check a StatefulSet", func() {
+		sts := &apps.StatefulSet{
+			Spec:   apps.StatefulSetSpec{Replicas: int32Ptr(3)},
+			Status: apps.StatefulSetStatus{ReadyReplicas: 2},
+		}
+		err := statefulSetHealthStatus(ctx, objectClient(sts), "default", ref("apps/v1", "StatefulSet"))
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("2 of 3 instances ready"))
+
+		sts.Status.ReadyReplicas = 3
+		Expect(statefulSetHealthStatus(ctx, objectClient(sts), "default", ref("apps/v1", "StatefulSet"))).Should(Succeed())
+	})
+
+	It("Test check a DaemonSet", func() {
+		ds := &apps.DaemonSet{Status: apps.DaemonSetStatus{DesiredNumberScheduled: 4, NumberReady: 3}}
+		Expect(daemonSetHealthStatus(ctx, objectClient(ds), "default", ref("apps/v1", "DaemonSet"))).ShouldNot(Succeed())
+
+		ds.Status.NumberReady = 4
+		Expect(daemonSetHealthStatus(ctx, objectClient(ds), "default", ref("apps/v1", "DaemonSet"))).Should(Succeed())
+	})
+
+	It("Test check a Job", func() {
+		job := &batch.Job{Status: batch.JobStatus{Active: 1}}
+		Expect(jobHealthStatus(ctx, objectClient(job), "default", ref("batch/v1", "Job"))).Should(Succeed())
+
+		job.Status.Conditions = []batch.JobCondition{{
+			Type:    batch.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		}}
+		err := jobHealthStatus(ctx, objectClient(job), "default", ref("batch/v1", "Job"))
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("BackoffLimitExceeded: Job has reached the specified backoff limit"))
+	})
+
+	It("Test check the Ready condition of any resource", func() {
+		withReady := func(status string) *unstructured.Unstructured {
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"status": map[string]interface{}{"conditions": []interface{}{
+					map[string]interface{}{"type": "Synced", "status": "True"},
+					map[string]interface{}{"type": "Ready", "status": status, "reason": "Creating"},
+				}},
+			}}
+		}
+		db := ref("example.com/v1", "Database")
+
+		Expect(readyConditionHealthStatus(ctx, objectClient(withReady("True")), "default", db)).Should(Succeed())
+		err := readyConditionHealthStatus(ctx, objectClient(withReady("False")), "default", db)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(ContainSubstring("is not ready: Creating"))
+
+		noConditions := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		Expect(readyConditionHealthStatus(ctx, objectClient(noConditions), "default", ref("v1", "Service"))).Should(Succeed())
+	})
+})
@@ -0,0 +1,38 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthscope implements the HealthScope controller and the health
+// endpoint that serves the health it records.
+//
+// The HealthScope API belongs to the OAM runtime, so what this controller adds
+// to it is configured with annotations in the healthscope.extend.oam.dev
+// domain rather than with spec fields. All of them are optional:
+//
+//	aggregation-policy     all (default), majority or percentage
+//	healthy-threshold      the percentage of healthy workloads the percentage policy requires, e.g. 75
+//	workload-weights       weights of workloads by name, e.g. api=3,batch=0; workloads weigh 1 by default
+//	workload-selector      a label selector of workloads that belong to the scope, e.g. app=shop
+//	workload-kinds         the kinds the selector applies to, e.g. Deployment.v1.apps; ContainerizedWorkloads by default
+//	probe                  http or tcp, probes the Service endpoints of the workloads
+//	probe-path             the path an http probe requests, / by default
+//	probe-expected-status  the status code an http probe expects, any 2xx or 3xx by default
+//	probe-port             the name or number of the only port to probe
+//	availability-windows   the windows availability is computed over, 1h,24h,30d by default
+//	event-heartbeat        how often an event is recorded when the health does not change, e.g. 1h
+//
+// The health-history annotation is written by the controller. The validating
+// webhook of HealthScopes rejects invalid values, see ValidateAnnotations.
+package healthscope
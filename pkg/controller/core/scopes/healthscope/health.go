@@ -0,0 +1,273 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+)
+
+// Health check error strings.
+const (
+	errNoWorkload          = "could not retrieve workload %q"
+	errNoWorkloadResources = "could not retrieve resources for workload %q"
+	errWorkloadTimeout     = "health check of workload %q did not complete within %s"
+)
+
+// Health values reported for a HealthScope and its workloads.
+const (
+	statusHealthy   = "healthy"
+	statusUnhealthy = "unhealthy"
+	statusUnknown   = "unknown"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+
+	// defaultHealthWorkers is how many workloads of a scope are checked at once.
+	defaultHealthWorkers = 5
+)
+
+// A workloadHealth is the result of checking every resource of one workload
+// referenced by a HealthScope.
+type workloadHealth struct {
+	Reference v1alpha1.TypedReference
+	Healthy   bool
+
+	// Unknown is true if the health of the workload could not be determined
+	// in time. An unknown workload is not healthy.
+	Unknown bool
+
+	// Message explains why the workload is unhealthy or unknown.
+	Message string
+
+	// AppConfigs are the names of the ApplicationConfigurations owning the
+	// workload.
+	AppConfigs []string
+}
+
+// Status returns the health of the workload.
+func (w workloadHealth) Status() string {
+	if w.Unknown {
+		return statusUnknown
+	}
+	return healthStatus(w.Healthy)
+}
+
+// A scopeHealth is the result of checking every workload of a HealthScope.
+type scopeHealth struct {
+	Healthy   bool
+	Workloads []workloadHealth
+
+	// Explanation describes how the scope's aggregation policy decided
+	// whether it is healthy.
+	Explanation string
+
+	// Selector is true if the scope selects workloads by their labels, in
+	// which case Selected are the workloads it resolved to.
+	Selector bool
+	Selected []v1alpha1.TypedReference
+}
+
+// Status returns the aggregate health as reported in a HealthScope's status.
+func (h scopeHealth) Status() string {
+	return healthStatus(h.Healthy)
+}
+
+// probeTimeout returns how long a HealthScope allows the health check of a
+// single workload to take.
+func probeTimeout(hs *v1alpha2.HealthScope) time.Duration {
+	if hs.Spec.ProbeTimeout != nil && *hs.Spec.ProbeTimeout > 0 {
+		return time.Duration(*hs.Spec.ProbeTimeout) * time.Second
+	}
+	return defaultProbeTimeout
+}
+
+// A healthEvaluator checks the health of the workloads of a HealthScope.
+type healthEvaluator struct {
+	client   client.Client
+	checkers *HealthCheckers
+	prober   *prober
+
+	// workers is how many workloads of a scope are checked at once.
+	workers int
+}
+
+// evaluate checks the resources of every workload referenced or selected by
+// the supplied HealthScope using the checker registered for their kind. If the scope
+// enables probing, the endpoints of every Service of a workload must answer
+// the probe too. A workload is healthy when all of its resources are; whether
+// the scope is healthy is decided by its aggregation policy.
+//
+// Each workload is checked within the scope's probe timeout. A workload that
+// could not be checked in time is reported as unknown rather than failing the
+// health check of the whole scope.
+func (e *healthEvaluator) evaluate(ctx context.Context, log logging.Logger, hs *v1alpha2.HealthScope) (scopeHealth, error) {
+	probe, err := parseProbeSpec(hs.GetAnnotations(), probeTimeout(hs))
+	if err != nil {
+		return scopeHealth{}, errors.Wrap(err, errInvalidProbe)
+	}
+	policy, err := parseAggregationPolicy(hs.GetAnnotations())
+	if err != nil {
+		return scopeHealth{}, errors.Wrap(err, errInvalidAggregation)
+	}
+	sel, err := parseWorkloadSelector(hs.GetAnnotations())
+	if err != nil {
+		return scopeHealth{}, err
+	}
+
+	result := scopeHealth{Selector: sel != nil}
+	if sel != nil {
+		if result.Selected, err = sel.selectWorkloads(ctx, e.client, hs.GetNamespace()); err != nil {
+			return scopeHealth{}, err
+		}
+	}
+	refs := members(hs.Spec.WorkloadReferences, result.Selected)
+	result.Workloads = make([]workloadHealth, len(refs))
+
+	workers := e.workers
+	if workers <= 0 {
+		workers = defaultHealthWorkers
+	}
+	if workers > len(refs) {
+		workers = len(refs)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				result.Workloads[i] = e.evaluateWorkload(ctx, log, hs.GetNamespace(), probeTimeout(hs), probe, refs[i])
+			}
+		}()
+	}
+	for i := range refs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	result.Healthy, result.Explanation = policy.aggregate(result.Workloads)
+	return result, nil
+}
+
+// evaluateWorkload checks the health of a single workload. Looking up the
+// workload and its resources must complete within the supplied timeout; each
+// probe of its Service endpoints has a timeout of its own.
+func (e *healthEvaluator) evaluateWorkload(ctx context.Context, log logging.Logger, namespace string,
+	timeout time.Duration, probe *probeSpec, ref v1alpha1.TypedReference) workloadHealth {
+	wh := workloadHealth{Reference: ref, Healthy: true}
+	fail := func(ctx context.Context, err error) workloadHealth {
+		wh.Healthy = false
+		wh.Message = err.Error()
+		if ctx.Err() != nil {
+			wh.Unknown = true
+			wh.Message = errors.Wrapf(err, errWorkloadTimeout, ref.Name, timeout).Error()
+		}
+		log.Debug("Unhealthy workload", "workload", ref.Name, "health", wh.Status(), "error", err)
+		return wh
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	workload, err := getWorkload(lookupCtx, e.client, namespace, ref)
+	if err != nil {
+		return fail(lookupCtx, err)
+	}
+	wh.AppConfigs = appConfigOwners(workload.GetOwnerReferences())
+	resources, err := workloadResources(workload, ref)
+	if err != nil {
+		return fail(lookupCtx, err)
+	}
+
+	var targets []probeTarget
+	for _, r := range resources {
+		if err := e.checkers.Check(lookupCtx, e.client, namespace, r); err != nil {
+			return fail(lookupCtx, err)
+		}
+		if probe == nil || r.GroupVersionKind() != corev1.SchemeGroupVersion.WithKind("Service") {
+			continue
+		}
+		addresses, err := serviceEndpoints(lookupCtx, e.client, namespace, r.Name, probe)
+		if err != nil {
+			return fail(lookupCtx, err)
+		}
+		for _, a := range addresses {
+			targets = append(targets, probeTarget{service: r.Name, address: a})
+		}
+	}
+
+	for _, err := range e.prober.probe(ctx, probe, targets) {
+		if err != nil {
+			return fail(ctx, err)
+		}
+	}
+	return wh
+}
+
+// getWorkload returns the referenced workload.
+func getWorkload(ctx context.Context, c client.Client, namespace string, ref v1alpha1.TypedReference) (*unstructured.Unstructured, error) {
+	workload := &unstructured.Unstructured{}
+	workload.SetAPIVersion(ref.APIVersion)
+	workload.SetKind(ref.Kind)
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, workload); err != nil {
+		return nil, errors.Wrapf(err, errNoWorkload, ref.Name)
+	}
+	return workload, nil
+}
+
+// workloadResources returns the resources recorded in the status of the
+// supplied workload.
+func workloadResources(workload *unstructured.Unstructured, ref v1alpha1.TypedReference) ([]v1alpha1.TypedReference, error) {
+	// TODO(artursouza): not every workload has child resources, need to handle those scenarios too.
+	value, err := fieldpath.Pave(workload.UnstructuredContent()).GetValue("status.resources")
+	if err != nil {
+		return nil, errors.Wrapf(err, errNoWorkloadResources, ref.Name)
+	}
+
+	refs, _ := value.([]interface{})
+	resources := make([]v1alpha1.TypedReference, 0, len(refs))
+	for _, item := range refs {
+		r, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resources = append(resources, v1alpha1.TypedReference{
+			APIVersion: fmt.Sprintf("%v", r["apiVersion"]),
+			Kind:       fmt.Sprintf("%v", r["kind"]),
+			Name:       fmt.Sprintf("%v", r["name"]),
+		})
+	}
+	return resources, nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	apps "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeWorkload returns a workload whose status records the supplied resources.
+func fakeWorkload(name string, resources ...v1alpha1.TypedReference) *unstructured.Unstructured {
+	refs := make([]interface{}, 0, len(resources))
+	for _, r := range resources {
+		refs = append(refs, map[string]interface{}{
+			"apiVersion": r.APIVersion,
+			"kind":       r.Kind,
+			"name":       r.Name,
+		})
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"resources": refs},
+	}}
+	u.SetName(name)
+	return u
+}
+
+// healthClient serves the supplied workloads and Deployments by name. Any
+// other resource exists when it is listed in existing.
+func healthClient(workloads map[string]*unstructured.Unstructured, deployments map[string]*apps.Deployment,
+	existing ...string) client.Client {
+	c := test.NewMockClient()
+	c.MockGet = func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+		switch o := obj.(type) {
+		case *apps.Deployment:
+			if d, ok := deployments[key.Name]; ok {
+				*o = *d
+				return nil
+			}
+		case *unstructured.Unstructured:
+			if w, ok := workloads[key.Name]; ok {
+				o.Object = w.DeepCopy().Object
+				return nil
+			}
+			for _, name := range existing {
+				if name == key.Name {
+					return nil
+				}
+			}
+		}
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	return c
+}
+
+// evaluator returns a healthEvaluator with the default checkers and probe concurrency.
+func evaluator(c client.Client) *healthEvaluator {
+	return &healthEvaluator{client: c, checkers: DefaultHealthCheckers(), prober: newProber(0)}
+}
+
+var _ = Describe("HealthScope health check", func() {
+	deploy := v1alpha1.TypedReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"}
+	svc := v1alpha1.TypedReference{APIVersion: "v1", Kind: "Service", Name: "web"}
+	wlRef := func(name string) v1alpha1.TypedReference {
+		return v1alpha1.TypedReference{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.ContainerizedWorkloadKind,
+			Name:       name,
+		}
+	}
+	scope := func(refs ...v1alpha1.TypedReference) *v1alpha2.HealthScope {
+		return &v1alpha2.HealthScope{
+			ObjectMeta: metav1.ObjectMeta{Name: "scope", Namespace: "default"},
+			Spec:       v1alpha2.HealthScopeSpec{WorkloadReferences: refs},
+		}
+	}
+	ready := func(replicas int32) *apps.Deployment {
+		return &apps.Deployment{Status: apps.DeploymentStatus{ReadyReplicas: replicas}}
+	}
+
+	It("Test a scope is healthy when every workload resource is", func() {
+		c := healthClient(map[string]*unstructured.Unstructured{"app": fakeWorkload("app", deploy, svc)},
+			map[string]*apps.Deployment{"web": ready(1)}, "web")
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), scope(wlRef("app")))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeTrue())
+		Expect(h.Status()).Should(Equal(statusHealthy))
+		Expect(h.Workloads).Should(Equal([]workloadHealth{{Reference: wlRef("app"), Healthy: true}}))
+	})
+
+	It("Test a scope is unhealthy when one workload has no ready instance", func() {
+		other := v1alpha1.TypedReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker"}
+		c := healthClient(map[string]*unstructured.Unstructured{
+			"app":    fakeWorkload("app", deploy),
+			"worker": fakeWorkload("worker", other),
+		}, map[string]*apps.Deployment{"web": ready(2), "worker": ready(0)})
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), scope(wlRef("app"), wlRef("worker")))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeFalse())
+		Expect(h.Status()).Should(Equal(statusUnhealthy))
+		Expect(h.Workloads).Should(HaveLen(2))
+		Expect(h.Workloads[0].Healthy).Should(BeTrue())
+		Expect(h.Workloads[1].Healthy).Should(BeFalse())
+		Expect(h.Workloads[1].Message).Should(ContainSubstring("no ready instance found"))
+	})
+
+	It("Test a scope is unhealthy when a workload resource is missing", func() {
+		c := healthClient(map[string]*unstructured.Unstructured{"app": fakeWorkload("app", svc)}, nil)
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), scope(wlRef("app")))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeFalse())
+	})
+
+	It("Test a workload that cannot be fetched is unhealthy", func() {
+		c := healthClient(map[string]*unstructured.Unstructured{"app": fakeWorkload("app", deploy)},
+			map[string]*apps.Deployment{"web": ready(1)})
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), scope(wlRef("app"), wlRef("missing")))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeFalse())
+		Expect(h.Workloads[0].Healthy).Should(BeTrue())
+		Expect(h.Workloads[1].Status()).Should(Equal(statusUnhealthy))
+		Expect(h.Workloads[1].Message).Should(ContainSubstring(`could not retrieve workload "missing"`))
+	})
+
+	It("Test a workload that times out is unknown and the others are still reported", func() {
+		c := healthClient(map[string]*unstructured.Unstructured{"app": fakeWorkload("app", deploy)},
+			map[string]*apps.Deployment{"web": ready(1)})
+		get := c.(*test.MockClient).MockGet
+		c.(*test.MockClient).MockGet = func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+			if key.Name == "slow" {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return get(ctx, key, obj)
+		}
+		timeout := int32(1)
+		hs := scope(wlRef("app"), wlRef("slow"))
+		hs.Spec.ProbeTimeout = &timeout
+
+		start := time.Now()
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), hs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(time.Since(start)).Should(BeNumerically("<", 3*time.Second))
+		Expect(h.Healthy).Should(BeFalse())
+		Expect(h.Workloads[0].Status()).Should(Equal(statusHealthy))
+		Expect(h.Workloads[1].Status()).Should(Equal(statusUnknown))
+		Expect(h.Workloads[1].Message).Should(ContainSubstring(`health check of workload "slow" did not complete within 1s`))
+		Expect(h.Explanation).Should(ContainSubstring("unknown: slow"))
+	})
+
+	It("Test bound the number of workloads checked at once", func() {
+		var inFlight, maxInFlight int32
+		workloads := map[string]*unstructured.Unstructured{}
+		var refs []v1alpha1.TypedReference
+		for i := 0; i < 6; i++ {
+			name := fmt.Sprintf("app-%d", i)
+			workloads[name] = fakeWorkload(name)
+			refs = append(refs, wlRef(name))
+		}
+		c := healthClient(workloads, nil)
+		get := c.(*test.MockClient).MockGet
+		c.(*test.MockClient).MockGet = func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return get(ctx, key, obj)
+		}
+
+		e := evaluator(c)
+		e.workers = 2
+		h, err := e.evaluate(context.Background(), logging.NewNopLogger(), scope(refs...))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeTrue())
+		Expect(h.Workloads).Should(HaveLen(6))
+		Expect(atomic.LoadInt32(&maxInFlight)).Should(BeNumerically("<=", 2))
+	})
+})
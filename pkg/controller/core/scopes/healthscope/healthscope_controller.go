@@ -18,21 +18,31 @@ package healthscope
 
 import (
 	"context"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 
 	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
-	"github.com/crossplane/oam-kubernetes-runtime/pkg/scope/health"
 )
 
 const (
@@ -45,32 +55,74 @@ const (
 const (
 	errGetHealthScope          = "cannot get health scope"
 	errUpdateHealthScopeStatus = "cannot update health scope status"
+	errIndexWorkloads          = "cannot index health scopes by workload"
+	errIndexSelectors          = "cannot index health scopes by workload selector"
 )
 
 // Reconcile event reasons.
 const (
-	reasonHealthCheck       = "HealthCheck"
-	reasonHealthCheckFailed = "HealthCheckFailed"
+	reasonHealthCheck           = "HealthCheck"
+	reasonHealthCheckFailed     = "HealthCheckFailed"
+	reasonHealthRecovered       = "HealthRecovered"
+	reasonHealthDegraded        = "HealthDegraded"
+	reasonWorkloadHealthChanged = "WorkloadHealthChanged"
+	reasonNotificationFailed    = "NotificationFailed"
 )
 
-// Setup adds a controller that reconciles HealthScope.
+// Setup adds a controller that reconciles HealthScope. Scopes are
+// re-evaluated as soon as the workloads they reference, or the Deployments,
+// StatefulSets and Pods of those workloads, change; the probe interval is
+// kept as a safety net. The changes of the resources in namespaces without
+// scopes are ignored.
 func Setup(mgr ctrl.Manager, l logging.Logger) error {
 	name := "oam/" + strings.ToLower(v1alpha2.HealthScopeGroupKind)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha2.HealthScope{}, workloadIndex,
+		indexWorkloadReferences); err != nil {
+		return errors.Wrap(err, errIndexWorkloads)
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha2.HealthScope{}, selectorIndex,
+		indexSelectedKinds); err != nil {
+		return errors.Wrap(err, errIndexSelectors)
+	}
+
+	r := NewReconciler(mgr,
+		WithLogger(l.WithValues("controller", name)),
+		WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))))
+	toScopes := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapToScopes)}
+	changed := builder.WithPredicates(statusChangedPredicate(), inScopeNamespacePredicate(r.namespaces))
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
-		For(&v1alpha2.HealthScope{}).
-		Complete(NewReconciler(mgr,
-			WithLogger(l.WithValues("controller", name)),
-			WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name)))))
+		For(&v1alpha2.HealthScope{}, builder.WithPredicates(scopeChangedPredicate())).
+		Watches(&source.Kind{Type: &apps.Deployment{}}, toScopes, changed).
+		Watches(&source.Kind{Type: &apps.StatefulSet{}}, toScopes, changed).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, toScopes, changed).
+		Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	return nil
 }
 
 // A Reconciler reconciles OAM Scopes by keeping track of the health status of components.
 type Reconciler struct {
 	client client.Client
 
-	log    logging.Logger
-	record event.Recorder
+	// controller is used to watch the kinds of workloads scopes reference
+	controller controller.Controller
+	watchLock  sync.Mutex
+	watched    map[schema.GroupVersionKind]bool
+
+	log         logging.Logger
+	record      event.Recorder
+	health      *healthEvaluator
+	metrics     *healthMetrics
+	reports     *healthReports
+	transitions *transitionTracker
+	parents     *appHealthTracker
+	namespaces  *scopeNamespaces
+	notifier    *notifier
 }
 
 // A ReconcilerOption configures a Reconciler.
@@ -90,12 +142,52 @@ func WithRecorder(er event.Recorder) ReconcilerOption {
 	}
 }
 
+// WithHealthCheckers specifies how the Reconciler should check the health of
+// each kind of workload resource.
+func WithHealthCheckers(hc *HealthCheckers) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.health.checkers = hc
+	}
+}
+
+// WithProbeConcurrency specifies how many Service endpoints of a scope the
+// Reconciler should probe at once.
+func WithProbeConcurrency(n int) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.health.prober = newProber(n)
+	}
+}
+
+// WithHealthWorkers specifies how many workloads of a scope the Reconciler
+// should check at once.
+func WithHealthWorkers(n int) ReconcilerOption {
+	return func(r *Reconciler) {
+		r.health.workers = n
+	}
+}
+
 // NewReconciler returns a Reconciler that reconciles HealthScope by keeping track of its healthstatus.
 func NewReconciler(m ctrl.Manager, o ...ReconcilerOption) *Reconciler {
 	r := &Reconciler{
 		client: m.GetClient(),
 		log:    logging.NewNopLogger(),
 		record: event.NewNopRecorder(),
+		health: &healthEvaluator{
+			client:   m.GetClient(),
+			checkers: DefaultHealthCheckers(),
+			prober:   newProber(defaultProbeConcurrency),
+			workers:  defaultHealthWorkers,
+		},
+		metrics:     defaultMetrics,
+		reports:     defaultReports,
+		transitions: newTransitionTracker(),
+		parents:     newAppHealthTracker(),
+		namespaces:  newScopeNamespaces(),
+		notifier: &notifier{
+			client:  m.GetClient(),
+			secrets: m.GetAPIReader(),
+			http:    &http.Client{},
+		},
 	}
 
 	for _, ro := range o {
@@ -106,6 +198,19 @@ func NewReconciler(m ctrl.Manager, o ...ReconcilerOption) *Reconciler {
 }
 
 // Reconcile an OAM HealthScope by keeping track of its health status.
+// +kubebuilder:rbac:groups=core.oam.dev,resources=healthscopes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=healthscopes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=applicationconfigurations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=applicationconfigurations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=notificationsinks,verbs=get;list;watch
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=notificationsinks/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
 func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
 	log := r.log.WithValues("request", req)
 	log.Debug("Reconciling")
@@ -115,9 +220,18 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 
 	hs := &v1alpha2.HealthScope{}
 	if err := r.client.Get(ctx, req.NamespacedName, hs); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.namespaces.forget(req.NamespacedName)
+			r.metrics.forget(req.NamespacedName)
+			r.reports.forget(req.NamespacedName)
+			r.transitions.forget(req.NamespacedName)
+			r.propagateHealth(ctx, log, r.parents.forget(req.NamespacedName), nil)
+		}
 		return reconcile.Result{}, errors.Wrap(resource.IgnoreNotFound(err), errGetHealthScope)
 	}
 
+	r.namespaces.observe(req.NamespacedName)
+
 	interval := longWait
 	if hs.Spec.ProbeInterval != nil {
 		interval = time.Duration(*hs.Spec.ProbeInterval) * time.Second
@@ -131,18 +245,112 @@ func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error)
 
 	log = log.WithValues("uid", hs.GetUID(), "version", hs.GetResourceVersion())
 
-	if err := health.UpdateHealthStatus(ctx, log, r.client, hs); err != nil {
+	if err := r.watchWorkloads(hs); err != nil {
+		log.Debug("Cannot watch workloads, relying on the probe interval", "error", err)
+	}
+
+	h, err := r.health.evaluate(ctx, log, hs)
+	if err != nil {
+		r.metrics.observeFailure(req.NamespacedName, time.Since(start))
+		r.reports.observeFailure(req.NamespacedName, err, time.Now())
 		log.Debug("Could not update health status", "error", err, "requeue-after", time.Now().Add(shortWait))
 		r.record.Event(hs, event.Warning(reasonHealthCheckFailed, err))
 		hs.SetConditions(v1alpha1.ReconcileError(errors.Wrap(err, errUpdateHealthScopeStatus)))
 		return reconcile.Result{RequeueAfter: shortWait}, errors.Wrap(r.client.Status().Update(ctx, hs), errUpdateHealthScopeStatus)
 	}
 
-	log.Debug("Successfully ran health check", "scope", hs.Name)
-	r.record.Event(hs, event.Normal(reasonHealthCheck, "Successfully ran health check"))
+	now := time.Now()
+	elapsed := now.Sub(start)
+	r.metrics.observe(req.NamespacedName, h, elapsed)
+	r.reports.observe(req.NamespacedName, h, now)
+	tr := r.transitions.observe(req.NamespacedName, hs.Status.Health, h, now)
+	availability := r.recordHistory(ctx, log, hs, h.Status(), now)
+	hs.Status.Health = h.Status()
+
+	log.Debug("Successfully ran health check", "scope", hs.Name, "health", hs.Status.Health)
+	heartbeat, err := eventHeartbeat(hs.GetAnnotations())
+	if err != nil {
+		log.Debug("Ignoring invalid event heartbeat", "annotation", AnnotationEventHeartbeat, "error", err)
+	}
+	switch {
+	case tr.Changed():
+		r.recordTransition(hs, tr)
+		r.transitions.recorded(req.NamespacedName, now)
+		if tr.From != tr.To {
+			r.notify(ctx, log, hs.DeepCopy(), newNotification(req.NamespacedName, tr, now))
+		}
+	case r.transitions.heartbeatDue(req.NamespacedName, heartbeat, now):
+		r.record.Event(hs, event.Normal(reasonHealthCheck, tr.Message()))
+		r.transitions.recorded(req.NamespacedName, now)
+	}
+
+	// A health check that took longer than the interval is followed by
+	// another one right away.
+	requeueAfter := interval - elapsed
+	if requeueAfter <= 0 {
+		requeueAfter = time.Nanosecond
+	}
+
+	r.propagateHealth(ctx, log, r.parents.observe(req.NamespacedName, parentAppConfigs(hs, h)), hs)
+
+	hs.SetConditions(v1alpha1.ReconcileSuccess(), healthyCondition(h), availability)
+	if h.Selector {
+		hs.SetConditions(workloadsSelectedCondition(h.Selected))
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, errors.Wrap(r.client.Status().Update(ctx, hs), errUpdateHealthScopeStatus)
+}
+
+// recordHistory records the health of a scope in its health history and
+// returns the scope's availability. The history is patched into the scope's
+// annotations, so it must be recorded before the scope's status is changed.
+func (r *Reconciler) recordHistory(ctx context.Context, log logging.Logger, hs *v1alpha2.HealthScope, status string,
+	now time.Time) v1alpha1.Condition {
+	windows, err := parseAvailabilityWindows(hs.GetAnnotations())
+	if err != nil {
+		log.Debug("Ignoring invalid availability windows", "annotation", AnnotationAvailabilityWindows, "error", err)
+		windows, _ = parseAvailabilityWindows(nil)
+	}
+	hh, err := parseHealthHistory(hs.GetAnnotations()[AnnotationHealthHistory])
+	if err != nil {
+		log.Debug("Discarding invalid health history", "annotation", AnnotationHealthHistory, "error", err)
+		hh = nil
+	}
 
-	elapsed := time.Since(start)
+	hh = hh.record(status, now).compact(now, retention(windows), maxHistoryEntries)
+	if v := hh.String(); v != hs.GetAnnotations()[AnnotationHealthHistory] {
+		patch := client.MergeFrom(hs.DeepCopy())
+		meta.AddAnnotations(hs, map[string]string{AnnotationHealthHistory: v})
+		if err := r.client.Patch(ctx, hs, patch); err != nil {
+			log.Debug("Cannot record health history", "error", err)
+		}
+	}
+	return availabilityCondition(hh, windows, now, hs.GetCondition(TypeAvailability))
+}
 
-	hs.SetConditions(v1alpha1.ReconcileSuccess())
-	return reconcile.Result{RequeueAfter: interval - elapsed}, errors.Wrap(r.client.Status().Update(ctx, hs), errUpdateHealthScopeStatus)
+// notify queues the delivery of a change of the health of a scope to the
+// notification sinks selecting it. Deliveries are retried, so they do not
+// block the reconcile loop.
+func (r *Reconciler) notify(ctx context.Context, log logging.Logger, hs *v1alpha2.HealthScope, nt notification) {
+	failed := func(err error) {
+		log.Debug("Cannot deliver notification", "error", err)
+		r.record.Event(hs, event.Warning(reasonNotificationFailed, err))
+	}
+	if err := r.notifier.notify(ctx, log, hs, nt, failed); err != nil {
+		failed(err)
+	}
+}
+
+// recordTransition records an event describing how the health of a scope
+// changed. A scope that is unhealthy after the change records a warning.
+func (r *Reconciler) recordTransition(hs *v1alpha2.HealthScope, tr healthTransition) {
+	switch {
+	case tr.From != tr.To && tr.To == statusHealthy:
+		r.record.Event(hs, event.Normal(reasonHealthRecovered, tr.Message()))
+	case tr.From != tr.To:
+		r.record.Event(hs, event.Warning(reasonHealthDegraded, errors.New(tr.Message())))
+	case tr.To == statusHealthy:
+		r.record.Event(hs, event.Normal(reasonWorkloadHealthChanged, tr.Message()))
+	default:
+		r.record.Event(hs, event.Warning(reasonWorkloadHealthChanged, errors.New(tr.Message())))
+	}
 }
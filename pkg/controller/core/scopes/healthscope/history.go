@@ -0,0 +1,251 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// The health history is kept on the scope itself so that the availability
+// computed from it survives controller restarts.
+const (
+	// AnnotationHealthHistory is written by the controller. It holds the times
+	// the scope's health changed, e.g. "1590998400:H,1591002000:U", where H is
+	// healthy, U unhealthy and ? unknown.
+	AnnotationHealthHistory = "healthscope.extend.oam.dev/health-history"
+	// AnnotationAvailabilityWindows are the comma separated windows over which
+	// the availability of the scope is computed, e.g. "1h,24h,30d".
+	AnnotationAvailabilityWindows = "healthscope.extend.oam.dev/availability-windows"
+)
+
+// maxHistoryEntries bounds the size of the health history annotation. A
+// scope whose health changes more often than that loses the start of its
+// longest windows, the Availability condition then says which part of a
+// window its availability covers.
+const maxHistoryEntries = 200
+
+// defaultAvailabilityWindows are used unless a scope configures its own.
+const defaultAvailabilityWindows = "1h,24h,30d"
+
+// TypeAvailability reports the availability of a HealthScope over its
+// availability windows.
+const TypeAvailability v1alpha1.ConditionType = "Availability"
+
+// ReasonAvailabilityComputed indicates the availability of a scope was
+// computed from its health history.
+const ReasonAvailabilityComputed v1alpha1.ConditionReason = "AvailabilityComputed"
+
+// History error strings.
+const (
+	errInvalidHistoryEntry       = "invalid health history entry %q"
+	errInvalidAvailabilityWindow = "invalid availability window %q, must be a positive duration such as 30m, 24h or 30d"
+)
+
+var historyCodes = map[string]string{statusHealthy: "H", statusUnhealthy: "U", statusUnknown: "?"}
+
+// A healthChange records the health of a scope from a point in time on.
+type healthChange struct {
+	Time   time.Time
+	Status string
+}
+
+// A healthHistory is the chronological list of changes of a scope's health.
+// The last change lasts until now.
+type healthHistory []healthChange
+
+// parseHealthHistory decodes the supplied health history annotation.
+func parseHealthHistory(v string) (healthHistory, error) {
+	var hh healthHistory
+	for _, e := range strings.Split(v, ",") {
+		e = strings.TrimSpace(e)
+		if len(e) == 0 {
+			continue
+		}
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf(errInvalidHistoryEntry, e)
+		}
+		sec, err := strconv.ParseInt(kv[0], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf(errInvalidHistoryEntry, e)
+		}
+		status := ""
+		for s, code := range historyCodes {
+			if code == kv[1] {
+				status = s
+			}
+		}
+		if len(status) == 0 || (len(hh) > 0 && !hh[len(hh)-1].Time.Before(time.Unix(sec, 0))) {
+			return nil, errors.Errorf(errInvalidHistoryEntry, e)
+		}
+		hh = append(hh, healthChange{Time: time.Unix(sec, 0), Status: status})
+	}
+	return hh, nil
+}
+
+// String encodes the history for the health history annotation.
+func (hh healthHistory) String() string {
+	entries := make([]string, 0, len(hh))
+	for _, c := range hh {
+		entries = append(entries, fmt.Sprintf("%d:%s", c.Time.Unix(), historyCodes[c.Status]))
+	}
+	return strings.Join(entries, ",")
+}
+
+// record returns the history with the supplied health observed at the
+// supplied time. Only changes of the health are recorded.
+func (hh healthHistory) record(status string, now time.Time) healthHistory {
+	now = now.Truncate(time.Second)
+	if len(hh) > 0 && (hh[len(hh)-1].Status == status || !now.After(hh[len(hh)-1].Time)) {
+		return hh
+	}
+	return append(hh, healthChange{Time: now, Status: status})
+}
+
+// compact returns the history without the changes that ended more than
+// retention ago, keeping at most max changes. The change in effect retention
+// ago keeps the time it happened, so that a history that did not change
+// compacts to itself; availability only counts the part inside its window.
+func (hh healthHistory) compact(now time.Time, retention time.Duration, max int) healthHistory {
+	cutoff := now.Add(-retention).Truncate(time.Second)
+	first := 0
+	for i := 1; i < len(hh) && !hh[i].Time.After(cutoff); i++ {
+		first = i
+	}
+	compacted := append(healthHistory{}, hh[first:]...)
+	if len(compacted) > max {
+		compacted = compacted[len(compacted)-max:]
+	}
+	return compacted
+}
+
+// availability returns the fraction of the supplied window up to now that
+// the scope was healthy, and false if nothing is known about the window.
+// The time before the first recorded change is not part of the window.
+func (hh healthHistory) availability(now time.Time, window time.Duration) (float64, bool) {
+	start := now.Add(-window)
+	var observed, healthy time.Duration
+	for i, c := range hh {
+		from, to := c.Time, now
+		if i+1 < len(hh) {
+			to = hh[i+1].Time
+		}
+		if from.Before(start) {
+			from = start
+		}
+		if !to.After(from) {
+			continue
+		}
+		observed += to.Sub(from)
+		if c.Status == statusHealthy {
+			healthy += to.Sub(from)
+		}
+	}
+	if observed <= 0 {
+		return 0, false
+	}
+	return float64(healthy) / float64(observed), true
+}
+
+// An availabilityWindow is a named duration availability is computed over.
+type availabilityWindow struct {
+	Name     string
+	Duration time.Duration
+}
+
+// parseAvailabilityWindows returns the availability windows of a scope. In
+// addition to Go durations, whole days such as "30d" are accepted.
+func parseAvailabilityWindows(annotations map[string]string) ([]availabilityWindow, error) {
+	v := strings.TrimSpace(annotations[AnnotationAvailabilityWindows])
+	if len(v) == 0 {
+		v = defaultAvailabilityWindows
+	}
+	var windows []availabilityWindow
+	for _, w := range strings.Split(v, ",") {
+		w = strings.TrimSpace(w)
+		if len(w) == 0 {
+			continue
+		}
+		var d time.Duration
+		var err error
+		if days := strings.TrimSuffix(w, "d"); days != w {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(w)
+		}
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf(errInvalidAvailabilityWindow, w)
+		}
+		windows = append(windows, availabilityWindow{Name: w, Duration: d})
+	}
+	return windows, nil
+}
+
+// retention returns how long the history must be kept to cover every window.
+func retention(windows []availabilityWindow) time.Duration {
+	var r time.Duration
+	for _, w := range windows {
+		if w.Duration > r {
+			r = w.Duration
+		}
+	}
+	return r
+}
+
+// availabilityCondition reports the availability of a scope over each of
+// the supplied windows. The message changes on every reconcile, so the time
+// of the previous condition is kept unless its status changes.
+func availabilityCondition(hh healthHistory, windows []availabilityWindow, now time.Time,
+	previous v1alpha1.Condition) v1alpha1.Condition {
+	avail := make([]string, 0, len(windows))
+	for _, w := range windows {
+		a, ok := hh.availability(now, w.Duration)
+		if !ok {
+			avail = append(avail, w.Name+": n/a")
+			continue
+		}
+		// The history of a new scope, or one that was compacted to its
+		// size bound, does not cover the whole window.
+		if since := hh[0].Time; since.After(now.Add(-w.Duration)) {
+			avail = append(avail, fmt.Sprintf("%s: %.2f%% (since %s)", w.Name, a*100, since.UTC().Format(time.RFC3339)))
+			continue
+		}
+		avail = append(avail, fmt.Sprintf("%s: %.2f%%", w.Name, a*100))
+	}
+	c := v1alpha1.Condition{
+		Type:               TypeAvailability,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             ReasonAvailabilityComputed,
+		Message:            strings.Join(avail, ", "),
+	}
+	if previous.Type == c.Type && previous.Status == c.Status {
+		c.LastTransitionTime = previous.LastTransitionTime
+	}
+	return c
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("HealthScope health history", func() {
+	now := time.Unix(1591000000, 0)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	It("Test encode and decode the health history", func() {
+		hh := healthHistory{{Time: ago(2 * time.Hour), Status: statusHealthy}, {Time: ago(time.Hour), Status: statusUnknown}}
+		Expect(hh.String()).Should(Equal("1590992800:H,1590996400:?"))
+		parsed, err := parseHealthHistory(hh.String())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(parsed).Should(Equal(hh))
+
+		for _, invalid := range []string{"1590992800", "x:H", "1590992800:X", "1590996400:H,1590992800:U"} {
+			_, err := parseHealthHistory(invalid)
+			Expect(err).Should(HaveOccurred())
+		}
+	})
+
+	It("Test only record changes of the health", func() {
+		var hh healthHistory
+		hh = hh.record(statusHealthy, ago(time.Hour))
+		hh = hh.record(statusHealthy, ago(time.Minute))
+		Expect(hh).Should(HaveLen(1))
+		hh = hh.record(statusUnhealthy, now)
+		Expect(hh).Should(Equal(healthHistory{
+			{Time: ago(time.Hour), Status: statusHealthy},
+			{Time: now, Status: statusUnhealthy},
+		}))
+	})
+
+	It("Test compact the history to the retention and size bound", func() {
+		hh := healthHistory{
+			{Time: ago(5 * time.Hour), Status: statusHealthy},
+			{Time: ago(3 * time.Hour), Status: statusUnhealthy},
+			{Time: ago(time.Hour), Status: statusHealthy},
+		}
+		Expect(hh.compact(now, 2*time.Hour, 10)).Should(Equal(healthHistory{
+			{Time: ago(3 * time.Hour), Status: statusUnhealthy},
+			{Time: ago(time.Hour), Status: statusHealthy},
+		}))
+		Expect(hh.compact(now.Add(time.Minute), 2*time.Hour, 10)).Should(Equal(hh.compact(now, 2*time.Hour, 10)))
+		Expect(hh.compact(now, 24*time.Hour, 10)).Should(Equal(hh))
+		Expect(hh.compact(now, 24*time.Hour, 1)).Should(Equal(hh[2:]))
+	})
+
+	It("Test compute the availability over a window", func() {
+		hh := healthHistory{
+			{Time: ago(4 * time.Hour), Status: statusHealthy},
+			{Time: ago(time.Hour), Status: statusUnhealthy},
+			{Time: ago(30 * time.Minute), Status: statusHealthy},
+		}
+		a, ok := hh.availability(now, time.Hour)
+		Expect(ok).Should(BeTrue())
+		Expect(a).Should(Equal(0.5))
+		a, _ = hh.availability(now, 2*time.Hour)
+		Expect(a).Should(Equal(0.75))
+
+		// Only the four hours known about count towards a day.
+		a, _ = hh.availability(now, 24*time.Hour)
+		Expect(a).Should(Equal(0.875))
+
+		_, ok = healthHistory(nil).availability(now, time.Hour)
+		Expect(ok).Should(BeFalse())
+	})
+
+	It("Test report the availability over the configured windows", func() {
+		windows, err := parseAvailabilityWindows(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(windows).Should(Equal([]availabilityWindow{
+			{Name: "1h", Duration: time.Hour}, {Name: "24h", Duration: 24 * time.Hour}, {Name: "30d", Duration: 30 * 24 * time.Hour},
+		}))
+		Expect(retention(windows)).Should(Equal(30 * 24 * time.Hour))
+
+		windows, err = parseAvailabilityWindows(map[string]string{AnnotationAvailabilityWindows: "30m, 7d"})
+		Expect(err).ShouldNot(HaveOccurred())
+		hh := healthHistory{{Time: ago(time.Hour), Status: statusHealthy}, {Time: ago(15 * time.Minute), Status: statusUnhealthy}}
+		c := availabilityCondition(hh, windows, now, v1alpha1.Condition{})
+		Expect(c.Type).Should(Equal(TypeAvailability))
+		Expect(c.Status).Should(Equal(corev1.ConditionTrue))
+		// Only the last hour of the seven days is known about.
+		Expect(c.Message).Should(Equal("30m: 50.00%, 7d: 75.00% (since 2020-06-01T07:26:40Z)"))
+		Expect(c.LastTransitionTime).Should(Equal(metav1.NewTime(now)))
+		Expect(availabilityCondition(nil, windows, now, v1alpha1.Condition{}).Message).Should(Equal("30m: n/a, 7d: n/a"))
+
+		// A new availability is not a transition of the condition.
+		later := availabilityCondition(hh, windows, now.Add(time.Minute), c)
+		Expect(later.Message).ShouldNot(Equal(c.Message))
+		Expect(later.LastTransitionTime).Should(Equal(c.LastTransitionTime))
+
+		for _, invalid := range []string{"0h", "-1h", "xd", "1w"} {
+			_, err := parseAvailabilityWindows(map[string]string{AnnotationAvailabilityWindows: invalid})
+			Expect(err).Should(HaveOccurred())
+		}
+	})
+
+	It("Test recording an unchanged health past the retention does not write the history again", func() {
+		patches := 0
+		r := &Reconciler{client: &test.MockClient{MockPatch: func(_ context.Context, _ runtime.Object, _ client.Patch,
+			_ ...client.PatchOption) error {
+			patches++
+			return nil
+		}}}
+		hs := &v1alpha2.HealthScope{ObjectMeta: metav1.ObjectMeta{Name: "scope", Annotations: map[string]string{
+			AnnotationAvailabilityWindows: "1h",
+			AnnotationHealthHistory:       healthHistory{{Time: ago(5 * time.Hour), Status: statusHealthy}, {Time: ago(3 * time.Hour), Status: statusUnhealthy}}.String(),
+		}}}
+
+		c := r.recordHistory(context.Background(), logging.NewNopLogger(), hs, statusUnhealthy, now)
+		Expect(c.Message).Should(Equal("1h: 0.00%"))
+		Expect(patches).Should(Equal(1))
+		Expect(hs.GetAnnotations()[AnnotationHealthHistory]).Should(Equal(healthHistory{{Time: ago(3 * time.Hour), Status: statusUnhealthy}}.String()))
+
+		c = r.recordHistory(context.Background(), logging.NewNopLogger(), hs, statusUnhealthy, now.Add(time.Minute))
+		Expect(c.Message).Should(Equal("1h: 0.00%"))
+		Expect(patches).Should(Equal(1))
+	})
+
+	It("Test the history a scope records does not trigger another health check", func() {
+		old := &metav1.ObjectMeta{Name: "scope", Generation: 1, Annotations: map[string]string{AnnotationHealthHistory: "1:H"}}
+		recorded := old.DeepCopy()
+		recorded.Annotations[AnnotationHealthHistory] = "1:H,2:U"
+		configured := old.DeepCopy()
+		configured.Annotations[AnnotationAggregationPolicy] = PolicyMajority
+
+		p := scopeChangedPredicate()
+		Expect(p.Update(ctrlevent.UpdateEvent{MetaOld: old, MetaNew: recorded})).Should(BeFalse())
+		Expect(p.Update(ctrlevent.UpdateEvent{MetaOld: old, MetaNew: configured})).Should(BeTrue())
+	})
+})
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+)
+
+// Workloads that belong to a scope because of their labels, in addition to
+// the ones its spec references.
+const (
+	// AnnotationWorkloadSelector selects the workloads in the scope's namespace with a label selector, e.g. "app=shop"
+	AnnotationWorkloadSelector = "healthscope.extend.oam.dev/workload-selector"
+	// AnnotationWorkloadKinds are the comma separated kinds of workloads the selector applies to, e.g.
+	// "ContainerizedWorkload.v1alpha2.core.oam.dev,Deployment.v1.apps". Only ContainerizedWorkloads by default.
+	AnnotationWorkloadKinds = "healthscope.extend.oam.dev/workload-kinds"
+)
+
+// TypeWorkloadsSelected indicates which workloads the workload selector of a
+// HealthScope resolved to.
+const TypeWorkloadsSelected v1alpha1.ConditionType = "WorkloadsSelected"
+
+// Reasons a HealthScope's workload selector did or did not select workloads.
+const (
+	ReasonWorkloadsSelected   v1alpha1.ConditionReason = "WorkloadsSelected"
+	ReasonNoWorkloadsSelected v1alpha1.ConditionReason = "NoWorkloadsSelected"
+)
+
+// Membership error strings.
+const (
+	errInvalidWorkloadSelector = "invalid workload selector"
+	errInvalidWorkloadKind     = "invalid workload kind %q, must be <kind>.<version>.<group>"
+	errListWorkloads           = "could not list workloads of kind %q"
+)
+
+// A workloadSelector selects the workloads of some kinds by their labels.
+type workloadSelector struct {
+	labels labels.Selector
+	kinds  []schema.GroupVersionKind
+}
+
+// parseWorkloadSelector builds the selector from the scope annotations. A nil
+// selector selects no workloads.
+func parseWorkloadSelector(annotations map[string]string) (*workloadSelector, error) {
+	sel := strings.TrimSpace(annotations[AnnotationWorkloadSelector])
+	if len(sel) == 0 {
+		return nil, nil
+	}
+	ls, err := labels.Parse(sel)
+	if err != nil {
+		return nil, errors.Wrap(err, errInvalidWorkloadSelector)
+	}
+	kinds, err := parseWorkloadKinds(annotations[AnnotationWorkloadKinds])
+	if err != nil {
+		return nil, err
+	}
+	return &workloadSelector{labels: ls, kinds: kinds}, nil
+}
+
+// parseWorkloadKinds returns the comma separated kinds of v, only
+// ContainerizedWorkloads if it is empty.
+func parseWorkloadKinds(v string) ([]schema.GroupVersionKind, error) {
+	var kinds []schema.GroupVersionKind
+	for _, k := range strings.Split(v, ",") {
+		k = strings.TrimSpace(k)
+		if len(k) == 0 {
+			continue
+		}
+		gvk, _ := schema.ParseKindArg(k)
+		if gvk == nil {
+			// A core kind, e.g. "Pod.v1", has no group.
+			if s := strings.Split(k, "."); len(s) == 2 && len(s[0]) != 0 && len(s[1]) != 0 {
+				gvk = &schema.GroupVersionKind{Version: s[1], Kind: s[0]}
+			} else {
+				return nil, errors.Errorf(errInvalidWorkloadKind, k)
+			}
+		}
+		kinds = append(kinds, *gvk)
+	}
+	if len(kinds) == 0 {
+		kinds = []schema.GroupVersionKind{v1alpha2.ContainerizedWorkloadGroupVersionKind}
+	}
+	return kinds, nil
+}
+
+// matches returns true if a workload of the supplied kind and labels is
+// selected. Kinds match regardless of their version.
+func (ws *workloadSelector) matches(gvk schema.GroupVersionKind, l map[string]string) bool {
+	for _, k := range ws.kinds {
+		if k.GroupKind() == gvk.GroupKind() {
+			return ws.labels.Matches(labels.Set(l))
+		}
+	}
+	return false
+}
+
+// selectWorkloads lists the workloads in the namespace that match the selector.
+func (ws *workloadSelector) selectWorkloads(ctx context.Context, c client.Reader, namespace string) ([]v1alpha1.TypedReference, error) {
+	var selected []v1alpha1.TypedReference
+	for _, gvk := range ws.kinds {
+		l := &unstructured.UnstructuredList{}
+		l.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := c.List(ctx, l, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: ws.labels}); err != nil {
+			return nil, errors.Wrapf(err, errListWorkloads, gvk.String())
+		}
+		for _, wl := range l.Items {
+			selected = append(selected, v1alpha1.TypedReference{
+				APIVersion: gvk.GroupVersion().String(),
+				Kind:       gvk.Kind,
+				Name:       wl.GetName(),
+				UID:        wl.GetUID(),
+			})
+		}
+	}
+	return selected, nil
+}
+
+// members returns the workloads the scope references followed by the ones
+// its selector resolves to that it does not reference already.
+func members(refs, selected []v1alpha1.TypedReference) []v1alpha1.TypedReference {
+	all := make([]v1alpha1.TypedReference, 0, len(refs)+len(selected))
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		seen[indexKey(ref.APIVersion, ref.Kind, ref.Name)] = true
+		all = append(all, ref)
+	}
+	for _, ref := range selected {
+		if !seen[indexKey(ref.APIVersion, ref.Kind, ref.Name)] {
+			all = append(all, ref)
+		}
+	}
+	return all
+}
+
+// workloadsSelectedCondition lists the workloads a scope's selector resolved to.
+func workloadsSelectedCondition(selected []v1alpha1.TypedReference) v1alpha1.Condition {
+	names := make([]string, 0, len(selected))
+	for _, ref := range selected {
+		names = append(names, fmt.Sprintf("%s %s", ref.Kind, ref.Name))
+	}
+	c := v1alpha1.Condition{
+		Type:               TypeWorkloadsSelected,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonWorkloadsSelected,
+		Message:            fmt.Sprintf("selected: [%s]", strings.Join(names, ", ")),
+	}
+	if len(selected) == 0 {
+		c.Status = corev1.ConditionFalse
+		c.Reason = ReasonNoWorkloadsSelected
+	}
+	return c
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("HealthScope workload selector", func() {
+	deploy := v1alpha1.TypedReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"}
+	wlRef := func(name string) v1alpha1.TypedReference {
+		return v1alpha1.TypedReference{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.ContainerizedWorkloadKind,
+			Name:       name,
+		}
+	}
+	selector := func(annotations map[string]string) *workloadSelector {
+		ws, err := parseWorkloadSelector(annotations)
+		Expect(err).ShouldNot(HaveOccurred())
+		return ws
+	}
+
+	It("Test parse the workload selector annotations", func() {
+		Expect(selector(nil)).Should(BeNil())
+
+		ws := selector(map[string]string{AnnotationWorkloadSelector: "app=shop,tier!=batch"})
+		Expect(ws.kinds).Should(Equal([]schema.GroupVersionKind{v1alpha2.ContainerizedWorkloadGroupVersionKind}))
+
+		ws = selector(map[string]string{
+			AnnotationWorkloadSelector: "app=shop",
+			AnnotationWorkloadKinds:    "Deployment.v1.apps, Pod.v1",
+		})
+		Expect(ws.kinds).Should(Equal([]schema.GroupVersionKind{
+			{Group: "apps", Version: "v1", Kind: "Deployment"},
+			{Version: "v1", Kind: "Pod"},
+		}))
+
+		_, err := parseWorkloadSelector(map[string]string{AnnotationWorkloadSelector: "app in shop"})
+		Expect(err).Should(HaveOccurred())
+		_, err = parseWorkloadSelector(map[string]string{AnnotationWorkloadSelector: "app=shop", AnnotationWorkloadKinds: "Deployment"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Test match workloads by kind and labels", func() {
+		ws := selector(map[string]string{AnnotationWorkloadSelector: "app=shop"})
+		shop := map[string]string{"app": "shop"}
+		Expect(ws.matches(v1alpha2.ContainerizedWorkloadGroupVersionKind, shop)).Should(BeTrue())
+		Expect(ws.matches(v1alpha2.SchemeGroupVersion.WithKind("TrafficRoutingTrait"), shop)).Should(BeFalse())
+		Expect(ws.matches(v1alpha2.ContainerizedWorkloadGroupVersionKind, map[string]string{"app": "blog"})).Should(BeFalse())
+	})
+
+	It("Test members are the referenced workloads followed by the selected ones", func() {
+		Expect(members([]v1alpha1.TypedReference{wlRef("api")}, []v1alpha1.TypedReference{wlRef("web"), wlRef("api")})).
+			Should(Equal([]v1alpha1.TypedReference{wlRef("api"), wlRef("web")}))
+	})
+
+	It("Test evaluate the workloads selected when the scope is checked", func() {
+		c := healthClient(map[string]*unstructured.Unstructured{"app": fakeWorkload("app", deploy)},
+			map[string]*apps.Deployment{"web": {Status: apps.DeploymentStatus{ReadyReplicas: 1}}})
+		c.(*test.MockClient).MockList = func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			if lo.LabelSelector.Matches(labels.Set{"app": "shop"}) {
+				list.(*unstructured.UnstructuredList).Items = []unstructured.Unstructured{*fakeWorkload("app")}
+			}
+			return nil
+		}
+		hs := &v1alpha2.HealthScope{ObjectMeta: metav1.ObjectMeta{
+			Name:        "scope",
+			Namespace:   "default",
+			Annotations: map[string]string{AnnotationWorkloadSelector: "app=shop"},
+		}}
+		h, err := evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), hs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeTrue())
+		Expect(h.Selected).Should(Equal([]v1alpha1.TypedReference{wlRef("app")}))
+		Expect(h.Workloads).Should(Equal([]workloadHealth{{Reference: wlRef("app"), Healthy: true}}))
+
+		cond := workloadsSelectedCondition(h.Selected)
+		Expect(cond.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(cond.Message).Should(Equal("selected: [ContainerizedWorkload app]"))
+
+		hs.Annotations[AnnotationWorkloadSelector] = "app=blog"
+		h, err = evaluator(c).evaluate(context.Background(), logging.NewNopLogger(), hs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Selected).Should(BeEmpty())
+		Expect(workloadsSelectedCondition(h.Selected).Reason).Should(Equal(ReasonNoWorkloadsSelected))
+	})
+})
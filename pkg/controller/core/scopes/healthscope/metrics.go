@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Metric names and labels of the HealthScope metrics.
+const (
+	metricsNamespace = "oam"
+	metricsSubsystem = "healthscope"
+
+	labelNamespace = "namespace"
+	labelScope     = "scope"
+	labelKind      = "kind"
+	labelWorkload  = "workload"
+)
+
+// defaultMetrics are served by the controller manager's metrics endpoint.
+var defaultMetrics = newHealthMetrics()
+
+func init() {
+	metrics.Registry.MustRegister(defaultMetrics.collectors()...)
+}
+
+// healthMetrics records the outcome of HealthScope health checks.
+type healthMetrics struct {
+	scopeHealthy    *prometheus.GaugeVec
+	workloadHealthy *prometheus.GaugeVec
+	checkDuration   *prometheus.HistogramVec
+	checkFailures   *prometheus.CounterVec
+
+	// workloads tracks the workload series exported for each scope so they
+	// can be deleted once a workload leaves the scope or the scope is deleted.
+	mu        sync.Mutex
+	workloads map[types.NamespacedName][]prometheus.Labels
+}
+
+func newHealthMetrics() *healthMetrics {
+	return &healthMetrics{
+		scopeHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "healthy",
+			Help:      "Whether a HealthScope is healthy (1) or not (0)",
+		}, []string{labelNamespace, labelScope}),
+		workloadHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "workload_healthy",
+			Help:      "Whether a workload referenced by a HealthScope is healthy (1), unhealthy (0) or unknown (-1)",
+		}, []string{labelNamespace, labelScope, labelKind, labelWorkload}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "check_duration_seconds",
+			Help:      "How long in seconds a HealthScope health check takes",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{labelNamespace, labelScope}),
+		checkFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "check_failures_total",
+			Help:      "Total number of HealthScope health checks that could not be completed",
+		}, []string{labelNamespace, labelScope}),
+		workloads: make(map[types.NamespacedName][]prometheus.Labels),
+	}
+}
+
+func (m *healthMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.scopeHealthy, m.workloadHealthy, m.checkDuration, m.checkFailures}
+}
+
+// observe records a completed health check of the named scope.
+func (m *healthMetrics) observe(nn types.NamespacedName, h scopeHealth, elapsed time.Duration) {
+	m.checkDuration.WithLabelValues(nn.Namespace, nn.Name).Observe(elapsed.Seconds())
+	m.scopeHealthy.WithLabelValues(nn.Namespace, nn.Name).Set(boolToFloat(h.Healthy))
+
+	current := make([]prometheus.Labels, 0, len(h.Workloads))
+	for _, w := range h.Workloads {
+		l := prometheus.Labels{
+			labelNamespace: nn.Namespace,
+			labelScope:     nn.Name,
+			labelKind:      w.Reference.Kind,
+			labelWorkload:  w.Reference.Name,
+		}
+		v := boolToFloat(w.Healthy)
+		if w.Unknown {
+			v = -1
+		}
+		m.workloadHealthy.With(l).Set(v)
+		current = append(current, l)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.workloads[nn] {
+		if !containsLabels(current, l) {
+			m.workloadHealthy.Delete(l)
+		}
+	}
+	m.workloads[nn] = current
+}
+
+// observeFailure records a health check of the named scope that could not be
+// completed. The scope is reported as unhealthy.
+func (m *healthMetrics) observeFailure(nn types.NamespacedName, elapsed time.Duration) {
+	m.checkDuration.WithLabelValues(nn.Namespace, nn.Name).Observe(elapsed.Seconds())
+	m.checkFailures.WithLabelValues(nn.Namespace, nn.Name).Inc()
+	m.scopeHealthy.WithLabelValues(nn.Namespace, nn.Name).Set(0)
+}
+
+// forget deletes every series of the named scope, e.g. once it was deleted.
+func (m *healthMetrics) forget(nn types.NamespacedName) {
+	m.scopeHealthy.DeleteLabelValues(nn.Namespace, nn.Name)
+	m.checkDuration.DeleteLabelValues(nn.Namespace, nn.Name)
+	m.checkFailures.DeleteLabelValues(nn.Namespace, nn.Name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.workloads[nn] {
+		m.workloadHealthy.Delete(l)
+	}
+	delete(m.workloads, nn)
+}
+
+func containsLabels(all []prometheus.Labels, l prometheus.Labels) bool {
+	for _, o := range all {
+		if o[labelKind] == l[labelKind] && o[labelWorkload] == l[labelWorkload] {
+			return true
+		}
+	}
+	return false
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
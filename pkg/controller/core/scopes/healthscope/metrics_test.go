@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("HealthScope metrics", func() {
+	nn := types.NamespacedName{Namespace: "default", Name: "scope"}
+	workload := func(name string, healthy bool) workloadHealth {
+		return workloadHealth{
+			Reference: v1alpha1.TypedReference{Kind: "ContainerizedWorkload", Name: name},
+			Healthy:   healthy,
+		}
+	}
+	series := func(c prometheus.Collector) int {
+		ch := make(chan prometheus.Metric, 16)
+		c.Collect(ch)
+		close(ch)
+		return len(ch)
+	}
+
+	It("Test record scope and workload health", func() {
+		m := newHealthMetrics()
+		m.observe(nn, scopeHealth{Healthy: false, Workloads: []workloadHealth{
+			workload("app", true), workload("worker", false),
+		}}, time.Second)
+
+		Expect(testutil.ToFloat64(m.scopeHealthy.WithLabelValues("default", "scope"))).Should(Equal(float64(0)))
+		Expect(testutil.ToFloat64(m.workloadHealthy.WithLabelValues("default", "scope",
+			"ContainerizedWorkload", "app"))).Should(Equal(float64(1)))
+		Expect(testutil.ToFloat64(m.workloadHealthy.WithLabelValues("default", "scope",
+			"ContainerizedWorkload", "worker"))).Should(Equal(float64(0)))
+		Expect(series(m.checkDuration)).Should(Equal(1))
+	})
+
+	It("Test delete series of workloads that left the scope", func() {
+		m := newHealthMetrics()
+		m.observe(nn, scopeHealth{Healthy: true, Workloads: []workloadHealth{
+			workload("app", true), workload("worker", true),
+		}}, time.Second)
+		m.observe(nn, scopeHealth{Healthy: true, Workloads: []workloadHealth{workload("app", true)}}, time.Second)
+		Expect(series(m.workloadHealthy)).Should(Equal(1))
+	})
+
+	It("Test count failed health checks", func() {
+		m := newHealthMetrics()
+		m.observe(nn, scopeHealth{Healthy: true}, time.Second)
+		m.observeFailure(nn, time.Second)
+		m.observeFailure(nn, time.Second)
+		Expect(testutil.ToFloat64(m.checkFailures.WithLabelValues("default", "scope"))).Should(Equal(float64(2)))
+		Expect(testutil.ToFloat64(m.scopeHealthy.WithLabelValues("default", "scope"))).Should(Equal(float64(0)))
+	})
+
+	It("Test forget every series of a deleted scope", func() {
+		m := newHealthMetrics()
+		m.observe(nn, scopeHealth{Healthy: true, Workloads: []workloadHealth{workload("app", true)}}, time.Second)
+		m.observeFailure(nn, time.Second)
+		m.forget(nn)
+		for _, c := range m.collectors() {
+			Expect(series(c)).Should(Equal(0))
+		}
+	})
+})
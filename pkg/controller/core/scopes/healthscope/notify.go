@@ -0,0 +1,422 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+// HeaderSignature carries the hex encoded HMAC-SHA256 signature of the body
+// of a notification, e.g. "sha256=5d41402abc4b2a76b9719d911017c592".
+const HeaderSignature = "X-OAM-Signature"
+
+const (
+	defaultNotificationRetries = 3
+	defaultNotificationBackoff = time.Second
+	defaultNotificationTimeout = 10 * time.Second
+	maxNotificationBackoff     = time.Minute
+
+	// notifyTimeout bounds the delivery of a notification to a sink,
+	// including retries.
+	notifyTimeout = 10 * time.Minute
+)
+
+// Notification error strings.
+const (
+	errListSinks           = "cannot list notification sinks"
+	errRenderBody          = "cannot render notification body"
+	errInvalidBody         = "notification body template did not render JSON"
+	errGetSigningSecret    = "cannot get signing secret"
+	errMissingSigningKey   = "signing secret has no key %q"
+	errDeliveryStatus      = "notification rejected with status %d"
+	errUpdateSinkStatus    = "cannot update notification sink status"
+	errDeliverNotification = "cannot deliver notification to sink %q: %s"
+)
+
+// A notification describes a change of the health of a HealthScope.
+type notification struct {
+	Namespace string                 `json:"namespace"`
+	Scope     string                 `json:"scope"`
+	From      string                 `json:"from"`
+	To        string                 `json:"to"`
+	Message   string                 `json:"message"`
+	Time      string                 `json:"time"`
+	Workloads []notificationWorkload `json:"workloads,omitempty"`
+}
+
+// A notificationWorkload is a workload whose health changed.
+type notificationWorkload struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func newNotification(nn types.NamespacedName, tr healthTransition, now time.Time) notification {
+	n := notification{
+		Namespace: nn.Namespace,
+		Scope:     nn.Name,
+		From:      orUnknown(tr.From),
+		To:        tr.To,
+		Message:   tr.Message(),
+		Time:      now.UTC().Format(time.RFC3339),
+	}
+	for _, w := range tr.Workloads {
+		n.Workloads = append(n.Workloads, notificationWorkload{Kind: w.Reference.Kind, Name: w.Reference.Name, From: w.From, To: w.To})
+	}
+	return n
+}
+
+// A notifier delivers the health transitions of HealthScopes to the
+// NotificationSinks selecting them.
+type notifier struct {
+	client  client.Client
+	secrets client.Reader
+	http    *http.Client
+	queue   deliveryQueue
+}
+
+// notify queues the delivery of the notification to every sink selecting the
+// supplied scope. The notifications of a scope are delivered to each sink one
+// after another, in the order they were queued, so a sink never learns about
+// a recovery before the failure it follows. The supplied function is called
+// for every delivery that did not succeed.
+func (n *notifier) notify(ctx context.Context, log logging.Logger, hs *v1alpha2.HealthScope, nt notification,
+	failed func(error)) error {
+	sinks, err := n.sinksFor(ctx, hs)
+	if err != nil {
+		return err
+	}
+	for i := range sinks {
+		sink := &sinks[i]
+		k := deliveryKey{Namespace: hs.GetNamespace(), Scope: hs.GetName(), Sink: sink.GetName()}
+		n.queue.enqueue(k, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.notifySink(ctx, log, sink, nt); err != nil {
+				failed(err)
+			}
+		})
+	}
+	return nil
+}
+
+// notifySink delivers the notification to the sink and records the outcome
+// in the sink's status. It returns an error if the notification could not be
+// delivered.
+func (n *notifier) notifySink(ctx context.Context, log logging.Logger, sink *extendv1alpha1.NotificationSink,
+	nt notification) error {
+	d := n.deliver(ctx, sink, nt)
+	if err := n.recordDelivery(ctx, sink, d); err != nil {
+		log.Info("Cannot record notification delivery", "sink", sink.GetName(), "error", err)
+	}
+	if !d.Succeeded {
+		return errors.Errorf(errDeliverNotification, sink.GetName(), d.Error)
+	}
+	return nil
+}
+
+// A deliveryKey identifies the deliveries of the notifications of a scope to
+// a sink.
+type deliveryKey struct {
+	Namespace string
+	Scope     string
+	Sink      string
+}
+
+// A deliveryQueue runs the deliveries of a key one after another, in the
+// order they were queued. Deliveries of different keys run concurrently.
+type deliveryQueue struct {
+	mu      sync.Mutex
+	pending map[deliveryKey][]func()
+}
+
+// enqueue queues a delivery, starting a worker for its key unless one is
+// already running.
+func (q *deliveryQueue) enqueue(k deliveryKey, deliver func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = make(map[deliveryKey][]func())
+	}
+	if queued, running := q.pending[k]; running {
+		q.pending[k] = append(queued, deliver)
+		return
+	}
+	q.pending[k] = nil
+	go q.work(k, deliver)
+}
+
+// work runs the deliveries of a key until none are queued.
+func (q *deliveryQueue) work(k deliveryKey, deliver func()) {
+	for deliver != nil {
+		deliver()
+		deliver = q.next(k)
+	}
+}
+
+// next returns the next delivery of a key, or nil once none are queued and
+// the worker of the key stops.
+func (q *deliveryQueue) next(k deliveryKey) func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := q.pending[k]
+	if len(queued) == 0 {
+		delete(q.pending, k)
+		return nil
+	}
+	q.pending[k] = queued[1:]
+	return queued[0]
+}
+
+// sinksFor returns the sinks in the namespace of the scope whose scope
+// selector matches it.
+func (n *notifier) sinksFor(ctx context.Context, hs *v1alpha2.HealthScope) ([]extendv1alpha1.NotificationSink, error) {
+	l := &extendv1alpha1.NotificationSinkList{}
+	if err := n.client.List(ctx, l, client.InNamespace(hs.GetNamespace())); err != nil {
+		return nil, errors.Wrap(err, errListSinks)
+	}
+	sinks := make([]extendv1alpha1.NotificationSink, 0, len(l.Items))
+	for _, s := range l.Items {
+		if s.Spec.ScopeSelector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(s.Spec.ScopeSelector)
+			if err != nil || !sel.Matches(labels.Set(hs.GetLabels())) {
+				continue
+			}
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// deliver POSTs the notification to the sink, retrying with exponential
+// backoff on connection errors, 429 and 5xx responses.
+func (n *notifier) deliver(ctx context.Context, sink *extendv1alpha1.NotificationSink, nt notification) extendv1alpha1.NotificationDelivery {
+	d := extendv1alpha1.NotificationDelivery{Scope: nt.Scope, Transition: nt.From + " -> " + nt.To}
+	fail := func(err error) extendv1alpha1.NotificationDelivery {
+		d.Error = err.Error()
+		d.Time = metav1.Now()
+		return d
+	}
+
+	body, err := renderBody(sink.Spec.BodyTemplate, nt)
+	if err != nil {
+		return fail(err)
+	}
+	signature, err := n.sign(ctx, sink, body)
+	if err != nil {
+		return fail(err)
+	}
+
+	retries, backoff, timeout := notificationRetries(sink.Spec)
+	for {
+		d.Attempts++
+		code, err := n.post(ctx, sink, body, signature, timeout)
+		d.StatusCode = int32(code)
+		if err == nil {
+			d.Succeeded = true
+			d.Error = ""
+			d.Time = metav1.Now()
+			return d
+		}
+		d.Error = err.Error()
+		if !retryable(code) || int(d.Attempts) > retries {
+			return fail(err)
+		}
+		select {
+		case <-ctx.Done():
+			return fail(err)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxNotificationBackoff {
+			backoff = maxNotificationBackoff
+		}
+	}
+}
+
+// post sends a single notification request, returning the status code of the
+// response, or zero if none was received.
+func (n *notifier) post(ctx context.Context, sink *extendv1alpha1.NotificationSink, body []byte, signature string,
+	timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, sink.Spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "oam-healthscope-notifier")
+	for k, v := range sink.Spec.Headers {
+		req.Header.Set(k, v)
+	}
+	if signature != "" {
+		req.Header.Set(HeaderSignature, signature)
+	}
+
+	rsp, err := n.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16))
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return rsp.StatusCode, errors.Errorf(errDeliveryStatus, rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
+
+// sign returns the signature of the body using the sink's signing secret, or
+// an empty signature if the sink has none.
+func (n *notifier) sign(ctx context.Context, sink *extendv1alpha1.NotificationSink, body []byte) (string, error) {
+	ref := sink.Spec.SigningSecretRef
+	if ref == nil {
+		return "", nil
+	}
+	optional := ref.Optional != nil && *ref.Optional
+	s := &corev1.Secret{}
+	if err := n.secrets.Get(ctx, types.NamespacedName{Namespace: sink.GetNamespace(), Name: ref.Name}, s); err != nil {
+		if optional && apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, errGetSigningSecret)
+	}
+	key, ok := s.Data[ref.Key]
+	if !ok {
+		if optional {
+			return "", nil
+		}
+		return "", errors.Errorf(errMissingSigningKey, ref.Key)
+	}
+	return signature(key, body), nil
+}
+
+// recordDelivery records the outcome of a delivery in the sink's status. The
+// sink is read again before its status is updated, since the delivery may
+// have taken long enough for the sink to change, and other scopes deliver to
+// the same sink concurrently.
+func (n *notifier) recordDelivery(ctx context.Context, sink *extendv1alpha1.NotificationSink, d extendv1alpha1.NotificationDelivery) error {
+	nn := types.NamespacedName{Namespace: sink.GetNamespace(), Name: sink.GetName()}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := n.client.Get(ctx, nn, sink); err != nil {
+			return err
+		}
+		sink.Status.LastDelivery = d.DeepCopy()
+		if d.Succeeded {
+			sink.Status.LastSuccessfulDeliveryTime = d.Time.DeepCopy()
+			sink.Status.FailedDeliveries = 0
+			sink.SetConditions(v1alpha1.ReconcileSuccess())
+		} else {
+			sink.Status.FailedDeliveries++
+			sink.SetConditions(v1alpha1.ReconcileError(errors.New(d.Error)))
+		}
+		return n.client.Status().Update(ctx, sink)
+	})
+	return errors.Wrap(err, errUpdateSinkStatus)
+}
+
+// renderBody renders the notification with the supplied template, or as is
+// if the template is empty. The body must be JSON.
+func renderBody(tmpl string, nt notification) ([]byte, error) {
+	if tmpl == "" {
+		return marshalJSON(nt)
+	}
+	t, err := template.New("body").Funcs(template.FuncMap{"json": toJSON}).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, errRenderBody)
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, nt); err != nil {
+		return nil, errors.Wrap(err, errRenderBody)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New(errInvalidBody)
+	}
+	return buf.Bytes(), nil
+}
+
+// toJSON encodes a template value as JSON, e.g. to quote a string.
+func toJSON(v interface{}) (string, error) {
+	b, err := marshalJSON(v)
+	return string(b), err
+}
+
+// marshalJSON encodes a value as JSON without escaping HTML, which would make
+// messages such as "healthy -> unhealthy" hard to read in chat tools.
+func marshalJSON(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// signature returns the HMAC-SHA256 signature of the body.
+func signature(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func notificationRetries(spec extendv1alpha1.NotificationSinkSpec) (int, time.Duration, time.Duration) {
+	retries, backoff, timeout := defaultNotificationRetries, defaultNotificationBackoff, defaultNotificationTimeout
+	if spec.MaxRetries != nil && *spec.MaxRetries >= 0 {
+		retries = int(*spec.MaxRetries)
+	}
+	if spec.Backoff != nil && spec.Backoff.Duration > 0 {
+		backoff = spec.Backoff.Duration
+	}
+	if spec.Timeout != nil && spec.Timeout.Duration > 0 {
+		timeout = spec.Timeout.Duration
+	}
+	return retries, backoff, timeout
+}
+
+// retryable returns true if a request that failed with the supplied status
+// code, or zero if no response was received, may succeed later.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+// receiver is a local HTTP receiver of notifications. It responds to each
+// request with the next of its status codes, and 200 once they ran out.
+type receiver struct {
+	mu       sync.Mutex
+	codes    []int
+	bodies   []string
+	headers  []http.Header
+	requests int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header)
+	code := http.StatusOK
+	if len(r.codes) > 0 {
+		code, r.codes = r.codes[0], r.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+var _ = Describe("HealthScope notifications", func() {
+	nn := types.NamespacedName{Namespace: "default", Name: "scope"}
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	tr := healthTransition{From: statusHealthy, To: statusUnhealthy, Workloads: []workloadTransition{{
+		Reference: v1alpha1.TypedReference{Kind: "ContainerizedWorkload", Name: "web"}, From: statusHealthy, To: statusUnhealthy,
+	}}}
+	nt := newNotification(nn, tr, now)
+	secret := &corev1.Secret{Data: map[string][]byte{"key": []byte("s3cr3t")}}
+	retries := func(n int32) *int32 { return &n }
+	backoff := &metav1.Duration{Duration: time.Millisecond}
+
+	var rcv *receiver
+	var srv *httptest.Server
+	var n *notifier
+	BeforeEach(func() {
+		rcv = &receiver{}
+		srv = httptest.NewServer(rcv)
+		c := test.NewMockClient()
+		c.MockGet = func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			if s, ok := obj.(*corev1.Secret); ok && key.Name == "signing" {
+				secret.DeepCopyInto(s)
+				return nil
+			}
+			return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+		}
+		n = &notifier{client: c, secrets: c, http: srv.Client()}
+	})
+	AfterEach(func() {
+		srv.Close()
+	})
+	sink := func(spec extendv1alpha1.NotificationSinkSpec) *extendv1alpha1.NotificationSink {
+		spec.URL = srv.URL
+		if spec.Backoff == nil {
+			spec.Backoff = backoff
+		}
+		return &extendv1alpha1.NotificationSink{
+			ObjectMeta: metav1.ObjectMeta{Name: "chatops", Namespace: "default"},
+			Spec:       spec,
+		}
+	}
+
+	It("Test deliver the notification as is by default", func() {
+		d := n.deliver(context.Background(), sink(extendv1alpha1.NotificationSinkSpec{}), nt)
+		Expect(d.Succeeded).Should(BeTrue())
+		Expect(d.Attempts).Should(Equal(int32(1)))
+		Expect(d.StatusCode).Should(Equal(int32(http.StatusOK)))
+		Expect(d.Transition).Should(Equal("healthy -> unhealthy"))
+
+		var got notification
+		Expect(json.Unmarshal([]byte(rcv.bodies[0]), &got)).Should(Succeed())
+		Expect(got).Should(Equal(nt))
+		Expect(got.Time).Should(Equal("2020-06-01T12:00:00Z"))
+		Expect(rcv.headers[0].Get("Content-Type")).Should(Equal("application/json"))
+		Expect(rcv.headers[0].Get(HeaderSignature)).Should(BeEmpty())
+	})
+
+	It("Test render the body template and send the configured headers", func() {
+		s := sink(extendv1alpha1.NotificationSinkSpec{
+			BodyTemplate: `{"text": {{ json .Message }}, "severity": "{{ if eq .To "healthy" }}info{{ else }}critical{{ end }}"}`,
+			Headers:      map[string]string{"X-Team": "shop"},
+		})
+		Expect(n.deliver(context.Background(), s, nt).Succeeded).Should(BeTrue())
+		Expect(rcv.bodies[0]).Should(Equal(`{"text": "Health scope changed from healthy to unhealthy: ` +
+			`ContainerizedWorkload \"web\" (healthy -> unhealthy)", "severity": "critical"}`))
+		Expect(rcv.headers[0].Get("X-Team")).Should(Equal("shop"))
+
+		s.Spec.BodyTemplate = `text: {{ .Message }}`
+		d := n.deliver(context.Background(), s, nt)
+		Expect(d.Succeeded).Should(BeFalse())
+		Expect(d.Attempts).Should(BeZero())
+		Expect(d.Error).Should(Equal(errInvalidBody))
+	})
+
+	It("Test sign the body with the signing secret", func() {
+		s := sink(extendv1alpha1.NotificationSinkSpec{
+			SigningSecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "signing"}, Key: "key"},
+		})
+		Expect(n.deliver(context.Background(), s, nt).Succeeded).Should(BeTrue())
+		Expect(rcv.headers[0].Get(HeaderSignature)).Should(Equal(signature([]byte("s3cr3t"), []byte(rcv.bodies[0]))))
+
+		s.Spec.SigningSecretRef.Name = "missing"
+		d := n.deliver(context.Background(), s, nt)
+		Expect(d.Succeeded).Should(BeFalse())
+		Expect(d.Error).Should(ContainSubstring(errGetSigningSecret))
+	})
+
+	It("Test retry with backoff until the notification is delivered", func() {
+		rcv.codes = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		d := n.deliver(context.Background(), sink(extendv1alpha1.NotificationSinkSpec{}), nt)
+		Expect(d.Succeeded).Should(BeTrue())
+		Expect(d.Attempts).Should(Equal(int32(3)))
+		Expect(rcv.requests).Should(Equal(3))
+	})
+
+	It("Test give up once the retries are exhausted or the sink rejects the notification", func() {
+		rcv.codes = []int{500, 500, 500}
+		d := n.deliver(context.Background(), sink(extendv1alpha1.NotificationSinkSpec{MaxRetries: retries(2)}), nt)
+		Expect(d.Succeeded).Should(BeFalse())
+		Expect(d.Attempts).Should(Equal(int32(3)))
+		Expect(d.StatusCode).Should(Equal(int32(500)))
+
+		rcv.codes = []int{http.StatusBadRequest}
+		d = n.deliver(context.Background(), sink(extendv1alpha1.NotificationSinkSpec{}), nt)
+		Expect(d.Succeeded).Should(BeFalse())
+		Expect(d.Attempts).Should(Equal(int32(1)))
+		Expect(d.Error).Should(Equal("notification rejected with status 400"))
+	})
+
+	It("Test deliver to the sinks selecting the scope and record the outcome", func() {
+		all := sink(extendv1alpha1.NotificationSinkSpec{MaxRetries: retries(0)})
+		other := sink(extendv1alpha1.NotificationSinkSpec{ScopeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "blog"}}})
+		other.SetName("other")
+		var mu sync.Mutex
+		var updated []*extendv1alpha1.NotificationSink
+		c := n.client.(*test.MockClient)
+		c.MockList = func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+			list.(*extendv1alpha1.NotificationSinkList).Items = []extendv1alpha1.NotificationSink{*all, *other}
+			return nil
+		}
+		c.MockGet = func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(updated) > 0 {
+				updated[len(updated)-1].DeepCopyInto(obj.(*extendv1alpha1.NotificationSink))
+				return nil
+			}
+			all.DeepCopyInto(obj.(*extendv1alpha1.NotificationSink))
+			return nil
+		}
+		c.MockStatusUpdate = func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+			mu.Lock()
+			defer mu.Unlock()
+			updated = append(updated, obj.(*extendv1alpha1.NotificationSink).DeepCopy())
+			return nil
+		}
+		recorded := func() []*extendv1alpha1.NotificationSink {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]*extendv1alpha1.NotificationSink{}, updated...)
+		}
+		failures := make(chan error, 10)
+		failed := func(err error) { failures <- err }
+		hs := &v1alpha2.HealthScope{ObjectMeta: metav1.ObjectMeta{Name: "scope", Namespace: "default",
+			Labels: map[string]string{"app": "shop"}}}
+
+		Expect(n.notify(context.Background(), logging.NewNopLogger(), hs, nt, failed)).Should(Succeed())
+		Eventually(recorded).Should(HaveLen(1))
+		rcv.mu.Lock()
+		Expect(rcv.requests).Should(Equal(1))
+		rcv.mu.Unlock()
+		Expect(failures).ShouldNot(Receive())
+		Expect(recorded()[0].GetName()).Should(Equal("chatops"))
+		Expect(recorded()[0].Status.LastDelivery.Succeeded).Should(BeTrue())
+		Expect(recorded()[0].Status.LastSuccessfulDeliveryTime).ShouldNot(BeNil())
+		Expect(recorded()[0].GetCondition(v1alpha1.TypeSynced).Status).Should(Equal(corev1.ConditionTrue))
+
+		rcv.mu.Lock()
+		rcv.codes = []int{http.StatusBadGateway, http.StatusBadGateway}
+		rcv.mu.Unlock()
+		Expect(n.notify(context.Background(), logging.NewNopLogger(), hs, nt, failed)).Should(Succeed())
+		Expect(n.notify(context.Background(), logging.NewNopLogger(), hs, nt, failed)).Should(Succeed())
+		var err error
+		Eventually(failures).Should(Receive(&err))
+		Expect(err.Error()).Should(Equal(`cannot deliver notification to sink "chatops": notification rejected with status 502`))
+		Eventually(recorded).Should(HaveLen(3))
+		By("Counting the failures of deliveries that happened one after another")
+		Expect(recorded()[2].Status.FailedDeliveries).Should(Equal(int32(2)))
+		Expect(recorded()[2].Status.LastSuccessfulDeliveryTime).ShouldNot(BeNil())
+		Expect(recorded()[2].GetCondition(v1alpha1.TypeSynced).Status).Should(Equal(corev1.ConditionFalse))
+	})
+
+	It("Test record the delivery on the latest version of the sink", func() {
+		s := sink(extendv1alpha1.NotificationSinkSpec{})
+		latest := s.DeepCopy()
+		latest.Status.FailedDeliveries = 4
+		c := n.client.(*test.MockClient)
+		c.MockGet = func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			latest.DeepCopyInto(obj.(*extendv1alpha1.NotificationSink))
+			return nil
+		}
+		conflicts := 1
+		c.MockStatusUpdate = func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+			if conflicts > 0 {
+				conflicts--
+				return apierrors.NewConflict(schema.GroupResource{}, "chatops", nil)
+			}
+			obj.(*extendv1alpha1.NotificationSink).DeepCopyInto(latest)
+			return nil
+		}
+
+		Expect(n.recordDelivery(context.Background(), s, extendv1alpha1.NotificationDelivery{Error: "boom"})).Should(Succeed())
+		Expect(latest.Status.FailedDeliveries).Should(Equal(int32(5)))
+		Expect(latest.Status.LastDelivery.Error).Should(Equal("boom"))
+	})
+
+	It("Test deliver the notifications of a scope to a sink one after another and in order", func() {
+		q := &deliveryQueue{}
+		var mu sync.Mutex
+		var delivered []int
+		running := 0
+		overlapped := false
+		deliver := func(i int) func() {
+			return func() {
+				mu.Lock()
+				running++
+				overlapped = overlapped || running > 1
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				running--
+				delivered = append(delivered, i)
+				mu.Unlock()
+			}
+		}
+		k := deliveryKey{Namespace: "default", Scope: "scope", Sink: "chatops"}
+		for i := 0; i < 5; i++ {
+			q.enqueue(k, deliver(i))
+		}
+		Eventually(func() []int {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]int{}, delivered...)
+		}).Should(Equal([]int{0, 1, 2, 3, 4}))
+		Expect(overlapped).Should(BeFalse())
+		Eventually(func() int {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return len(q.pending)
+		}).Should(BeZero())
+	})
+})
@@ -0,0 +1,299 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+)
+
+// Reasons an ApplicationConfiguration is or is not healthy.
+const (
+	ReasonScopesHealthy   v1alpha1.ConditionReason = "ScopesHealthy"
+	ReasonScopesUnhealthy v1alpha1.ConditionReason = "ScopesUnhealthy"
+	ReasonNoHealthScopes  v1alpha1.ConditionReason = "NoHealthScopes"
+)
+
+// ApplicationConfiguration event reasons.
+const (
+	reasonApplicationHealthy   = "ApplicationHealthy"
+	reasonApplicationUnhealthy = "ApplicationUnhealthy"
+)
+
+var appConfigKind = reflect.TypeOf(v1alpha2.ApplicationConfiguration{}).Name()
+
+// appConfigOwners returns the names of the ApplicationConfigurations among
+// the supplied owners, the way util.LocateParentAppConfig finds them.
+func appConfigOwners(owners []metav1.OwnerReference) []string {
+	var names []string
+	for _, o := range owners {
+		if o.Kind == appConfigKind {
+			names = append(names, o.Name)
+		}
+	}
+	return names
+}
+
+// parentAppConfigs returns the sorted names of the ApplicationConfigurations
+// owning the scope or any of its workloads.
+func parentAppConfigs(hs *v1alpha2.HealthScope, h scopeHealth) []string {
+	seen := make(map[string]bool)
+	for _, name := range appConfigOwners(hs.GetOwnerReferences()) {
+		seen[name] = true
+	}
+	for _, w := range h.Workloads {
+		for _, name := range w.AppConfigs {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// An appHealthTracker remembers which ApplicationConfigurations every scope
+// was last found to be part of, so that the applications a scope leaves, or
+// that lose a scope when it is deleted, are re-evaluated. The health of the
+// scopes is not remembered; it is read from the scopes themselves.
+type appHealthTracker struct {
+	mu     sync.Mutex
+	scopes map[types.NamespacedName]map[string]bool
+}
+
+func newAppHealthTracker() *appHealthTracker {
+	return &appHealthTracker{scopes: make(map[types.NamespacedName]map[string]bool)}
+}
+
+// observe records the named scope as part of the supplied parent
+// ApplicationConfigurations, and forgets it for any others. It returns the
+// ApplicationConfigurations whose health may have changed.
+func (t *appHealthTracker) observe(scope types.NamespacedName, parents []string) []types.NamespacedName {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	affected := t.forgetLocked(scope, parents)
+	for _, name := range parents {
+		ac := types.NamespacedName{Namespace: scope.Namespace, Name: name}
+		if t.scopes[ac] == nil {
+			t.scopes[ac] = make(map[string]bool)
+		}
+		t.scopes[ac][scope.Name] = true
+		affected = append(affected, ac)
+	}
+	return affected
+}
+
+// forget drops the named scope, e.g. once it was deleted. It returns the
+// ApplicationConfigurations whose health may have changed.
+func (t *appHealthTracker) forget(scope types.NamespacedName) []types.NamespacedName {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.forgetLocked(scope, nil)
+}
+
+func (t *appHealthTracker) forgetLocked(scope types.NamespacedName, keep []string) []types.NamespacedName {
+	var affected []types.NamespacedName
+	for ac, scopes := range t.scopes {
+		if ac.Namespace != scope.Namespace || containsString(keep, ac.Name) {
+			continue
+		}
+		if _, ok := scopes[scope.Name]; !ok {
+			continue
+		}
+		delete(scopes, scope.Name)
+		if len(scopes) == 0 {
+			delete(t.scopes, ac)
+		}
+		affected = append(affected, ac)
+	}
+	return affected
+}
+
+// members returns the scopes last found to be part of the named
+// ApplicationConfiguration.
+func (t *appHealthTracker) members(ac types.NamespacedName) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.scopes[ac]))
+	for name := range t.scopes[ac] {
+		names = append(names, name)
+	}
+	return names
+}
+
+// appScopesHealth returns whether each of the scopes of the supplied
+// ApplicationConfiguration is healthy. The scopes of an application are
+// those it owns, those its components or workloads are in, those referencing
+// one of its workloads, and the supplied members that were found to select
+// one of its workloads. Scopes whose health was never checked are left out.
+func appScopesHealth(ac *v1alpha2.ApplicationConfiguration, scopes []v1alpha2.HealthScope, members []string) map[string]bool {
+	in := make(map[string]bool)
+	for _, name := range members {
+		in[name] = true
+	}
+	for _, c := range ac.Spec.Components {
+		for _, s := range c.Scopes {
+			if s.ScopeReference.Kind == v1alpha2.HealthScopeKind {
+				in[s.ScopeReference.Name] = true
+			}
+		}
+	}
+	workloads := make(map[v1alpha1.TypedReference]bool)
+	for _, w := range ac.Status.Workloads {
+		ref := w.Reference
+		ref.UID = ""
+		workloads[ref] = true
+		for _, s := range w.Scopes {
+			if s.Reference.Kind == v1alpha2.HealthScopeKind {
+				in[s.Reference.Name] = true
+			}
+		}
+	}
+
+	health := make(map[string]bool)
+	for _, hs := range scopes {
+		if hs.Status.Health == "" {
+			continue
+		}
+		if in[hs.GetName()] || containsString(appConfigOwners(hs.GetOwnerReferences()), ac.GetName()) ||
+			referencesAny(hs.Spec.WorkloadReferences, workloads) {
+			health[hs.GetName()] = hs.Status.Health == statusHealthy
+		}
+	}
+	return health
+}
+
+func referencesAny(refs []v1alpha1.TypedReference, workloads map[v1alpha1.TypedReference]bool) bool {
+	for _, ref := range refs {
+		ref.UID = ""
+		if workloads[ref] {
+			return true
+		}
+	}
+	return false
+}
+
+// appHealthCondition returns the Healthy condition of an ApplicationConfiguration
+// with the supplied scopes. The health of an application without scopes is
+// unknown.
+func appHealthCondition(scopes map[string]bool) v1alpha1.Condition {
+	if len(scopes) == 0 {
+		return v1alpha1.Condition{
+			Type:               TypeHealthy,
+			Status:             corev1.ConditionUnknown,
+			LastTransitionTime: metav1.Now(),
+			Reason:             ReasonNoHealthScopes,
+		}
+	}
+	var healthy, unhealthy []string
+	for name, h := range scopes {
+		if h {
+			healthy = append(healthy, name)
+			continue
+		}
+		unhealthy = append(unhealthy, name)
+	}
+	sort.Strings(healthy)
+	sort.Strings(unhealthy)
+
+	c := v1alpha1.Condition{
+		Type:               TypeHealthy,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonScopesHealthy,
+		Message:            fmt.Sprintf("healthy scopes: [%s]", strings.Join(healthy, ", ")),
+	}
+	if len(unhealthy) > 0 {
+		c.Status = corev1.ConditionFalse
+		c.Reason = ReasonScopesUnhealthy
+		c.Message = fmt.Sprintf("unhealthy scopes: [%s], %s", strings.Join(unhealthy, ", "), c.Message)
+	}
+	return c
+}
+
+// propagateHealth sets the Healthy condition of the supplied
+// ApplicationConfigurations from the health of their scopes, and records an
+// event on those whose health changed. The health of every scope of an
+// application is read from the API server rather than remembered, so that an
+// application is not judged by the few scopes reconciled since a restart.
+// The supplied scope, if any, was just checked and its health not yet written.
+func (r *Reconciler) propagateHealth(ctx context.Context, log logging.Logger, appConfigs []types.NamespacedName,
+	checked *v1alpha2.HealthScope) {
+	for _, nn := range appConfigs {
+		ac := &v1alpha2.ApplicationConfiguration{}
+		if err := r.client.Get(ctx, nn, ac); err != nil {
+			log.Debug("Cannot get the parent application configuration", "appconfig", nn.Name, "error", err)
+			continue
+		}
+		l := &v1alpha2.HealthScopeList{}
+		if err := r.client.List(ctx, l, client.InNamespace(nn.Namespace)); err != nil {
+			log.Debug("Cannot list the scopes of the parent application configuration", "appconfig", nn.Name, "error", err)
+			continue
+		}
+		for i := range l.Items {
+			if checked != nil && l.Items[i].GetName() == checked.GetName() {
+				l.Items[i] = *checked
+			}
+		}
+		c := appHealthCondition(appScopesHealth(ac, l.Items, r.parents.members(nn)))
+		previous := ac.GetCondition(TypeHealthy)
+		// an application that lost its last scope before its health was
+		// ever set has no health to reset
+		if previous.Equal(c) || (c.Reason == ReasonNoHealthScopes && len(previous.Reason) == 0) {
+			continue
+		}
+		ac.SetConditions(c)
+		if err := r.client.Status().Update(ctx, ac); err != nil {
+			log.Debug("Cannot update the health of the parent application configuration", "appconfig", nn.Name, "error", err)
+			continue
+		}
+		switch {
+		case previous.Status == c.Status, c.Status == corev1.ConditionUnknown:
+		case c.Status == corev1.ConditionTrue:
+			r.record.Event(ac, event.Normal(reasonApplicationHealthy, c.Message))
+		default:
+			r.record.Event(ac, event.Warning(reasonApplicationUnhealthy, errors.New(c.Message)))
+		}
+	}
+}
+
+func containsString(all []string, s string) bool {
+	for _, o := range all {
+		if o == s {
+			return true
+		}
+	}
+	return false
+}
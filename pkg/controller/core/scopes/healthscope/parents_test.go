@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// eventRecorder records the events it is supplied.
+type eventRecorder struct {
+	events []event.Event
+}
+
+func (r *eventRecorder) Event(_ runtime.Object, e event.Event) { r.events = append(r.events, e) }
+
+func (r *eventRecorder) WithAnnotations(_ ...string) event.Recorder { return r }
+
+var _ = Describe("HealthScope parent application configurations", func() {
+	owned := func(names ...string) []metav1.OwnerReference {
+		var refs []metav1.OwnerReference
+		for _, n := range names {
+			refs = append(refs, metav1.OwnerReference{APIVersion: "core.oam.dev/v1alpha2", Kind: appConfigKind, Name: n})
+		}
+		return refs
+	}
+	scope := types.NamespacedName{Namespace: "default", Name: "scope"}
+	shop := types.NamespacedName{Namespace: "default", Name: "shop"}
+
+	It("Test locate the application configurations owning the scope or its workloads", func() {
+		hs := &v1alpha2.HealthScope{ObjectMeta: metav1.ObjectMeta{Name: "scope", OwnerReferences: append(owned("shop"),
+			metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "shop"})}}
+		h := scopeHealth{Workloads: []workloadHealth{{AppConfigs: []string{"shop"}}, {AppConfigs: []string{"blog"}}, {}}}
+		Expect(parentAppConfigs(hs, h)).Should(Equal([]string{"blog", "shop"}))
+		Expect(appConfigOwners(owned("a", "b"))).Should(Equal([]string{"a", "b"}))
+	})
+
+	healthScope := func(name, health string, owners ...string) v1alpha2.HealthScope {
+		return v1alpha2.HealthScope{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owned(owners...)},
+			Status:     v1alpha2.HealthScopeStatus{Health: health},
+		}
+	}
+	inScope := func(name string) v1alpha2.ComponentScope {
+		return v1alpha2.ComponentScope{ScopeReference: v1alpha1.TypedReference{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: v1alpha2.HealthScopeKind, Name: name}}
+	}
+
+	It("Test find the scopes of an application and their health", func() {
+		web := v1alpha1.TypedReference{APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload", Name: "web"}
+		ac := &v1alpha2.ApplicationConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+			Spec: v1alpha2.ApplicationConfigurationSpec{Components: []v1alpha2.ApplicationConfigurationComponent{
+				{ComponentName: "web", Scopes: []v1alpha2.ComponentScope{inScope("component")}},
+			}},
+			Status: v1alpha2.ApplicationConfigurationStatus{Workloads: []v1alpha2.WorkloadStatus{{
+				Reference: web,
+				Scopes:    []v1alpha2.WorkloadScope{{Reference: inScope("workload").ScopeReference}},
+			}}},
+		}
+		referencing := healthScope("referencing", statusUnhealthy)
+		web.UID = "web-uid"
+		referencing.Spec.WorkloadReferences = []v1alpha1.TypedReference{web}
+		scopes := []v1alpha2.HealthScope{
+			healthScope("owned", statusHealthy, "shop"),
+			healthScope("component", statusHealthy),
+			healthScope("workload", statusHealthy),
+			referencing,
+			healthScope("selecting", statusUnknown),
+			healthScope("unchecked", "", "shop"),
+			healthScope("other", statusUnhealthy, "blog"),
+		}
+		health := appScopesHealth(ac, scopes, []string{"selecting"})
+		Expect(health).Should(Equal(map[string]bool{
+			"owned": true, "component": true, "workload": true, "referencing": false, "selecting": false,
+		}))
+
+		c := appHealthCondition(health)
+		Expect(c.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(c.Reason).Should(Equal(ReasonScopesUnhealthy))
+		Expect(c.Message).Should(Equal("unhealthy scopes: [referencing, selecting], healthy scopes: [component, owned, workload]"))
+
+		c = appHealthCondition(map[string]bool{"owned": true})
+		Expect(c.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(c.Message).Should(Equal("healthy scopes: [owned]"))
+		c = appHealthCondition(nil)
+		Expect(c.Status).Should(Equal(corev1.ConditionUnknown))
+		Expect(c.Reason).Should(Equal(ReasonNoHealthScopes))
+	})
+
+	It("Test forget the scopes that left or were deleted", func() {
+		t := newAppHealthTracker()
+		Expect(t.observe(scope, []string{"shop"})).Should(Equal([]types.NamespacedName{shop}))
+		Expect(t.members(shop)).Should(Equal([]string{"scope"}))
+		blog := types.NamespacedName{Namespace: "default", Name: "blog"}
+		Expect(t.observe(scope, []string{"blog"})).Should(ConsistOf(shop, blog))
+		Expect(t.members(shop)).Should(BeEmpty())
+
+		Expect(t.forget(scope)).Should(Equal([]types.NamespacedName{blog}))
+		Expect(t.members(blog)).Should(BeEmpty())
+	})
+
+	Context("Propagating the health to the application", func() {
+		var ac *v1alpha2.ApplicationConfiguration
+		var scopes []v1alpha2.HealthScope
+		var updates int
+		var rec *eventRecorder
+		var r *Reconciler
+		BeforeEach(func() {
+			ac = &v1alpha2.ApplicationConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"}}
+			scopes = nil
+			updates = 0
+			rec = &eventRecorder{}
+			c := &test.MockClient{
+				MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+					ac.DeepCopyInto(obj.(*v1alpha2.ApplicationConfiguration))
+					return nil
+				},
+				MockList: func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+					list.(*v1alpha2.HealthScopeList).Items = append([]v1alpha2.HealthScope{}, scopes...)
+					return nil
+				},
+				MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+					updates++
+					obj.(*v1alpha2.ApplicationConfiguration).DeepCopyInto(ac)
+					return nil
+				},
+			}
+			r = &Reconciler{client: c, record: rec, parents: newAppHealthTracker()}
+		})
+		checked := func(health string) *v1alpha2.HealthScope {
+			hs := healthScope("scope", health)
+			return &hs
+		}
+
+		It("Test set the Healthy condition of the application and record its transitions", func() {
+			scopes = []v1alpha2.HealthScope{*checked("")}
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), checked(statusHealthy))
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionTrue))
+			Expect(rec.events).Should(HaveLen(1))
+			Expect(rec.events[0].Reason).Should(Equal(event.Reason(reasonApplicationHealthy)))
+
+			// Nothing changed, so neither the application nor an event is written.
+			scopes = []v1alpha2.HealthScope{*checked(statusHealthy)}
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), checked(statusHealthy))
+			Expect(updates).Should(Equal(1))
+			Expect(rec.events).Should(HaveLen(1))
+
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), checked(statusUnhealthy))
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionFalse))
+			Expect(rec.events).Should(HaveLen(2))
+			Expect(rec.events[1].Type).Should(Equal(event.TypeWarning))
+			Expect(rec.events[1].Reason).Should(Equal(event.Reason(reasonApplicationUnhealthy)))
+			Expect(ac.GetCondition(TypeHealthy).Reason).Should(Equal(ReasonScopesUnhealthy))
+		})
+
+		It("Test judge the application by all of its scopes after a restart", func() {
+			ac.Spec.Components = []v1alpha2.ApplicationConfigurationComponent{
+				{ComponentName: "web", Scopes: []v1alpha2.ComponentScope{inScope("scope")}},
+				{ComponentName: "db", Scopes: []v1alpha2.ComponentScope{inScope("db")}},
+			}
+			scopes = []v1alpha2.HealthScope{*checked(statusUnhealthy), healthScope("db", statusUnhealthy)}
+
+			// The tracker of a restarted controller knows nothing about db.
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), checked(statusHealthy))
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionFalse))
+			Expect(ac.GetCondition(TypeHealthy).Message).Should(Equal("unhealthy scopes: [db], healthy scopes: [scope]"))
+
+			By("Re-evaluating the application once its scope was deleted")
+			scopes = []v1alpha2.HealthScope{healthScope("db", statusHealthy)}
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.forget(scope), nil)
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionTrue))
+			Expect(ac.GetCondition(TypeHealthy).Message).Should(Equal("healthy scopes: [db]"))
+		})
+
+		It("Test reset the health of an application that lost its last scope", func() {
+			scopes = []v1alpha2.HealthScope{*checked(statusHealthy)}
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), checked(statusHealthy))
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionTrue))
+			Expect(rec.events).Should(HaveLen(1))
+
+			scopes = nil
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.forget(scope), nil)
+			Expect(ac.GetCondition(TypeHealthy).Status).Should(Equal(corev1.ConditionUnknown))
+			Expect(ac.GetCondition(TypeHealthy).Reason).Should(Equal(ReasonNoHealthScopes))
+			Expect(updates).Should(Equal(2))
+			Expect(rec.events).Should(HaveLen(1))
+
+			By("Not setting the health of an application that never had any")
+			ac.Status.Conditions = nil
+			r.propagateHealth(context.Background(), logging.NewNopLogger(), r.parents.observe(scope, []string{"shop"}), nil)
+			Expect(ac.Status.Conditions).Should(BeEmpty())
+			Expect(updates).Should(Equal(2))
+		})
+	})
+})
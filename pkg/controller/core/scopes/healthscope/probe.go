@@ -0,0 +1,228 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Active probing of the Service endpoints of a scope's workloads, which is
+// disabled unless AnnotationProbe is set.
+const (
+	// AnnotationProbe enables probing with the protocol to use, "http" or "tcp"
+	AnnotationProbe = "healthscope.extend.oam.dev/probe"
+	// AnnotationProbePath is the path an HTTP probe requests, "/" by default
+	AnnotationProbePath = "healthscope.extend.oam.dev/probe-path"
+	// AnnotationProbeExpectedStatus is the status code an HTTP probe expects, any 2xx or 3xx by default
+	AnnotationProbeExpectedStatus = "healthscope.extend.oam.dev/probe-expected-status"
+	// AnnotationProbePort restricts probing to a port name or number, every endpoint port is probed by default
+	AnnotationProbePort = "healthscope.extend.oam.dev/probe-port"
+)
+
+// Probe protocols.
+const (
+	probeHTTP = "http"
+	probeTCP  = "tcp"
+)
+
+// defaultProbeConcurrency is how many endpoints are probed at once.
+const defaultProbeConcurrency = 10
+
+// Probe error strings.
+const (
+	errInvalidProbe          = "invalid probe annotations"
+	errUnknownProbeProtocol  = "unknown probe protocol %q"
+	errInvalidExpectedStatus = "invalid expected status %q"
+	errNoEndpoints           = "could not retrieve endpoints of service %q"
+	errNoReadyEndpoints      = "no ready endpoint found for service %q"
+	errProbeFailed           = "probe of service %q endpoint %s failed"
+	errUnexpectedStatus      = "unexpected status %d"
+)
+
+// A probeSpec describes how to probe Service endpoints.
+type probeSpec struct {
+	protocol       string
+	path           string
+	expectedStatus int
+	port           string
+	timeout        time.Duration
+}
+
+// parseProbeSpec builds the probe from the scope annotations. A nil probe
+// means probing is disabled.
+func parseProbeSpec(annotations map[string]string, timeout time.Duration) (*probeSpec, error) {
+	protocol, err := parseProbeProtocol(annotations[AnnotationProbe])
+	if err != nil || len(protocol) == 0 {
+		return nil, err
+	}
+	p := &probeSpec{
+		protocol: protocol,
+		path:     strings.TrimSpace(annotations[AnnotationProbePath]),
+		port:     strings.TrimSpace(annotations[AnnotationProbePort]),
+		timeout:  timeout,
+	}
+	if !strings.HasPrefix(p.path, "/") {
+		p.path = "/" + p.path
+	}
+	if p.expectedStatus, err = parseExpectedStatus(annotations[AnnotationProbeExpectedStatus]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseProbeProtocol returns the protocol of v, empty if probing is disabled.
+func parseProbeProtocol(v string) (string, error) {
+	protocol := strings.ToLower(strings.TrimSpace(v))
+	if len(protocol) != 0 && protocol != probeHTTP && protocol != probeTCP {
+		return "", errors.Errorf(errUnknownProbeProtocol, protocol)
+	}
+	return protocol, nil
+}
+
+// parseExpectedStatus returns the status code of v, zero if it is empty.
+func parseExpectedStatus(v string) (int, error) {
+	s := strings.TrimSpace(v)
+	if len(s) == 0 {
+		return 0, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, errors.Errorf(errInvalidExpectedStatus, s)
+	}
+	return code, nil
+}
+
+// A probeTarget is a single endpoint address of a workload's Service.
+type probeTarget struct {
+	service string
+	address string
+}
+
+// serviceEndpoints returns the ready addresses of the named Service that
+// match the probe's port.
+func serviceEndpoints(ctx context.Context, c client.Client, namespace, service string, p *probeSpec) ([]string, error) {
+	ep := corev1.Endpoints{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: service}, &ep); err != nil {
+		return nil, errors.Wrapf(err, errNoEndpoints, service)
+	}
+
+	var addresses []string
+	for _, subset := range ep.Subsets {
+		for _, port := range subset.Ports {
+			if len(p.port) != 0 && p.port != port.Name && p.port != strconv.Itoa(int(port.Port)) {
+				continue
+			}
+			for _, a := range subset.Addresses {
+				addresses = append(addresses, net.JoinHostPort(a.IP, strconv.Itoa(int(port.Port))))
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, errors.Errorf(errNoReadyEndpoints, service)
+	}
+	return addresses, nil
+}
+
+// probeClient sends the HTTP probes. Redirects are not followed: the status
+// of the endpoint itself is checked, and the controller never requests a host
+// an endpoint redirects it to.
+var probeClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// A prober probes Service endpoints. The number of probes in flight is
+// bounded across every scope and workload sharing the prober.
+type prober struct {
+	sem chan struct{}
+}
+
+// newProber returns a prober that runs at most concurrency probes at once.
+func newProber(concurrency int) *prober {
+	if concurrency <= 0 {
+		concurrency = defaultProbeConcurrency
+	}
+	return &prober{sem: make(chan struct{}, concurrency)}
+}
+
+// probe all of the supplied targets. The returned errors are in the order of
+// the targets, a nil error means the target answered as expected.
+func (pr *prober) probe(ctx context.Context, p *probeSpec, targets []probeTarget) []error {
+	results := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		// A probe still waiting for a free slot when the health check of the
+		// workload times out is not run at all.
+		select {
+		case pr.sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = errors.Wrapf(ctx.Err(), errProbeFailed, targets[i].service, targets[i].address)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-pr.sem
+				wg.Done()
+			}()
+			if err := probeAddress(ctx, p, targets[i].address); err != nil {
+				results[i] = errors.Wrapf(err, errProbeFailed, targets[i].service, targets[i].address)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func probeAddress(ctx context.Context, p *probeSpec, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	if p.protocol == probeTCP {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+p.path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if p.expectedStatus != 0 && resp.StatusCode != p.expectedStatus ||
+		p.expectedStatus == 0 && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest) {
+		return errors.Errorf(errUnexpectedStatus, resp.StatusCode)
+	}
+	return nil
+}
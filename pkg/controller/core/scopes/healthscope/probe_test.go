@@ -0,0 +1,254 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// statusServer returns a server that answers every request with the supplied status.
+func statusServer(status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+}
+
+// endpointsOf returns Endpoints with a single address serving the supplied servers' ports.
+func endpointsOf(servers ...*httptest.Server) *corev1.Endpoints {
+	subset := corev1.EndpointSubset{Addresses: []corev1.EndpointAddress{{IP: "127.0.0.1"}}}
+	for i, s := range servers {
+		_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+		p, _ := strconv.Atoi(port)
+		subset.Ports = append(subset.Ports, corev1.EndpointPort{Name: "port-" + strconv.Itoa(i), Port: int32(p)})
+	}
+	return &corev1.Endpoints{Subsets: []corev1.EndpointSubset{subset}}
+}
+
+var _ = Describe("HealthScope active probing", func() {
+	ctx := context.Background()
+	httpProbe := &probeSpec{protocol: probeHTTP, path: "/healthz", timeout: time.Second}
+	target := func(s *httptest.Server) probeTarget {
+		return probeTarget{service: "web", address: s.Listener.Addr().String()}
+	}
+
+	It("Test parse the probe annotations", func() {
+		p, err := parseProbeSpec(nil, time.Second)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(p).Should(BeNil())
+
+		p, err = parseProbeSpec(map[string]string{
+			AnnotationProbe:               "HTTP",
+			AnnotationProbePath:           "healthz",
+			AnnotationProbeExpectedStatus: "204",
+			AnnotationProbePort:           "http",
+		}, time.Second)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(*p).Should(Equal(probeSpec{protocol: probeHTTP, path: "/healthz", expectedStatus: 204,
+			port: "http", timeout: time.Second}))
+
+		_, err = parseProbeSpec(map[string]string{AnnotationProbe: "udp"}, time.Second)
+		Expect(err).Should(HaveOccurred())
+		_, err = parseProbeSpec(map[string]string{AnnotationProbe: "http", AnnotationProbeExpectedStatus: "ok"}, time.Second)
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Test probe endpoints over HTTP", func() {
+		ok := statusServer(http.StatusOK)
+		defer ok.Close()
+		failing := statusServer(http.StatusServiceUnavailable)
+		defer failing.Close()
+		noContent := statusServer(http.StatusNoContent)
+		defer noContent.Close()
+
+		errs := newProber(0).probe(ctx, httpProbe, []probeTarget{target(ok), target(failing)})
+		Expect(errs[0]).ShouldNot(HaveOccurred())
+		Expect(errs[1]).Should(HaveOccurred())
+		Expect(errs[1].Error()).Should(ContainSubstring("unexpected status 503"))
+
+		expect204 := &probeSpec{protocol: probeHTTP, path: "/", expectedStatus: http.StatusNoContent, timeout: time.Second}
+		errs = newProber(0).probe(ctx, expect204, []probeTarget{target(ok), target(noContent)})
+		Expect(errs[0]).Should(HaveOccurred())
+		Expect(errs[1]).ShouldNot(HaveOccurred())
+	})
+
+	It("Test check the status of an endpoint that redirects", func() {
+		var followed int32
+		elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&followed, 1)
+		}))
+		defer elsewhere.Close()
+		redirect := httptest.NewServer(http.RedirectHandler(elsewhere.URL, http.StatusFound))
+		defer redirect.Close()
+
+		errs := newProber(0).probe(ctx, httpProbe, []probeTarget{target(redirect)})
+		Expect(errs[0]).ShouldNot(HaveOccurred())
+		expect302 := &probeSpec{protocol: probeHTTP, path: "/", expectedStatus: http.StatusFound, timeout: time.Second}
+		errs = newProber(0).probe(ctx, expect302, []probeTarget{target(redirect)})
+		Expect(errs[0]).ShouldNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&followed)).Should(BeZero())
+	})
+
+	It("Test probe endpoints over TCP", func() {
+		open := statusServer(http.StatusOK)
+		defer open.Close()
+		closed := statusServer(http.StatusOK)
+		closedTarget := target(closed)
+		closed.Close()
+
+		tcp := &probeSpec{protocol: probeTCP, timeout: time.Second}
+		errs := newProber(0).probe(ctx, tcp, []probeTarget{target(open), closedTarget})
+		Expect(errs[0]).ShouldNot(HaveOccurred())
+		Expect(errs[1]).Should(HaveOccurred())
+	})
+
+	It("Test fail a probe that exceeds the timeout", func() {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}))
+		defer slow.Close()
+
+		p := &probeSpec{protocol: probeHTTP, path: "/", timeout: 50 * time.Millisecond}
+		errs := newProber(0).probe(ctx, p, []probeTarget{target(slow)})
+		Expect(errs[0]).Should(HaveOccurred())
+	})
+
+	It("Test bound the number of concurrent probes", func() {
+		var inFlight, maxInFlight int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		targets := make([]probeTarget, 8)
+		for i := range targets {
+			targets[i] = target(server)
+		}
+		for _, err := range newProber(2).probe(ctx, httpProbe, targets) {
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(atomic.LoadInt32(&maxInFlight)).Should(BeNumerically("<=", 2))
+	})
+
+	It("Test stop waiting for a free probe slot once the context is done", func() {
+		pr := newProber(1)
+		pr.sem <- struct{}{}
+		defer func() { <-pr.sem }()
+		ok := statusServer(http.StatusOK)
+		defer ok.Close()
+
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		done := make(chan []error)
+		go func() { done <- pr.probe(timeout, httpProbe, []probeTarget{target(ok), target(ok)}) }()
+		var errs []error
+		Eventually(done, time.Second).Should(Receive(&errs))
+		for _, err := range errs {
+			Expect(err).Should(MatchError(ContainSubstring(context.DeadlineExceeded.Error())))
+		}
+	})
+
+	It("Test select the endpoint addresses of the probed port", func() {
+		a := statusServer(http.StatusOK)
+		defer a.Close()
+		b := statusServer(http.StatusOK)
+		defer b.Close()
+		c := test.NewMockClient()
+		c.MockGet = test.NewMockGetFn(nil, func(o runtime.Object) error {
+			*o.(*corev1.Endpoints) = *endpointsOf(a, b)
+			return nil
+		})
+
+		addresses, err := serviceEndpoints(ctx, c, "default", "web", &probeSpec{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(addresses).Should(Equal([]string{a.Listener.Addr().String(), b.Listener.Addr().String()}))
+
+		addresses, err = serviceEndpoints(ctx, c, "default", "web", &probeSpec{port: "port-1"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(addresses).Should(Equal([]string{b.Listener.Addr().String()}))
+
+		_, err = serviceEndpoints(ctx, c, "default", "web", &probeSpec{port: "grpc"})
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("Test fold probe results into workload health", func() {
+		failing := statusServer(http.StatusInternalServerError)
+		defer failing.Close()
+		svc := v1alpha1.TypedReference{APIVersion: "v1", Kind: "Service", Name: "web"}
+		wl := fakeWorkload("app", svc)
+
+		c := test.NewMockClient()
+		c.MockGet = func(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *corev1.Endpoints:
+				*o = *endpointsOf(failing)
+			case *unstructured.Unstructured:
+				if o.GetKind() == v1alpha2.ContainerizedWorkloadKind {
+					o.Object = wl.DeepCopy().Object
+				}
+			}
+			return nil
+		}
+		hs := &v1alpha2.HealthScope{
+			ObjectMeta: metav1.ObjectMeta{Name: "scope", Namespace: "default"},
+			Spec: v1alpha2.HealthScopeSpec{WorkloadReferences: []v1alpha1.TypedReference{{
+				APIVersion: v1alpha2.SchemeGroupVersion.String(),
+				Kind:       v1alpha2.ContainerizedWorkloadKind,
+				Name:       "app",
+			}}},
+		}
+
+		h, err := evaluator(c).evaluate(ctx, logging.NewNopLogger(), hs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeTrue())
+
+		hs.SetAnnotations(map[string]string{AnnotationProbe: probeHTTP})
+		h, err = evaluator(c).evaluate(ctx, logging.NewNopLogger(), hs)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(h.Healthy).Should(BeFalse())
+		Expect(h.Workloads[0].Message).Should(ContainSubstring("unexpected status 500"))
+	})
+})
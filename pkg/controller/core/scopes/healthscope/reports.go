@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultReports are served by the health endpoint of the controller manager.
+var defaultReports = newHealthReports()
+
+// A scopeReport is the outcome of the last health check of a HealthScope.
+type scopeReport struct {
+	Namespace     string           `json:"namespace"`
+	Name          string           `json:"name"`
+	Health        string           `json:"health"`
+	Explanation   string           `json:"explanation,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	LastProbeTime time.Time        `json:"lastProbeTime"`
+	Workloads     []workloadReport `json:"workloads"`
+}
+
+// A workloadReport is the outcome of the last health check of a workload.
+type workloadReport struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Health     string `json:"health"`
+	Message    string `json:"message,omitempty"`
+}
+
+// healthReports keeps the outcome of the last health check of every scope so
+// that it can be served without reading the scopes from the API server.
+type healthReports struct {
+	mu     sync.RWMutex
+	scopes map[types.NamespacedName]scopeReport
+}
+
+func newHealthReports() *healthReports {
+	return &healthReports{scopes: make(map[types.NamespacedName]scopeReport)}
+}
+
+// observe records a completed health check of the named scope.
+func (r *healthReports) observe(nn types.NamespacedName, h scopeHealth, now time.Time) {
+	sr := scopeReport{
+		Namespace:     nn.Namespace,
+		Name:          nn.Name,
+		Health:        h.Status(),
+		Explanation:   h.Explanation,
+		LastProbeTime: now,
+		Workloads:     make([]workloadReport, 0, len(h.Workloads)),
+	}
+	for _, w := range h.Workloads {
+		sr.Workloads = append(sr.Workloads, workloadReport{
+			APIVersion: w.Reference.APIVersion,
+			Kind:       w.Reference.Kind,
+			Name:       w.Reference.Name,
+			Health:     w.Status(),
+			Message:    w.Message,
+		})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scopes[nn] = sr
+}
+
+// observeFailure records a health check of the named scope that could not be
+// completed. The scope is reported as unhealthy, keeping the workloads of its
+// last completed check.
+func (r *healthReports) observeFailure(nn types.NamespacedName, err error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sr, ok := r.scopes[nn]
+	if !ok {
+		sr = scopeReport{Namespace: nn.Namespace, Name: nn.Name, Workloads: []workloadReport{}}
+	}
+	sr.Health = statusUnhealthy
+	sr.Explanation = ""
+	sr.Error = err.Error()
+	sr.LastProbeTime = now
+	r.scopes[nn] = sr
+}
+
+// forget drops the report of the named scope, e.g. once it was deleted.
+func (r *healthReports) forget(nn types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.scopes, nn)
+}
+
+// get returns the report of the named scope, if any.
+func (r *healthReports) get(nn types.NamespacedName) (scopeReport, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sr, ok := r.scopes[nn]
+	return sr, ok
+}
+
+// list returns the reports of every scope in the supplied namespace, or in
+// all namespaces if it is empty, sorted by namespace and name.
+func (r *healthReports) list(namespace string) []scopeReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	reports := make([]scopeReport, 0, len(r.scopes))
+	for nn, sr := range r.scopes {
+		if namespace == "" || nn.Namespace == namespace {
+			reports = append(reports, sr)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Namespace != reports[j].Namespace {
+			return reports[i].Namespace < reports[j].Namespace
+		}
+		return reports[i].Name < reports[j].Name
+	})
+	return reports
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+// HealthPath is the path the health endpoint serves HealthScope health under.
+// GET HealthPath lists every scope, HealthPath/<namespace> the scopes of a
+// namespace and HealthPath/<namespace>/<name> a single scope.
+const HealthPath = "/healthscopes"
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 10 * time.Second
+)
+
+// Health server error strings.
+const (
+	errMissingHealthToken = "the health endpoint requires a bearer token"
+	errServeHealth        = "cannot serve the health endpoint"
+)
+
+// A HealthServer serves the outcome of the latest health check of every
+// HealthScope as JSON. It is read-only, and every request must present the
+// server's bearer token. Health checks only run while the controller manager
+// is the leader, so the server does too.
+type HealthServer struct {
+	addr    string
+	token   []byte
+	reports *healthReports
+	log     logging.Logger
+}
+
+// NewHealthServer returns a HealthServer listening on the supplied address
+// that accepts requests presenting the supplied bearer token.
+func NewHealthServer(addr, token string, l logging.Logger) (*HealthServer, error) {
+	token = strings.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, errors.New(errMissingHealthToken)
+	}
+	return &HealthServer{addr: addr, token: []byte(token), reports: defaultReports, log: l}, nil
+}
+
+// Start serves the health endpoint until stop is closed.
+func (s *HealthServer) Start(stop <-chan struct{}) error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return errors.Wrap(err, errServeHealth)
+	}
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: readHeaderTimeout}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			s.log.Debug("Cannot shut down the health endpoint", "error", err)
+		}
+	}()
+
+	s.log.Info("Serving HealthScope health", "address", l.Addr().String(), "path", HealthPath)
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, errServeHealth)
+	}
+	<-done
+	return nil
+}
+
+// ServeHTTP serves the health of the requested scopes. A single scope is
+// served with status 200 if it is healthy and 503 otherwise, so that load
+// balancers can use it as a health check as is.
+func (s *HealthServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !s.authenticated(req) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="healthscopes"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(req.URL.Path, HealthPath)
+	if rest == req.URL.Path || (len(rest) > 0 && rest[0] != '/') {
+		http.NotFound(w, req)
+		return
+	}
+	var parts []string
+	if rest = strings.Trim(rest, "/"); len(rest) > 0 {
+		parts = strings.Split(rest, "/")
+	}
+
+	switch len(parts) {
+	case 0:
+		s.write(w, http.StatusOK, map[string]interface{}{"scopes": s.reports.list("")})
+	case 1:
+		s.write(w, http.StatusOK, map[string]interface{}{"scopes": s.reports.list(parts[0])})
+	case 2:
+		sr, ok := s.reports.get(types.NamespacedName{Namespace: parts[0], Name: parts[1]})
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		code := http.StatusOK
+		if sr.Health != statusHealthy {
+			code = http.StatusServiceUnavailable
+		}
+		s.write(w, code, sr)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *HealthServer) authenticated(req *http.Request) bool {
+	h := req.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))), s.token) == 1
+}
+
+func (s *HealthServer) write(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.log.Debug("Cannot write health response", "error", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("HealthScope health endpoint", func() {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	shop := types.NamespacedName{Namespace: "shop", Name: "frontend"}
+	blog := types.NamespacedName{Namespace: "blog", Name: "backend"}
+	workload := func(name string, healthy bool) workloadHealth {
+		return workloadHealth{
+			Reference: v1alpha1.TypedReference{APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload", Name: name},
+			Healthy:   healthy,
+		}
+	}
+
+	var srv *HealthServer
+	BeforeEach(func() {
+		var err error
+		srv, err = NewHealthServer(":0", "s3cr3t\n", logging.NewNopLogger())
+		Expect(err).ShouldNot(HaveOccurred())
+		srv.reports = newHealthReports()
+		srv.reports.observe(shop, scopeHealth{Healthy: true, Explanation: "1 of 1 workloads healthy",
+			Workloads: []workloadHealth{workload("web", true)}}, now)
+		srv.reports.observe(blog, scopeHealth{Workloads: []workloadHealth{workload("api", false)}}, now)
+	})
+	get := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("Test require a bearer token", func() {
+		_, err := NewHealthServer(":0", " ", logging.NewNopLogger())
+		Expect(err).Should(HaveOccurred())
+
+		Expect(get(http.MethodGet, HealthPath, "").Code).Should(Equal(http.StatusUnauthorized))
+		Expect(get(http.MethodGet, HealthPath, "wrong").Code).Should(Equal(http.StatusUnauthorized))
+		Expect(get(http.MethodGet, HealthPath, "s3cr3t").Code).Should(Equal(http.StatusOK))
+	})
+
+	It("Test serve the endpoint read-only", func() {
+		rec := get(http.MethodPost, HealthPath, "s3cr3t")
+		Expect(rec.Code).Should(Equal(http.StatusMethodNotAllowed))
+		Expect(rec.Header().Get("Allow")).Should(Equal("GET, HEAD"))
+	})
+
+	It("Test list the health of every scope and of the scopes of a namespace", func() {
+		var body struct{ Scopes []scopeReport }
+		rec := get(http.MethodGet, HealthPath, "s3cr3t")
+		Expect(rec.Header().Get("Content-Type")).Should(Equal("application/json"))
+		Expect(json.Unmarshal(rec.Body.Bytes(), &body)).Should(Succeed())
+		Expect(body.Scopes).Should(HaveLen(2))
+		Expect(body.Scopes[0].Namespace).Should(Equal("blog"))
+		Expect(body.Scopes[1].Namespace).Should(Equal("shop"))
+
+		body.Scopes = nil
+		Expect(json.Unmarshal(get(http.MethodGet, HealthPath+"/shop/", "s3cr3t").Body.Bytes(), &body)).Should(Succeed())
+		Expect(body.Scopes).Should(Equal([]scopeReport{{
+			Namespace:     "shop",
+			Name:          "frontend",
+			Health:        statusHealthy,
+			Explanation:   "1 of 1 workloads healthy",
+			LastProbeTime: now,
+			Workloads: []workloadReport{{
+				APIVersion: "core.oam.dev/v1alpha2",
+				Kind:       "ContainerizedWorkload",
+				Name:       "web",
+				Health:     statusHealthy,
+			}},
+		}}))
+	})
+
+	It("Test serve a single scope with a status code reflecting its health", func() {
+		Expect(get(http.MethodGet, HealthPath+"/shop/frontend", "s3cr3t").Code).Should(Equal(http.StatusOK))
+		Expect(get(http.MethodGet, HealthPath+"/blog/backend", "s3cr3t").Code).Should(Equal(http.StatusServiceUnavailable))
+		Expect(get(http.MethodGet, HealthPath+"/blog/missing", "s3cr3t").Code).Should(Equal(http.StatusNotFound))
+		Expect(get(http.MethodGet, HealthPath+"x", "s3cr3t").Code).Should(Equal(http.StatusNotFound))
+		Expect(get(http.MethodGet, HealthPath+"/a/b/c", "s3cr3t").Code).Should(Equal(http.StatusNotFound))
+	})
+
+	It("Test report a failed health check and forget deleted scopes", func() {
+		srv.reports.observeFailure(shop, errors.New("boom"), now.Add(time.Minute))
+		sr, ok := srv.reports.get(shop)
+		Expect(ok).Should(BeTrue())
+		Expect(sr.Health).Should(Equal(statusUnhealthy))
+		Expect(sr.Error).Should(Equal("boom"))
+		Expect(sr.LastProbeTime).Should(Equal(now.Add(time.Minute)))
+		Expect(sr.Workloads).Should(HaveLen(1))
+
+		srv.reports.forget(shop)
+		Expect(get(http.MethodGet, HealthPath+"/shop/frontend", "s3cr3t").Code).Should(Equal(http.StatusNotFound))
+	})
+})
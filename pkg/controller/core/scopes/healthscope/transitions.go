@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+)
+
+// AnnotationEventHeartbeat is an optional duration, e.g. "1h", after which a
+// HealthScope whose health did not change records an event anyway.
+const AnnotationEventHeartbeat = "healthscope.extend.oam.dev/event-heartbeat"
+
+// A workloadTransition is a change of a single workload's health.
+type workloadTransition struct {
+	Reference v1alpha1.TypedReference
+	From      string
+	To        string
+}
+
+func (t workloadTransition) String() string {
+	return fmt.Sprintf("%s %q (%s -> %s)", t.Reference.Kind, t.Reference.Name, t.From, t.To)
+}
+
+// A healthTransition is the change of a HealthScope's health since the
+// previous health check.
+type healthTransition struct {
+	From      string
+	To        string
+	Workloads []workloadTransition
+}
+
+// Changed returns true if the aggregate health or any workload's health changed.
+// The first health check of a new scope, which has no previous health, is not
+// a change, so it is neither recorded as a recovery nor notified.
+func (t healthTransition) Changed() bool {
+	return len(t.From) > 0 && (t.From != t.To || len(t.Workloads) > 0)
+}
+
+// Message describes the transition for an event.
+func (t healthTransition) Message() string {
+	msg := fmt.Sprintf("Health scope is %s", t.To)
+	if t.From != t.To {
+		msg = fmt.Sprintf("Health scope changed from %s to %s", orUnknown(t.From), t.To)
+	}
+	if len(t.Workloads) == 0 {
+		return msg
+	}
+	changed := make([]string, 0, len(t.Workloads))
+	for _, w := range t.Workloads {
+		changed = append(changed, w.String())
+	}
+	return msg + ": " + strings.Join(changed, ", ")
+}
+
+// A healthRecord is the outcome of the last health check of a scope.
+type healthRecord struct {
+	workloads map[string]string
+	lastEvent time.Time
+}
+
+// A transitionTracker remembers the per-workload health of every scope so
+// that only changes are reported. The aggregate health is read from the
+// scope's status, which survives controller restarts.
+type transitionTracker struct {
+	mu      sync.Mutex
+	records map[types.NamespacedName]*healthRecord
+}
+
+func newTransitionTracker() *transitionTracker {
+	return &transitionTracker{records: make(map[types.NamespacedName]*healthRecord)}
+}
+
+// observe records the health of the named scope and returns how it changed
+// since the previous check. previous is the aggregate health recorded in the
+// scope's status before this check.
+func (t *transitionTracker) observe(nn types.NamespacedName, previous string, h scopeHealth,
+	now time.Time) healthTransition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tr := healthTransition{From: previous, To: h.Status()}
+	current := make(map[string]string, len(h.Workloads))
+	for _, w := range h.Workloads {
+		current[workloadKey(w.Reference)] = w.Status()
+	}
+
+	rec, ok := t.records[nn]
+	if !ok {
+		// Nothing is known about the workloads after a restart, so only a
+		// change of the aggregate health names them.
+		rec = &healthRecord{lastEvent: now}
+		t.records[nn] = rec
+	}
+	if ok || tr.From != tr.To {
+		for _, w := range h.Workloads {
+			from, seen := rec.workloads[workloadKey(w.Reference)]
+			if !seen {
+				from = statusUnknown
+			}
+			if to := w.Status(); from != to && (ok || to == statusUnhealthy) {
+				tr.Workloads = append(tr.Workloads, workloadTransition{Reference: w.Reference, From: from, To: to})
+			}
+		}
+	}
+	rec.workloads = current
+	return tr
+}
+
+// heartbeatDue returns true if no event was recorded for the named scope
+// within the supplied interval. A zero interval disables the heartbeat.
+func (t *transitionTracker) heartbeatDue(nn types.NamespacedName, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.records[nn]
+	return ok && now.Sub(rec.lastEvent) >= interval
+}
+
+// recorded notes that an event was recorded for the named scope.
+func (t *transitionTracker) recorded(nn types.NamespacedName, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rec, ok := t.records[nn]; ok {
+		rec.lastEvent = now
+	}
+}
+
+// forget drops everything known about the named scope, e.g. once it was deleted.
+func (t *transitionTracker) forget(nn types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.records, nn)
+}
+
+// eventHeartbeat returns the heartbeat interval set on a scope, or zero if
+// none or an invalid one is set.
+func eventHeartbeat(annotations map[string]string) (time.Duration, error) {
+	v := strings.TrimSpace(annotations[AnnotationEventHeartbeat])
+	if len(v) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", v)
+	}
+	return d, nil
+}
+
+func workloadKey(ref v1alpha1.TypedReference) string {
+	return ref.APIVersion + "/" + ref.Kind + "/" + ref.Name
+}
+
+func healthStatus(healthy bool) string {
+	if healthy {
+		return statusHealthy
+	}
+	return statusUnhealthy
+}
+
+func orUnknown(status string) string {
+	if len(status) == 0 {
+		return statusUnknown
+	}
+	return status
+}
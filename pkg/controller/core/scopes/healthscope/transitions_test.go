@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("HealthScope health transitions", func() {
+	nn := types.NamespacedName{Namespace: "default", Name: "scope"}
+	ref := func(name string) v1alpha1.TypedReference {
+		return v1alpha1.TypedReference{APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload", Name: name}
+	}
+	health := func(workloads ...workloadHealth) scopeHealth {
+		h := scopeHealth{Healthy: true, Workloads: workloads}
+		for _, w := range workloads {
+			h.Healthy = h.Healthy && w.Healthy
+		}
+		return h
+	}
+	app := func(healthy bool) workloadHealth { return workloadHealth{Reference: ref("app"), Healthy: healthy} }
+	worker := func(healthy bool) workloadHealth { return workloadHealth{Reference: ref("worker"), Healthy: healthy} }
+	now := time.Now()
+
+	It("Test report nothing for the first health check of a new scope", func() {
+		t := newTransitionTracker()
+		tr := t.observe(nn, "", health(app(true)), now)
+		Expect(tr.Changed()).Should(BeFalse())
+		Expect(t.heartbeatDue(nn, time.Minute, now)).Should(BeFalse())
+		tr = t.observe(nn, "", health(app(false)), now)
+		Expect(tr.Changed()).Should(BeFalse())
+	})
+
+	It("Test report nothing while the health does not change", func() {
+		t := newTransitionTracker()
+		t.observe(nn, "", health(app(true), worker(false)), now)
+		tr := t.observe(nn, statusUnhealthy, health(app(true), worker(false)), now)
+		Expect(tr.Changed()).Should(BeFalse())
+	})
+
+	It("Test name the workloads whose health changed", func() {
+		t := newTransitionTracker()
+		t.observe(nn, "", health(app(true), worker(true)), now)
+		tr := t.observe(nn, statusHealthy, health(app(true), worker(false)), now)
+		Expect(tr.Changed()).Should(BeTrue())
+		Expect(tr.Workloads).Should(Equal([]workloadTransition{{Reference: ref("worker"), From: statusHealthy, To: statusUnhealthy}}))
+		Expect(tr.Message()).Should(Equal(
+			`Health scope changed from healthy to unhealthy: ContainerizedWorkload "worker" (healthy -> unhealthy)`))
+
+		tr = t.observe(nn, statusUnhealthy, health(app(false), worker(false)), now)
+		Expect(tr.From).Should(Equal(tr.To))
+		Expect(tr.Changed()).Should(BeTrue())
+		Expect(tr.Workloads).Should(HaveLen(1))
+		Expect(tr.Workloads[0].Reference.Name).Should(Equal("app"))
+	})
+
+	It("Test report nothing after a restart while the aggregate health does not change", func() {
+		t := newTransitionTracker()
+		tr := t.observe(nn, statusUnhealthy, health(app(true), worker(false)), now)
+		Expect(tr.Changed()).Should(BeFalse())
+
+		t = newTransitionTracker()
+		tr = t.observe(nn, statusHealthy, health(app(true), worker(false)), now)
+		Expect(tr.Changed()).Should(BeTrue())
+		Expect(tr.Workloads).Should(Equal([]workloadTransition{{Reference: ref("worker"), From: statusUnknown, To: statusUnhealthy}}))
+	})
+
+	It("Test heartbeat once no event was recorded within the interval", func() {
+		t := newTransitionTracker()
+		Expect(t.heartbeatDue(nn, time.Minute, now)).Should(BeFalse())
+		t.observe(nn, statusHealthy, health(app(true)), now)
+		Expect(t.heartbeatDue(nn, 0, now.Add(time.Hour))).Should(BeFalse())
+		Expect(t.heartbeatDue(nn, time.Minute, now.Add(30*time.Second))).Should(BeFalse())
+		Expect(t.heartbeatDue(nn, time.Minute, now.Add(time.Minute))).Should(BeTrue())
+		t.recorded(nn, now.Add(time.Minute))
+		Expect(t.heartbeatDue(nn, time.Minute, now.Add(90*time.Second))).Should(BeFalse())
+
+		t.forget(nn)
+		Expect(t.heartbeatDue(nn, time.Minute, now.Add(time.Hour))).Should(BeFalse())
+	})
+
+	It("Test parse the event heartbeat annotation", func() {
+		d, err := eventHeartbeat(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(d).Should(BeZero())
+		d, err = eventHeartbeat(map[string]string{AnnotationEventHeartbeat: "1h"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(d).Should(Equal(time.Hour))
+		_, err = eventHeartbeat(map[string]string{AnnotationEventHeartbeat: "hourly"})
+		Expect(err).Should(HaveOccurred())
+		_, err = eventHeartbeat(map[string]string{AnnotationEventHeartbeat: "-1h"})
+		Expect(err).Should(HaveOccurred())
+	})
+})
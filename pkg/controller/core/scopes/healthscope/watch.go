@@ -0,0 +1,352 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+)
+
+// Field indexes of HealthScopes.
+const (
+	// workloadIndex indexes HealthScopes by the workloads they reference.
+	workloadIndex = "spec.workloadReferences"
+	// selectorIndex indexes HealthScopes by the kinds of workloads their
+	// workload selector applies to.
+	selectorIndex = "metadata.annotations.workloadSelector"
+)
+
+const (
+	// maxOwnerDepth is how many owners up from a changed resource, e.g. from a
+	// Pod to its Deployment and workload, are searched for a workload
+	// referenced by a HealthScope.
+	maxOwnerDepth = 3
+
+	mapTimeout = 10 * time.Second
+)
+
+// indexKey identifies a workload independently of the API version used to
+// refer to it.
+func indexKey(apiVersion, kind, name string) string {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return apiVersion + "/" + kind + "/" + name
+	}
+	return schema.GroupKind{Group: gv.Group, Kind: kind}.String() + "/" + name
+}
+
+// indexWorkloadReferences returns the index keys of the workloads a
+// HealthScope references.
+func indexWorkloadReferences(o runtime.Object) []string {
+	hs, ok := o.(*v1alpha2.HealthScope)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(hs.Spec.WorkloadReferences))
+	for _, ref := range hs.Spec.WorkloadReferences {
+		keys = append(keys, indexKey(ref.APIVersion, ref.Kind, ref.Name))
+	}
+	return keys
+}
+
+// indexSelectedKinds returns the index keys of the kinds of workloads a
+// HealthScope's workload selector applies to, none if it has no valid one.
+func indexSelectedKinds(o runtime.Object) []string {
+	hs, ok := o.(*v1alpha2.HealthScope)
+	if !ok {
+		return nil
+	}
+	sel, err := parseWorkloadSelector(hs.GetAnnotations())
+	if err != nil || sel == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(sel.kinds))
+	for _, gvk := range sel.kinds {
+		keys = append(keys, gvk.GroupKind().String())
+	}
+	return keys
+}
+
+// mapToScopes maps a changed workload, or a resource owned by a workload
+// directly or through up to maxOwnerDepth owners, to the HealthScopes that
+// reference the workload.
+func (r *Reconciler) mapToScopes(o handler.MapObject) []reconcile.Request {
+	ctx, cancel := context.WithTimeout(context.Background(), mapTimeout)
+	defer cancel()
+
+	namespace := o.Meta.GetNamespace()
+	scopes := make(map[types.NamespacedName]bool)
+	if gvk := o.Object.GetObjectKind().GroupVersionKind(); !gvk.Empty() {
+		r.scopesReferencing(ctx, namespace, indexKey(gvk.GroupVersion().String(), gvk.Kind, o.Meta.GetName()), scopes)
+		r.scopesSelecting(ctx, namespace, gvk, o.Meta.GetLabels(), scopes)
+	}
+	if len(scopes) == 0 {
+		r.ownersToScopes(ctx, namespace, o.Meta.GetOwnerReferences(), o.Meta.GetLabels(), 1, scopes)
+	}
+
+	reqs := make([]reconcile.Request, 0, len(scopes))
+	for nn := range scopes {
+		reqs = append(reqs, reconcile.Request{NamespacedName: nn})
+	}
+	return reqs
+}
+
+// ownersToScopes adds the HealthScopes referencing the supplied owners of a
+// resource with the supplied labels, or failing that their owners, to scopes.
+// Only the owners whose kinds the controller watches anyway are read from the
+// cache, see watchedOwner, so mapping an event never starts an informer.
+func (r *Reconciler) ownersToScopes(ctx context.Context, namespace string, owners []metav1.OwnerReference,
+	l map[string]string, depth int, scopes map[types.NamespacedName]bool) {
+	for _, owner := range owners {
+		found := len(scopes)
+		r.scopesReferencing(ctx, namespace, indexKey(owner.APIVersion, owner.Kind, owner.Name), scopes)
+		if len(scopes) > found || depth >= maxOwnerDepth {
+			continue
+		}
+		obj, name := watchedOwner(owner, l)
+		if obj == nil {
+			continue
+		}
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+			continue
+		}
+		if m, ok := obj.(metav1.Object); ok {
+			r.ownersToScopes(ctx, namespace, m.GetOwnerReferences(), m.GetLabels(), depth+1, scopes)
+		}
+	}
+}
+
+// watchedOwner returns an empty Deployment or StatefulSet and the name of the
+// one that owns a resource with the supplied labels through the supplied owner
+// reference, or nil if it is owned by neither. The ReplicaSets of a Deployment
+// are not watched: the Deployment is named after the ReplicaSet without the
+// pod-template-hash label its Pods carry.
+func watchedOwner(owner metav1.OwnerReference, l map[string]string) (runtime.Object, string) {
+	if gv, err := schema.ParseGroupVersion(owner.APIVersion); err != nil || gv.Group != apps.GroupName {
+		return nil, ""
+	}
+	switch owner.Kind {
+	case "Deployment":
+		return &apps.Deployment{}, owner.Name
+	case "StatefulSet":
+		return &apps.StatefulSet{}, owner.Name
+	case "ReplicaSet":
+		hash := l[apps.DefaultDeploymentUniqueLabelKey]
+		if len(hash) != 0 && strings.HasSuffix(owner.Name, "-"+hash) {
+			return &apps.Deployment{}, strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	return nil, ""
+}
+
+// scopesReferencing adds the HealthScopes referencing the workload with the
+// supplied index key to scopes.
+func (r *Reconciler) scopesReferencing(ctx context.Context, namespace, key string, scopes map[types.NamespacedName]bool) {
+	l := &v1alpha2.HealthScopeList{}
+	if err := r.client.List(ctx, l, client.InNamespace(namespace), client.MatchingFields{workloadIndex: key}); err != nil {
+		r.log.Debug("Cannot list health scopes referencing workload", "workload", key, "error", err)
+		return
+	}
+	for _, hs := range l.Items {
+		scopes[types.NamespacedName{Namespace: hs.GetNamespace(), Name: hs.GetName()}] = true
+	}
+}
+
+// scopesSelecting adds the HealthScopes whose workload selector matches a
+// workload of the supplied kind and labels to scopes.
+func (r *Reconciler) scopesSelecting(ctx context.Context, namespace string, gvk schema.GroupVersionKind,
+	l map[string]string, scopes map[types.NamespacedName]bool) {
+	hsl := &v1alpha2.HealthScopeList{}
+	if err := r.client.List(ctx, hsl, client.InNamespace(namespace),
+		client.MatchingFields{selectorIndex: gvk.GroupKind().String()}); err != nil {
+		r.log.Debug("Cannot list health scopes selecting workload", "kind", gvk.String(), "error", err)
+		return
+	}
+	for _, hs := range hsl.Items {
+		sel, err := parseWorkloadSelector(hs.GetAnnotations())
+		if err != nil || sel == nil || !sel.matches(gvk, l) {
+			continue
+		}
+		scopes[types.NamespacedName{Namespace: hs.GetNamespace(), Name: hs.GetName()}] = true
+	}
+}
+
+// watchWorkloads starts watching the kinds of workloads the supplied scope
+// references or selects, unless they are watched already.
+func (r *Reconciler) watchWorkloads(hs *v1alpha2.HealthScope) error {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.controller == nil {
+		return nil
+	}
+	kinds := make([]schema.GroupVersionKind, 0, len(hs.Spec.WorkloadReferences))
+	for _, ref := range hs.Spec.WorkloadReferences {
+		kinds = append(kinds, ref.GroupVersionKind())
+	}
+	if sel, err := parseWorkloadSelector(hs.GetAnnotations()); err == nil && sel != nil {
+		kinds = append(kinds, sel.kinds...)
+	}
+	for _, gvk := range kinds {
+		if r.watched[gvk] {
+			continue
+		}
+		wl := &unstructured.Unstructured{}
+		wl.SetGroupVersionKind(gvk)
+		if err := r.controller.Watch(&source.Kind{Type: wl},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapToScopes)},
+			workloadChangedPredicate()); err != nil {
+			return err
+		}
+		if r.watched == nil {
+			r.watched = make(map[schema.GroupVersionKind]bool)
+		}
+		r.watched[gvk] = true
+		r.log.Info("Start to watch the workload kind", "workload GVK", gvk.String())
+	}
+	return nil
+}
+
+// scopeNamespaces tracks the namespaces that have HealthScopes, so that the
+// events of the resources in other namespaces are dropped before they are
+// mapped to scopes.
+type scopeNamespaces struct {
+	mu     sync.RWMutex
+	scopes map[string]map[string]bool
+}
+
+func newScopeNamespaces() *scopeNamespaces {
+	return &scopeNamespaces{scopes: make(map[string]map[string]bool)}
+}
+
+func (n *scopeNamespaces) observe(nn types.NamespacedName) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.scopes[nn.Namespace] == nil {
+		n.scopes[nn.Namespace] = make(map[string]bool)
+	}
+	n.scopes[nn.Namespace][nn.Name] = true
+}
+
+func (n *scopeNamespaces) forget(nn types.NamespacedName) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.scopes[nn.Namespace], nn.Name)
+	if len(n.scopes[nn.Namespace]) == 0 {
+		delete(n.scopes, nn.Namespace)
+	}
+}
+
+func (n *scopeNamespaces) has(namespace string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.scopes[namespace]) != 0
+}
+
+// inScopeNamespacePredicate only lets through the objects in the namespaces
+// that have HealthScopes. Every scope is reconciled when the controller
+// starts, so events dropped before a scope was first reconciled are not
+// missed.
+func inScopeNamespacePredicate(n *scopeNamespaces) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(e ctrlevent.CreateEvent) bool { return n.has(e.Meta.GetNamespace()) },
+		DeleteFunc:  func(e ctrlevent.DeleteEvent) bool { return n.has(e.Meta.GetNamespace()) },
+		UpdateFunc:  func(e ctrlevent.UpdateEvent) bool { return n.has(e.MetaNew.GetNamespace()) },
+		GenericFunc: func(e ctrlevent.GenericEvent) bool { return n.has(e.Meta.GetNamespace()) },
+	}
+}
+
+// scopeChangedPredicate ignores the updates of a scope that only change its
+// status or health history, which the scope's own health checks write.
+func scopeChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e ctrlevent.UpdateEvent) bool {
+			return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() ||
+				!reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels()) ||
+				!reflect.DeepEqual(withoutHistory(e.MetaOld.GetAnnotations()), withoutHistory(e.MetaNew.GetAnnotations()))
+		},
+	}
+}
+
+func withoutHistory(annotations map[string]string) map[string]string {
+	a := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		if k != AnnotationHealthHistory {
+			a[k] = v
+		}
+	}
+	return a
+}
+
+// statusChangedPredicate only lets through deletions and the updates that
+// change an object's status.
+func statusChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ctrlevent.CreateEvent) bool { return false },
+		DeleteFunc: func(ctrlevent.DeleteEvent) bool { return true },
+		UpdateFunc: func(e ctrlevent.UpdateEvent) bool {
+			return statusChanged(e.ObjectOld, e.ObjectNew)
+		},
+		GenericFunc: func(ctrlevent.GenericEvent) bool { return false },
+	}
+}
+
+// workloadChangedPredicate lets through the workloads that are created or
+// deleted, and the updates that change a workload's status or labels, which
+// may make it match a scope's workload selector.
+func workloadChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ctrlevent.CreateEvent) bool { return true },
+		DeleteFunc: func(ctrlevent.DeleteEvent) bool { return true },
+		UpdateFunc: func(e ctrlevent.UpdateEvent) bool {
+			return statusChanged(e.ObjectOld, e.ObjectNew) || !reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels())
+		},
+		GenericFunc: func(ctrlevent.GenericEvent) bool { return false },
+	}
+}
+
+func statusChanged(oldObj, newObj runtime.Object) bool {
+	return !reflect.DeepEqual(statusOf(oldObj), statusOf(newObj))
+}
+
+func statusOf(obj runtime.Object) interface{} {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		return u.UnstructuredContent()["status"]
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil
+	}
+	return m["status"]
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2020 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthscope
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("HealthScope watches", func() {
+	workload := v1alpha1.TypedReference{
+		APIVersion: v1alpha2.SchemeGroupVersion.String(),
+		Kind:       v1alpha2.ContainerizedWorkloadKind,
+		Name:       "app",
+	}
+	owner := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name}}
+	}
+	scope := &v1alpha2.HealthScope{
+		ObjectMeta: metav1.ObjectMeta{Name: "scope", Namespace: "default"},
+		Spec:       v1alpha2.HealthScopeSpec{WorkloadReferences: []v1alpha1.TypedReference{workload}},
+	}
+	selecting := &v1alpha2.HealthScope{
+		ObjectMeta: metav1.ObjectMeta{Name: "selecting", Namespace: "default", Annotations: map[string]string{
+			AnnotationWorkloadSelector: "app=shop",
+		}},
+	}
+
+	// reconciler returns a Reconciler whose cache holds the scopes and the
+	// Deployment and StatefulSet owning the Pods of the referenced workload.
+	reconciler := func() *Reconciler {
+		c := test.NewMockClient()
+		c.MockGet = func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *apps.Deployment:
+				if key.Name == "web" {
+					o.SetOwnerReferences(owner(workload.APIVersion, workload.Kind, workload.Name))
+					return nil
+				}
+			case *apps.StatefulSet:
+				if key.Name == "db" {
+					o.SetOwnerReferences(owner(workload.APIVersion, workload.Kind, workload.Name))
+					return nil
+				}
+			default:
+				Fail(fmt.Sprintf("read a %T, which the controller does not watch", obj))
+			}
+			return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+		}
+		c.MockList = func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			l := list.(*v1alpha2.HealthScopeList)
+			if lo.Namespace != scope.GetNamespace() {
+				return nil
+			}
+			// Scopes are only ever looked up through an index.
+			Expect(lo.FieldSelector).ShouldNot(BeNil())
+			for index, indexer := range map[string]func(runtime.Object) []string{
+				workloadIndex: indexWorkloadReferences,
+				selectorIndex: indexSelectedKinds,
+			} {
+				key, found := lo.FieldSelector.RequiresExactMatch(index)
+				if !found {
+					continue
+				}
+				for _, hs := range []*v1alpha2.HealthScope{scope, selecting} {
+					for _, k := range indexer(hs) {
+						if k == key {
+							l.Items = append(l.Items, *hs)
+						}
+					}
+				}
+			}
+			return nil
+		}
+		return &Reconciler{client: c, log: logging.NewNopLogger()}
+	}
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "scope"}}}
+
+	It("Test index scopes by workload independently of the API version", func() {
+		Expect(indexWorkloadReferences(scope)).Should(Equal([]string{"ContainerizedWorkload.core.oam.dev/app"}))
+		Expect(indexKey("core.oam.dev/v1alpha3", "ContainerizedWorkload", "app")).
+			Should(Equal("ContainerizedWorkload.core.oam.dev/app"))
+		Expect(indexKey("v1", "Service", "web")).Should(Equal("Service/web"))
+		Expect(indexWorkloadReferences(&corev1.Pod{})).Should(BeNil())
+	})
+
+	It("Test index scopes by the kinds their workload selector applies to", func() {
+		Expect(indexSelectedKinds(scope)).Should(BeEmpty())
+		Expect(indexSelectedKinds(selecting)).Should(Equal([]string{"ContainerizedWorkload.core.oam.dev"}))
+		pods := selecting.DeepCopy()
+		pods.SetAnnotations(map[string]string{AnnotationWorkloadSelector: "app=shop", AnnotationWorkloadKinds: "Pod.v1,Deployment.v1.apps"})
+		Expect(indexSelectedKinds(pods)).Should(Equal([]string{"Pod", "Deployment.apps"}))
+		pods.SetAnnotations(map[string]string{AnnotationWorkloadSelector: "app in shop"})
+		Expect(indexSelectedKinds(pods)).Should(BeEmpty())
+		Expect(indexSelectedKinds(&corev1.Pod{})).Should(BeNil())
+	})
+
+	It("Test only the resources in the namespaces of scopes are watched", func() {
+		n := newScopeNamespaces()
+		p := inScopeNamespacePredicate(n)
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		update := ctrlevent.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: pod, ObjectNew: pod}
+		Expect(p.Update(update)).Should(BeFalse())
+
+		n.observe(types.NamespacedName{Namespace: "default", Name: "a"})
+		n.observe(types.NamespacedName{Namespace: "default", Name: "b"})
+		n.observe(types.NamespacedName{Namespace: "other", Name: "a"})
+		Expect(p.Update(update)).Should(BeTrue())
+		Expect(p.Create(ctrlevent.CreateEvent{Meta: pod, Object: pod})).Should(BeTrue())
+		Expect(p.Delete(ctrlevent.DeleteEvent{Meta: pod, Object: pod})).Should(BeTrue())
+
+		n.forget(types.NamespacedName{Namespace: "default", Name: "a"})
+		Expect(p.Update(update)).Should(BeTrue())
+		n.forget(types.NamespacedName{Namespace: "default", Name: "b"})
+		Expect(p.Update(update)).Should(BeFalse())
+		Expect(n.has("other")).Should(BeTrue())
+	})
+
+	It("Test map a changed workload to the scopes referencing it", func() {
+		wl := &unstructured.Unstructured{}
+		wl.SetAPIVersion(workload.APIVersion)
+		wl.SetKind(workload.Kind)
+		wl.SetName("app")
+		wl.SetNamespace("default")
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: wl, Object: wl})).Should(Equal(want))
+	})
+
+	It("Test map a labelled workload to the scopes selecting it", func() {
+		wl := &unstructured.Unstructured{}
+		wl.SetAPIVersion(workload.APIVersion)
+		wl.SetKind(workload.Kind)
+		wl.SetName("cart")
+		wl.SetNamespace("default")
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: wl, Object: wl})).Should(BeEmpty())
+
+		wl.SetLabels(map[string]string{"app": "shop"})
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: wl, Object: wl})).Should(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "default", Name: "selecting"}},
+		}))
+	})
+
+	It("Test map a changed Pod through its owners to the scopes referencing its workload", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-5d4f-x2x9z",
+			Namespace:       "default",
+			Labels:          map[string]string{apps.DefaultDeploymentUniqueLabelKey: "5d4f"},
+			OwnerReferences: owner("apps/v1", "ReplicaSet", "web-5d4f"),
+		}}
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: pod, Object: pod})).Should(Equal(want))
+
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "db-0",
+			Namespace:       "default",
+			OwnerReferences: owner("apps/v1", "StatefulSet", "db"),
+		}}
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: pod, Object: pod})).Should(Equal(want))
+
+		By("Not reading the owners of kinds the controller does not watch")
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-5d4f-x2x9z",
+			Namespace:       "default",
+			OwnerReferences: owner("apps/v1", "ReplicaSet", "web-5d4f"),
+		}}
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: pod, Object: pod})).Should(BeEmpty())
+		pod.SetOwnerReferences(owner("batch/v1", "Job", "migrate"))
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: pod, Object: pod})).Should(BeEmpty())
+	})
+
+	It("Test map a resource of an unrelated workload to no scope", func() {
+		deploy := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:            "other",
+			Namespace:       "default",
+			OwnerReferences: owner(workload.APIVersion, workload.Kind, "other"),
+		}}
+		Expect(reconciler().mapToScopes(handler.MapObject{Meta: deploy, Object: deploy})).Should(BeEmpty())
+	})
+
+	It("Test only status changes trigger a health check", func() {
+		old := &apps.Deployment{Status: apps.DeploymentStatus{ReadyReplicas: 1}}
+		relabelled := old.DeepCopy()
+		relabelled.SetLabels(map[string]string{"tier": "web"})
+		Expect(statusChanged(old, relabelled)).Should(BeFalse())
+
+		degraded := old.DeepCopy()
+		degraded.Status.ReadyReplicas = 0
+		Expect(statusChanged(old, degraded)).Should(BeTrue())
+
+		wl := &unstructured.Unstructured{Object: map[string]interface{}{"status": map[string]interface{}{"phase": "a"}}}
+		changed := wl.DeepCopy()
+		changed.Object["status"] = map[string]interface{}{"phase": "b"}
+		Expect(statusChanged(wl, wl.DeepCopy())).Should(BeFalse())
+		Expect(statusChanged(wl, changed)).Should(BeTrue())
+	})
+
+	It("Test label changes of a workload trigger a health check", func() {
+		wl := &unstructured.Unstructured{}
+		relabelled := wl.DeepCopy()
+		relabelled.SetLabels(map[string]string{"app": "shop"})
+		p := workloadChangedPredicate()
+		Expect(p.Update(ctrlevent.UpdateEvent{MetaOld: wl, ObjectOld: wl, MetaNew: wl, ObjectNew: wl.DeepCopy()})).Should(BeFalse())
+		Expect(p.Update(ctrlevent.UpdateEvent{MetaOld: wl, ObjectOld: wl, MetaNew: relabelled, ObjectNew: relabelled})).Should(BeTrue())
+		Expect(p.Create(ctrlevent.CreateEvent{Meta: relabelled, Object: relabelled})).Should(BeTrue())
+	})
+})
@@ -21,14 +21,17 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/crossplane/oam-controllers/pkg/controller/core/scopes/healthscope"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/autoscalertrait"
 	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/manualscalertrait"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/scheduledscalertrait"
 	"github.com/crossplane/oam-controllers/pkg/controller/core/workloads/containerizedworkload"
 )
 
 // Setup  controllers.
 func Setup(mgr ctrl.Manager, l logging.Logger) error {
 	for _, setup := range []func(ctrl.Manager, logging.Logger) error{
-		containerizedworkload.Setup, manualscalertrait.Setup, healthscope.Setup,
+		containerizedworkload.Setup, manualscalertrait.Setup, scheduledscalertrait.Setup, autoscalertrait.Setup,
+		healthscope.Setup,
 	} {
 		if err := setup(mgr, l); err != nil {
 			return err
@@ -0,0 +1,214 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscalertrait
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam/util"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
+)
+
+// Reconcile error strings.
+const (
+	errLocateWorkload      = traitutil.ErrLocateWorkload
+	errFetchChildResources = traitutil.ErrFetchChildResources
+	errNoScalableResource  = "cannot locate any scalable resource"
+	errRenderAutoscaler    = "cannot render the horizontal pod autoscaler"
+	errApplyAutoscaler     = "cannot apply the horizontal pod autoscaler"
+	errGCAutoscaler        = "cannot garbage collect the horizontal pod autoscalers"
+	errUpdateStatus        = "cannot update the autoscaler trait status"
+)
+
+// Setup adds a controller that reconciles AutoscalerTrait.
+func Setup(mgr ctrl.Manager, log logging.Logger) error {
+	reconciler := Reconciler{
+		Client:          mgr.GetClient(),
+		DiscoveryClient: *discovery.NewDiscoveryClientForConfigOrDie(mgr.GetConfig()),
+		log:             ctrl.Log.WithName("AutoscalerTrait"),
+		record:          event.NewAPIRecorder(mgr.GetEventRecorderFor("AutoscalerTrait")),
+		Scheme:          mgr.GetScheme(),
+	}
+	return reconciler.SetupWithManager(mgr)
+}
+
+// Reconciler reconciles an AutoscalerTrait object
+type Reconciler struct {
+	client.Client
+	discovery.DiscoveryClient
+	log    logr.Logger
+	record event.Recorder
+	Scheme *runtime.Scheme
+}
+
+// Reconcile to reconcile autoscaler trait.
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=autoscalertraits,verbs=get;list;watch
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=autoscalertraits/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=containerizedworkloads,verbs=get;list;
+// +kubebuilder:rbac:groups=core.oam.dev,resources=workloaddefinition,verbs=get;list;
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	mLog := r.log.WithValues("autoscaler trait", req.NamespacedName)
+
+	mLog.Info("Reconcile autoscaler trait")
+
+	var trait v1alpha1.AutoscalerTrait
+	if err := r.Get(ctx, req.NamespacedName, &trait); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// find the resource object to record the event to, default is the parent appConfig.
+	eventObj, err := util.LocateParentAppConfig(ctx, r.Client, &trait)
+	if eventObj == nil {
+		// fallback to the trait itself
+		mLog.Error(err, "autoscaler", trait.Name)
+		eventObj = &trait
+	}
+
+	// Fetch the workload instance this trait is referring to
+	workload, result, err := traitutil.FetchWorkload(ctx, r, mLog, &trait)
+	if err != nil {
+		r.record.Event(eventObj, event.Warning(errLocateWorkload, err))
+		return result, err
+	}
+	if workload == nil {
+		return result, nil
+	}
+
+	// Locate the child resources that we know how to scale the same way the manual scaler does
+	resources, err := traitutil.FetchScaleCandidates(ctx, mLog, r, workload)
+	if err != nil {
+		mLog.Error(err, "Error while fetching the workload child resources", "workload", workload.UnstructuredContent())
+		r.record.Event(eventObj, event.Warning(errFetchChildResources, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait,
+			cpv1alpha1.ReconcileError(errors.Wrap(err, errFetchChildResources)))
+	}
+	document, err := traitutil.FetchOpenAPIDocument(&r.DiscoveryClient)
+	if err != nil {
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait, cpv1alpha1.ReconcileError(err))
+	}
+	var scalable []*unstructured.Unstructured
+	for _, res := range resources {
+		if traitutil.LocateReplicaField(document, res) {
+			scalable = append(scalable, res)
+		}
+	}
+	if len(scalable) == 0 {
+		mLog.Info("Cannot locate any resource", "total resources", len(resources))
+		r.record.Event(eventObj, event.Warning(errNoScalableResource, errors.New(errNoScalableResource)))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait,
+			cpv1alpha1.ReconcileError(errors.New(errNoScalableResource)))
+	}
+
+	// render and apply an autoscaler for each of the scalable resources
+	applyOpts := []client.PatchOption{client.ForceOwnership, client.FieldOwner(fieldManager(&trait))}
+	applied := make(map[types.UID]bool, len(scalable))
+	statuses := make([]v1alpha1.AutoscaledResource, 0, len(scalable))
+	for _, res := range scalable {
+		hpa, err := r.renderAutoscaler(&trait, res)
+		if err != nil {
+			r.record.Event(eventObj, event.Warning(errRenderAutoscaler, err))
+			return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait,
+				cpv1alpha1.ReconcileError(errors.Wrap(err, errRenderAutoscaler)))
+		}
+		if err := r.Patch(ctx, hpa, client.Apply, applyOpts...); err != nil {
+			mLog.Error(err, "Failed to apply a horizontal pod autoscaler", "name", hpa.Name)
+			r.record.Event(eventObj, event.Warning(errApplyAutoscaler, err))
+			return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait,
+				cpv1alpha1.ReconcileError(errors.Wrap(err, errApplyAutoscaler)))
+		}
+		mLog.Info("Successfully applied a horizontal pod autoscaler", "name", hpa.Name,
+			"target GVK", res.GroupVersionKind().String(), "target name", res.GetName())
+		applied[hpa.GetUID()] = true
+		statuses = append(statuses, autoscaledResource(res, hpa))
+	}
+	// garbage collect the autoscalers of the resources that are gone
+	if err := r.cleanupAutoscalers(ctx, mLog, &trait, applied); err != nil {
+		mLog.Error(err, "Failed to garbage collect the horizontal pod autoscalers")
+		r.record.Event(eventObj, event.Warning(errGCAutoscaler, err))
+	}
+	if changed(trait.Status.Resources, statuses) {
+		r.record.Event(eventObj, event.Normal("Autoscaler applied",
+			fmt.Sprintf("Trait `%s` successfully applied %d horizontal pod autoscalers", trait.Name, len(statuses))))
+	}
+
+	// the autoscalers are owned by us, we will be back here when their status changes
+	trait.Status.Resources = statuses
+	trait.SetConditions(cpv1alpha1.ReconcileSuccess())
+	return ctrl.Result{}, errors.Wrap(r.Status().Update(ctx, &trait), errUpdateStatus)
+}
+
+// delete the autoscalers that we created but are not needed anymore
+func (r *Reconciler) cleanupAutoscalers(ctx context.Context, mLog logr.Logger, trait *v1alpha1.AutoscalerTrait,
+	applied map[types.UID]bool) error {
+	var hpas autoscalingv2beta2.HorizontalPodAutoscalerList
+	if err := r.List(ctx, &hpas, client.InNamespace(trait.GetNamespace())); err != nil {
+		return err
+	}
+	for i := range hpas.Items {
+		hpa := &hpas.Items[i]
+		if applied[hpa.GetUID()] || !metav1.IsControlledBy(hpa, trait) {
+			continue
+		}
+		mLog.Info("Found an orphaned horizontal pod autoscaler", "name", hpa.Name, "orphaned UID", hpa.UID)
+		if err := r.Delete(ctx, hpa); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		mLog.Info("Removed an orphaned horizontal pod autoscaler", "name", hpa.Name, "orphaned UID", hpa.UID)
+	}
+	return nil
+}
+
+// changed checks if the set of autoscaled resources changed
+func changed(old, new []v1alpha1.AutoscaledResource) bool {
+	if len(old) != len(new) {
+		return true
+	}
+	for i := range old {
+		if old[i].ResourceReference.UID != new[i].ResourceReference.UID ||
+			old[i].HorizontalPodAutoscaler != new[i].HorizontalPodAutoscaler {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWithManager to setup k8s controller.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	name := "oam/" + strings.ToLower(v1alpha1.AutoscalerTraitKind)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&v1alpha1.AutoscalerTrait{}).
+		Owns(&autoscalingv2beta2.HorizontalPodAutoscaler{}).
+		Complete(r)
+}
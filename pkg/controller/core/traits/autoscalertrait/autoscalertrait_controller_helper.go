@@ -0,0 +1,128 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscalertrait
+
+import (
+	"strings"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+// create a horizontal pod autoscaler for a scalable resource
+func (r *Reconciler) renderAutoscaler(trait *v1alpha1.AutoscalerTrait,
+	res *unstructured.Unstructured) (*autoscalingv2beta2.HorizontalPodAutoscaler, error) {
+	hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: autoscalingv2beta2.SchemeGroupVersion.String(),
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      autoscalerName(trait, res),
+			Namespace: trait.GetNamespace(),
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: res.GetAPIVersion(),
+				Kind:       res.GetKind(),
+				Name:       res.GetName(),
+			},
+			MinReplicas: trait.Spec.MinReplicas,
+			MaxReplicas: trait.Spec.MaxReplicas,
+			Metrics:     renderMetrics(trait.Spec),
+		},
+	}
+	// set the controller reference so that we can watch this autoscaler and it will be deleted automatically
+	if err := ctrl.SetControllerReference(trait, hpa, r.Scheme); err != nil {
+		return nil, err
+	}
+	return hpa, nil
+}
+
+// fieldManager is the stable name the trait uses to own the fields it applies
+func fieldManager(trait *v1alpha1.AutoscalerTrait) string {
+	return strings.ToLower(v1alpha1.AutoscalerTraitKind) + "/" + trait.GetName()
+}
+
+// autoscalerName is unique per trait and scaled resource
+func autoscalerName(trait *v1alpha1.AutoscalerTrait, res *unstructured.Unstructured) string {
+	return trait.GetName() + "-" + strings.ToLower(res.GetKind()) + "-" + res.GetName()
+}
+
+// renderMetrics turns the targets of the trait into autoscaler metrics, the autoscaler defaults to the CPU
+// utilization if there is none
+func renderMetrics(spec v1alpha1.AutoscalerTraitSpec) []autoscalingv2beta2.MetricSpec {
+	var metrics []autoscalingv2beta2.MetricSpec
+	if spec.TargetCPUUtilization != nil {
+		metrics = append(metrics, resourceMetric(corev1.ResourceCPU, *spec.TargetCPUUtilization))
+	}
+	if spec.TargetMemoryUtilization != nil {
+		metrics = append(metrics, resourceMetric(corev1.ResourceMemory, *spec.TargetMemoryUtilization))
+	}
+	for _, cm := range spec.CustomMetrics {
+		value := cm.TargetAverageValue.DeepCopy()
+		metrics = append(metrics, autoscalingv2beta2.MetricSpec{
+			Type: autoscalingv2beta2.PodsMetricSourceType,
+			Pods: &autoscalingv2beta2.PodsMetricSource{
+				Metric: autoscalingv2beta2.MetricIdentifier{
+					Name:     cm.Name,
+					Selector: cm.Selector,
+				},
+				Target: autoscalingv2beta2.MetricTarget{
+					Type:         autoscalingv2beta2.AverageValueMetricType,
+					AverageValue: &value,
+				},
+			},
+		})
+	}
+	return metrics
+}
+
+func resourceMetric(name corev1.ResourceName, utilization int32) autoscalingv2beta2.MetricSpec {
+	u := utilization
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &u,
+			},
+		},
+	}
+}
+
+// autoscaledResource reports the replicas of a resource from the status of its autoscaler
+func autoscaledResource(res *unstructured.Unstructured,
+	hpa *autoscalingv2beta2.HorizontalPodAutoscaler) v1alpha1.AutoscaledResource {
+	return v1alpha1.AutoscaledResource{
+		ResourceReference: cpv1alpha1.TypedReference{
+			APIVersion: res.GetAPIVersion(),
+			Kind:       res.GetKind(),
+			Name:       res.GetName(),
+			UID:        res.GetUID(),
+		},
+		HorizontalPodAutoscaler: hpa.GetName(),
+		CurrentReplicas:         hpa.Status.CurrentReplicas,
+		DesiredReplicas:         hpa.Status.DesiredReplicas,
+	}
+}
@@ -0,0 +1,103 @@
+package autoscalertrait
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+var _ = Describe("Autoscaler Trait render Test", func() {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.SchemeBuilder.AddToScheme(scheme)
+	reconciler := &Reconciler{
+		log:    ctrl.Log.WithName("AutoscalerTraitReconciler"),
+		Scheme: scheme,
+	}
+	minReplicas := int32(2)
+	cpu := int32(70)
+	memory := int32(80)
+	trait := &v1alpha1.AutoscalerTrait{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-trait",
+			Namespace: "default",
+			UID:       "trait-uid",
+		},
+		Spec: v1alpha1.AutoscalerTraitSpec{
+			MinReplicas:             &minReplicas,
+			MaxReplicas:             10,
+			TargetCPUUtilization:    &cpu,
+			TargetMemoryUtilization: &memory,
+			CustomMetrics: []v1alpha1.CustomMetricTarget{{
+				Name:               "requests_per_second",
+				TargetAverageValue: resource.MustParse("100"),
+			}},
+		},
+	}
+	res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	res.SetAPIVersion("apps/v1")
+	res.SetKind("Deployment")
+	res.SetName("example-deploy")
+	res.SetUID("deploy-uid")
+
+	It("Test render a horizontal pod autoscaler", func() {
+		hpa, err := reconciler.renderAutoscaler(trait, res)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(hpa.Name).Should(Equal("example-trait-deployment-example-deploy"))
+		Expect(hpa.Namespace).Should(Equal("default"))
+		Expect(metav1.IsControlledBy(hpa, trait)).Should(BeTrue())
+		Expect(hpa.Spec.ScaleTargetRef).Should(Equal(autoscalingv2beta2.CrossVersionObjectReference{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "example-deploy",
+		}))
+		Expect(*hpa.Spec.MinReplicas).Should(BeEquivalentTo(2))
+		Expect(hpa.Spec.MaxReplicas).Should(BeEquivalentTo(10))
+		Expect(hpa.Spec.Metrics).Should(HaveLen(3))
+		Expect(hpa.Spec.Metrics[0].Resource.Name).Should(Equal(corev1.ResourceCPU))
+		Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).Should(BeEquivalentTo(70))
+		Expect(hpa.Spec.Metrics[1].Resource.Name).Should(Equal(corev1.ResourceMemory))
+		Expect(*hpa.Spec.Metrics[1].Resource.Target.AverageUtilization).Should(BeEquivalentTo(80))
+		Expect(hpa.Spec.Metrics[2].Type).Should(Equal(autoscalingv2beta2.PodsMetricSourceType))
+		Expect(hpa.Spec.Metrics[2].Pods.Metric.Name).Should(Equal("requests_per_second"))
+		Expect(hpa.Spec.Metrics[2].Pods.Target.AverageValue.String()).Should(Equal("100"))
+	})
+
+	It("Test own the applied fields by a field manager named after the trait", func() {
+		Expect(fieldManager(trait)).Should(Equal("autoscalertrait/example-trait"))
+	})
+
+	It("Test leave the metrics to the autoscaler defaults", func() {
+		Expect(renderMetrics(v1alpha1.AutoscalerTraitSpec{MaxReplicas: 3})).Should(BeEmpty())
+	})
+
+	It("Test report the replicas from the autoscaler status", func() {
+		hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-hpa"},
+			Status: autoscalingv2beta2.HorizontalPodAutoscalerStatus{
+				CurrentReplicas: 3,
+				DesiredReplicas: 5,
+			},
+		}
+		Expect(autoscaledResource(res, hpa)).Should(Equal(v1alpha1.AutoscaledResource{
+			ResourceReference: runtimev1alpha1.TypedReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "example-deploy",
+				UID:        "deploy-uid",
+			},
+			HorizontalPodAutoscaler: "example-hpa",
+			CurrentReplicas:         3,
+			DesiredReplicas:         5,
+		}))
+	})
+})
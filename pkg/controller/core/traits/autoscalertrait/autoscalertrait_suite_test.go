@@ -0,0 +1,13 @@
+package autoscalertrait
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAutoscalertrait(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Autoscalertrait Suite")
+}
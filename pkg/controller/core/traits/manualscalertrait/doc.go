@@ -0,0 +1,28 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package manualscalertrait implements the ManualScalerTrait controller, which scales the workload a trait refers
+// to, or the child resources of that workload.
+//
+// The ManualScalerTrait API belongs to the OAM runtime, so the child resources a trait scales are chosen with
+// annotations in the manualscalertrait.extend.oam.dev domain rather than with spec fields:
+//
+//	target-kind      the kind of the child resources to scale, e.g. Deployment
+//	target-name      a shell pattern their names match, e.g. *-worker
+//	target-selector  a label selector they match, e.g. tier=api
+//
+// Every child resource is scaled unless they are set. The validating webhook of ManualScalerTraits rejects invalid
+// values, see ValidateAnnotations.
+package manualscalertrait
@@ -0,0 +1,98 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manualscalertrait
+
+import (
+	"context"
+	"time"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
+)
+
+// TypeReplicasWithinBounds indicates if the replica count of a trait satisfies the replica bounds policies
+// that apply to it
+const TypeReplicasWithinBounds cpv1alpha1.ConditionType = "ReplicasWithinBounds"
+
+// Reasons a trait's replicas are or are not within bounds.
+const (
+	ReasonReplicasWithinBounds   cpv1alpha1.ConditionReason = "ReplicasWithinBounds"
+	ReasonReplicasOutOfBounds    cpv1alpha1.ConditionReason = "ReplicasOutOfBounds"
+	ReasonReplicaBoundsUnchecked cpv1alpha1.ConditionReason = "ReplicaBoundsUnchecked"
+	ReasonReplicaBoundsConflict  cpv1alpha1.ConditionReason = "ReplicaBoundsConflict"
+)
+
+// Bounds error strings.
+const (
+	errReplicasOutOfBounds = "the replica count violates a replica bounds policy"
+)
+
+const mapTimeout = 10 * time.Second
+
+// replicaBoundsCondition reports whether the replicas are within the bounds, err is the violation if any
+func replicaBoundsCondition(bounds traitutil.ReplicaBounds, err error) cpv1alpha1.Condition {
+	c := cpv1alpha1.Condition{
+		Type:               TypeReplicasWithinBounds,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReplicasWithinBounds,
+		Message:            bounds.String(),
+	}
+	if err != nil {
+		c.Status = corev1.ConditionFalse
+		c.Reason = ReasonReplicasOutOfBounds
+		c.Message = err.Error()
+	}
+	if bounds.Conflict() != nil {
+		c.Reason = ReasonReplicaBoundsConflict
+	}
+	return c
+}
+
+// replicaBoundsUncheckedCondition reports that the policies could not be evaluated
+func replicaBoundsUncheckedCondition(err error) cpv1alpha1.Condition {
+	return cpv1alpha1.Condition{
+		Type:               TypeReplicasWithinBounds,
+		Status:             corev1.ConditionUnknown,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReplicaBoundsUnchecked,
+		Message:            err.Error(),
+	}
+}
+
+// mapPolicyToTraits re-checks all the traits in the namespace of a replica bounds policy that changed
+func (r *Reconciler) mapPolicyToTraits(o handler.MapObject) []reconcile.Request {
+	ctx, cancel := context.WithTimeout(context.Background(), mapTimeout)
+	defer cancel()
+	l := &oamv1alpha2.ManualScalerTraitList{}
+	if err := r.List(ctx, l, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.log.Error(err, "Cannot list the traits a replica bounds policy applies to", "policy", o.Meta.GetName())
+		return nil
+	}
+	reqs := make([]reconcile.Request, 0, len(l.Items))
+	for _, t := range l.Items {
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: t.GetNamespace(), Name: t.GetName()}})
+	}
+	return reqs
+}
@@ -0,0 +1,118 @@
+package manualscalertrait
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
+)
+
+var _ = Describe("Manualscalar Trait replica bounds Test", func() {
+	int32Ptr := func(i int32) *int32 { return &i }
+	policy := func(name string, min, max *int32, selector map[string]string) v1alpha1.ReplicaBoundsPolicy {
+		p := v1alpha1.ReplicaBoundsPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       v1alpha1.ReplicaBoundsPolicySpec{MinReplicas: min, MaxReplicas: max},
+		}
+		if selector != nil {
+			p.Spec.TraitSelector = &metav1.LabelSelector{MatchLabels: selector}
+		}
+		return p
+	}
+
+	It("Test the tightest bounds of the policies that apply", func() {
+		policies := []v1alpha1.ReplicaBoundsPolicy{
+			policy("namespace", int32Ptr(1), int32Ptr(20), nil),
+			policy("api", int32Ptr(2), int32Ptr(10), map[string]string{"tier": "api"}),
+			policy("worker", nil, int32Ptr(5), map[string]string{"tier": "worker"}),
+		}
+		b, err := traitutil.ReplicaBoundsOf(policies, map[string]string{"tier": "api"})
+		Expect(err).Should(BeNil())
+		Expect(b.Policies).Should(Equal([]string{"api", "namespace"}))
+		Expect(*b.Min).Should(BeEquivalentTo(2))
+		Expect(b.MinPolicy).Should(Equal("api"))
+		Expect(*b.Max).Should(BeEquivalentTo(10))
+		Expect(b.MaxPolicy).Should(Equal("api"))
+		Expect(b.String()).Should(Equal("min 2 (api), max 10 (api); policies: [api, namespace]"))
+
+		Expect(b.Check(2)).Should(BeNil())
+		Expect(b.Check(10)).Should(BeNil())
+		Expect(b.Check(1)).Should(MatchError("1 replicas is below the minimum of 2 allowed by replica bounds policy api"))
+		Expect(b.Check(500)).Should(MatchError("500 replicas is above the maximum of 10 allowed by replica bounds policy api"))
+
+		b, err = traitutil.ReplicaBoundsOf(policies, nil)
+		Expect(err).Should(BeNil())
+		Expect(b.Policies).Should(Equal([]string{"namespace"}))
+		Expect(b.Check(20)).Should(BeNil())
+
+		b, err = traitutil.ReplicaBoundsOf(nil, nil)
+		Expect(err).Should(BeNil())
+		Expect(b.Check(500)).Should(BeNil())
+		Expect(b.String()).Should(Equal("no replica bounds policy applies"))
+
+		invalid := policy("invalid", nil, nil, nil)
+		invalid.Spec.TraitSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "tier", Operator: "Unknown"},
+		}}
+		_, err = traitutil.ReplicaBoundsOf([]v1alpha1.ReplicaBoundsPolicy{invalid}, nil)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Test the replica bounds condition", func() {
+		b, _ := traitutil.ReplicaBoundsOf([]v1alpha1.ReplicaBoundsPolicy{policy("limits", nil, int32Ptr(5), nil)}, nil)
+		c := replicaBoundsCondition(b, nil)
+		Expect(c.Type).Should(Equal(TypeReplicasWithinBounds))
+		Expect(c.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(c.Message).Should(Equal("max 5 (limits); policies: [limits]"))
+
+		c = replicaBoundsCondition(b, b.Check(6))
+		Expect(c.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(c.Reason).Should(Equal(ReasonReplicasOutOfBounds))
+		Expect(c.Message).Should(Equal("6 replicas is above the maximum of 5 allowed by replica bounds policy limits"))
+
+		By("Reporting the policies that allow no replica count at all")
+		b, _ = traitutil.ReplicaBoundsOf([]v1alpha1.ReplicaBoundsPolicy{
+			policy("limits", nil, int32Ptr(5), nil), policy("floor", int32Ptr(8), nil, nil),
+		}, nil)
+		c = replicaBoundsCondition(b, b.Check(6))
+		Expect(c.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(c.Reason).Should(Equal(ReasonReplicaBoundsConflict))
+		Expect(c.Message).Should(Equal("replica bounds policies conflict, the minimum of 8 of policy floor is above " +
+			"the maximum of 5 of policy limits"))
+	})
+
+	It("Test a policy change re-checks the traits in its namespace", func() {
+		r := &Reconciler{
+			log: logf.Log,
+			Client: &test.MockClient{MockList: func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+				lo := &client.ListOptions{}
+				lo.ApplyOptions(opts)
+				Expect(lo.Namespace).Should(Equal("default"))
+				l := list.(*oamv1alpha2.ManualScalerTraitList)
+				l.Items = []oamv1alpha2.ManualScalerTrait{
+					{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}},
+					{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "b"}},
+				}
+				return nil
+			}},
+		}
+		p := policy("limits", nil, int32Ptr(5), nil)
+		reqs := r.mapPolicyToTraits(handler.MapObject{Meta: &p, Object: &p})
+		Expect(reqs).Should(HaveLen(2))
+		Expect(reqs[0].NamespacedName).Should(Equal(types.NamespacedName{Namespace: "default", Name: "a"}))
+		Expect(reqs[1].NamespacedName).Should(Equal(types.NamespacedName{Namespace: "default", Name: "b"}))
+	})
+})
@@ -19,34 +19,47 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
-	cpmeta "github.com/crossplane/crossplane-runtime/pkg/meta"
 	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam"
 	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam/util"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
-	"k8s.io/kube-openapi/pkg/util/proto"
-	"k8s.io/kubectl/pkg/explain"
-	"k8s.io/kubectl/pkg/util/openapi"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrlevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
 )
 
 // Reconcile error strings.
 const (
-	errLocateWorkload      = "cannot find workload"
-	errFetchChildResources = "failed to fetch workload child resources"
-	errQueryOpenAPI        = "failed to query openAPI"
+	errLocateWorkload      = traitutil.ErrLocateWorkload
+	errFetchChildResources = traitutil.ErrFetchChildResources
 	errScaleResource       = "cannot scale the resource"
+	errWatchResource       = "cannot watch the scaled resource"
+	errSelectTargets       = "cannot select the resources to scale"
+	errReplicasConflict    = "the replicas of the resource is managed by another field manager"
+)
+
+// Reconcile event reasons.
+const (
+	reasonDriftCorrected = "Manual scalar drift corrected"
 )
 
 // Setup adds a controller that reconciles ContainerizedWorkload.
@@ -68,6 +81,11 @@ type Reconciler struct {
 	log    logr.Logger
 	record event.Recorder
 	Scheme *runtime.Scheme
+
+	// controller and watched are used to lazily watch the kinds of the resources we scaled
+	controller controller.Controller
+	watchLock  sync.Mutex
+	watched    map[schema.GroupVersionKind]bool
 }
 
 // Reconcile to reconcile manual trait.
@@ -77,6 +95,9 @@ type Reconciler struct {
 // +kubebuilder:rbac:groups=core.oam.dev,resources=containerizedworkloads/status,verbs=get;
 // +kubebuilder:rbac:groups=core.oam.dev,resources=workloaddefinition,verbs=get;list;
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch;delete
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=replicaboundspolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=scalereports,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=scalereports/status,verbs=get;update;patch
 func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	mLog := r.log.WithValues("manualscalar trait", req.NamespacedName)
@@ -104,134 +125,273 @@ func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 
 	// Fetch the child resources list from the corresponding workload
-	resources, err := util.FetchWorkloadChildResources(ctx, mLog, r, workload)
+	resources, err := traitutil.FetchScaleCandidates(ctx, mLog, r, workload)
 	if err != nil {
 		mLog.Error(err, "Error while fetching the workload child resources", "workload", workload.UnstructuredContent())
 		r.record.Event(eventObj, event.Warning(errFetchChildResources, err))
 		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar,
-			cpv1alpha1.ReconcileError(fmt.Errorf(errFetchChildResources)))
+			cpv1alpha1.ReconcileError(fmt.Errorf(errFetchChildResources)),
+			targetsNotReadyCondition(errors.Wrap(err, errFetchChildResources)))
+	}
+	// Only scale the child resources that are chosen by the target selector
+	sel, err := parseTargetSelector(manualScalar.GetAnnotations())
+	if err != nil {
+		r.record.Event(eventObj, event.Warning(errSelectTargets, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar,
+			cpv1alpha1.ReconcileError(errors.Wrap(err, errSelectTargets)),
+			targetsNotReadyCondition(errors.Wrap(err, errSelectTargets)))
 	}
-	// include the workload itself if there is no child resources
-	if len(resources) == 0 {
-		resources = append(resources, workload)
+	matched, skipped := selectTargets(sel, resources)
+	selected := targetsSelectedCondition(matched, skipped)
+	if len(matched) == 0 {
+		mLog.Info("The target selector does not match any resource", "total resources", len(resources))
+		r.record.Event(eventObj, event.Warning(errSelectTargets, errors.New(errNoTargetMatched)))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar,
+			cpv1alpha1.ReconcileError(errors.New(errNoTargetMatched)), selected,
+			targetsNotReadyCondition(errors.New(errNoTargetMatched)))
+	}
+	// Re-check the replica bounds policies, they may have changed since the trait was admitted
+	bounds, err := traitutil.FetchReplicaBounds(ctx, r, &manualScalar)
+	if err != nil {
+		mLog.Error(err, "Cannot check the replica bounds policies")
+		r.record.Event(eventObj, event.Warning(traitutil.ErrListReplicaBounds, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar,
+			cpv1alpha1.ReconcileError(err), selected, replicaBoundsUncheckedCondition(err), targetsNotReadyCondition(err))
 	}
+	if err := bounds.Check(manualScalar.Spec.ReplicaCount); err != nil {
+		mLog.Info("The replica count is out of bounds", "replicaCount", manualScalar.Spec.ReplicaCount,
+			"bounds", bounds.String())
+		r.record.Event(eventObj, event.Warning(errReplicasOutOfBounds, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar,
+			cpv1alpha1.ReconcileError(errors.Wrap(err, errReplicasOutOfBounds)), selected, replicaBoundsCondition(bounds, err),
+			targetsNotReadyCondition(err))
+	}
+	withinBounds := replicaBoundsCondition(bounds, nil)
 	// Scale the child resources that we know how to scale
-	result, err = r.scaleResources(ctx, mLog, manualScalar, resources)
+	targets, changed, result, err := r.scaleResources(ctx, mLog, eventObj, manualScalar, matched)
 	if err != nil {
 		r.record.Event(eventObj, event.Warning(errScaleResource, err))
 		return result, err
 	}
-	r.record.Event(eventObj, event.Normal("Manual scalar applied",
-		fmt.Sprintf("Trait `%s` successfully scaled a resouce to %d instances",
-			manualScalar.Name, manualScalar.Spec.ReplicaCount)))
-	return ctrl.Result{}, util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileSuccess())
+	if len(targets) == 0 {
+		// the failure is already recorded in the trait's condition
+		return result, nil
+	}
+	// the scaled resources re-trigger a reconcile whenever their ready replicas change, only record the
+	// event when the replicas of a resource are actually changed
+	if changed {
+		r.record.Event(eventObj, event.Normal("Manual scalar applied",
+			fmt.Sprintf("Trait `%s` successfully scaled a resouce to %d instances",
+				manualScalar.Name, manualScalar.Spec.ReplicaCount)))
+	}
+	ready := targetsReadyCondition(manualScalar, targets)
+	if err := r.reportTargets(ctx, manualScalar, targets, ready); err != nil {
+		mLog.Error(err, "Failed to report the scaled resources")
+		r.record.Event(eventObj, event.Warning(errReportTargets, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(err),
+			selected, withinBounds, ready)
+	}
+	// the scaled resources are watched, we will be back here when their ready replicas change
+	return ctrl.Result{}, util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileSuccess(),
+		selected, withinBounds, ready)
 }
 
-// TODO (rz): this is actually pretty generic, we can move this out into a common Trait structure with client and log
+// fetchWorkload fetches the workload the trait is referring to
 func (r *Reconciler) fetchWorkload(ctx context.Context, mLog logr.Logger,
 	oamTrait oam.Trait) (*unstructured.Unstructured, ctrl.Result, error) {
-	var workload unstructured.Unstructured
-	workload.SetAPIVersion(oamTrait.GetWorkloadReference().APIVersion)
-	workload.SetKind(oamTrait.GetWorkloadReference().Kind)
-	wn := client.ObjectKey{Name: oamTrait.GetWorkloadReference().Name, Namespace: oamTrait.GetNamespace()}
-	if err := r.Get(ctx, wn, &workload); err != nil {
-		mLog.Error(err, "Workload not find", "kind", oamTrait.GetWorkloadReference().Kind,
-			"workload name", oamTrait.GetWorkloadReference().Name)
-		return nil, util.ReconcileWaitResult,
-			util.PatchCondition(ctx, r, oamTrait, cpv1alpha1.ReconcileError(errors.Wrap(err, errLocateWorkload)))
-	}
-	mLog.Info("Get the workload the trait is pointing to", "workload name", workload.GetName(),
-		"workload APIVersion", workload.GetAPIVersion(), "workload Kind", workload.GetKind(), "workload UID",
-		workload.GetUID())
-	return &workload, ctrl.Result{}, nil
+	return traitutil.FetchWorkload(ctx, r, mLog, oamTrait, targetsNotReadyCondition(errors.New(errLocateWorkload)))
 }
 
-// identify child resources and scale them
-func (r *Reconciler) scaleResources(ctx context.Context, mLog logr.Logger,
-	manualScalar oamv1alpha2.ManualScalerTrait, resources []*unstructured.Unstructured) (ctrl.Result, error) {
+// identify child resources and scale them, return the resources that are scaled and whether the replicas of
+// any of them changed
+func (r *Reconciler) scaleResources(ctx context.Context, mLog logr.Logger, eventObj oam.Object,
+	manualScalar oamv1alpha2.ManualScalerTrait, resources []*unstructured.Unstructured) ([]extendv1alpha1.ScaledTarget,
+	bool, ctrl.Result, error) {
 	// scale all the resources that we can scale
-	isController := false
-	bod := true
-	found := false
-	// Update owner references
-	ownerRef := metav1.OwnerReference{
-		APIVersion:         manualScalar.APIVersion,
-		Kind:               manualScalar.Kind,
-		Name:               manualScalar.Name,
-		UID:                manualScalar.UID,
-		Controller:         &isController,
-		BlockOwnerDeletion: &bod,
-	}
+	var targets []extendv1alpha1.ScaledTarget
+	changed := false
+	ownerRef := traitOwnerReference(manualScalar)
 	// prepare for openApi schema check
-	schemaDoc, err := r.DiscoveryClient.OpenAPISchema()
+	document, err := traitutil.FetchOpenAPIDocument(&r.DiscoveryClient)
 	if err != nil {
-		return util.ReconcileWaitResult,
-			util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errQueryOpenAPI)))
-	}
-	document, err := openapi.NewOpenAPIData(schemaDoc)
-	if err != nil {
-		return util.ReconcileWaitResult,
-			util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errQueryOpenAPI)))
+		return nil, false, util.ReconcileWaitResult,
+			util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(err), targetsNotReadyCondition(err))
 	}
 	for _, res := range resources {
-		if locateReplicaField(document, res) {
-			found = true
-			resPatch := client.MergeFrom(res.DeepCopyObject())
+		if traitutil.LocateReplicaField(document, res) {
 			mLog.Info("Get the resource the trait is going to modify",
 				"resource name", res.GetName(), "UID", res.GetUID())
-			cpmeta.AddOwnerReference(res, ownerRef)
-			unstructured.SetNestedField(res.Object, int64(manualScalar.Spec.ReplicaCount), "spec", "replicas")
-			// merge patch to scale the resource
-			if err := r.Patch(ctx, res, resPatch, client.FieldOwner(manualScalar.GetUID())); err != nil {
+			changed = changed || replicasDiffer(res, manualScalar.Spec.ReplicaCount)
+			scaled, drifted, current, err := r.applyReplicas(ctx, res, ownerRef, manualScalar)
+			if err != nil {
+				if apierrors.IsConflict(err) {
+					mLog.Error(err, "The replicas of a resource the trait never scaled is managed by someone else",
+						"resource name", res.GetName(), "UID", res.GetUID())
+					r.record.Event(eventObj, event.Warning(errReplicasConflict, err))
+					return nil, false, util.ReconcileWaitResult,
+						util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errReplicasConflict)),
+							targetsNotReadyCondition(errors.Wrap(err, errReplicasConflict)))
+				}
 				mLog.Error(err, "Failed to scale a resource")
-				return util.ReconcileWaitResult,
-					util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errScaleResource)))
+				return nil, false, util.ReconcileWaitResult,
+					util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errScaleResource)),
+						targetsNotReadyCondition(errors.Wrap(err, errScaleResource)))
 			}
+			res = scaled
 			mLog.Info("Successfully scaled a resource", "resource GVK", res.GroupVersionKind().String(),
 				"res UID", res.GetUID(), "target replica", manualScalar.Spec.ReplicaCount)
+			if drifted {
+				r.record.Event(eventObj, event.Normal(reasonDriftCorrected,
+					fmt.Sprintf("Trait `%s` restored %s `%s` from %d to %d instances", manualScalar.Name,
+						res.GetKind(), res.GetName(), current, manualScalar.Spec.ReplicaCount)))
+			}
+			// watch the resource so that we notice when someone else changes its replicas
+			if err := r.watchResource(res.GroupVersionKind()); err != nil {
+				mLog.Error(err, "Failed to watch a scaled resource", "resource GVK", res.GroupVersionKind().String())
+				return nil, false, util.ReconcileWaitResult,
+					util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(errors.Wrap(err, errWatchResource)),
+						targetsNotReadyCondition(errors.Wrap(err, errWatchResource)))
+			}
+			targets = append(targets, newScaledTarget(res, manualScalar.Spec.ReplicaCount))
 		}
 	}
-	if !found {
+	if len(targets) == 0 {
 		mLog.Info("Cannot locate any resource", "total resources", len(resources))
-		return util.ReconcileWaitResult,
-			util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(fmt.Errorf(errScaleResource)))
+		return nil, false, util.ReconcileWaitResult,
+			util.PatchCondition(ctx, r, &manualScalar, cpv1alpha1.ReconcileError(fmt.Errorf(errScaleResource)),
+				targetsNotReadyCondition(errors.New(errScaleResource)))
+	}
+	return targets, changed, ctrl.Result{}, nil
+}
+
+// traitOwnerReference is the owner reference the trait adds to the resources it scales. The type meta of a
+// cached object can be empty, the owner reference in an apply configuration can't be
+func traitOwnerReference(manualScalar oamv1alpha2.ManualScalerTrait) metav1.OwnerReference {
+	isController := false
+	bod := true
+	return metav1.OwnerReference{
+		APIVersion:         oamv1alpha2.SchemeGroupVersion.String(),
+		Kind:               oamv1alpha2.ManualScalerTraitKind,
+		Name:               manualScalar.Name,
+		UID:                manualScalar.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &bod,
+	}
+}
+
+// applyReplicas scales a resource with server side apply, we only own the replicas and our own owner reference.
+// The first time we scale a resource we don't force the ownership so that a conflict with another field manager
+// is not silently overwritten. Once we have scaled it, a different replica count is a drift (e.g. a
+// `kubectl scale`) that we correct by forcing the ownership back
+func (r *Reconciler) applyReplicas(ctx context.Context, res *unstructured.Unstructured, ownerRef metav1.OwnerReference,
+	manualScalar oamv1alpha2.ManualScalerTrait) (*unstructured.Unstructured, bool, int64, error) {
+	drifted, current := replicaDrifted(res, manualScalar)
+	scaled := traitutil.RenderScaledResource(res, ownerRef, manualScalar.Spec.ReplicaCount)
+	opts := []client.PatchOption{client.FieldOwner(fieldManager(manualScalar))}
+	if drifted {
+		opts = append(opts, client.ForceOwnership)
 	}
-	return ctrl.Result{}, nil
+	return scaled, drifted, current, r.Patch(ctx, scaled, client.Apply, opts...)
+}
+
+// fieldManager is the stable name the trait uses to own the fields it applies
+func fieldManager(manualScalar oamv1alpha2.ManualScalerTrait) string {
+	return strings.ToLower(oamv1alpha2.ManualScalerTraitKind) + "/" + manualScalar.GetName()
 }
 
-// locateReplicaField call openapi RESTFUL end point to fetch the schema of a given resource and try to see
-// 	if it has a spec.replicas filed that is of type integer. We will apply duck typing to modify the fields there
-//  assuming that the fields is used to control the number of instances of this resource
-//  NOTE: This only works if the resource CRD has a structural schema, all `apiextensions.k8s.io/v1` CRDs do
-// https://kubernetes.io/docs/tasks/extend-kubernetes/custom-resources/custom-resource-definitions/#specifying-a-structural-schema
-func locateReplicaField(document openapi.Resources, res *unstructured.Unstructured) bool {
-	// this is the most common path for replicas fields
-	replicaFieldPath := []string{"spec", "replicas"}
-	g, v := util.APIVersion2GroupVersion(res.GetAPIVersion())
-	// we look up the resource schema definition by its GVK
-	schema := document.LookupResource(schema.GroupVersionKind{
-		Group:   g,
-		Version: v,
-		Kind:    res.GetKind(),
-	})
-	// we try to see if there is a spec.replicas fields in its definition
-	field, err := explain.LookupSchemaForField(schema, replicaFieldPath)
-	if err != nil || field == nil {
+// replicaDrifted checks if a resource that this trait has already scaled no longer has the desired replicas,
+// which means that someone else (e.g. `kubectl scale`) changed it behind our back
+func replicaDrifted(res *unstructured.Unstructured, manualScalar oamv1alpha2.ManualScalerTrait) (bool, int64) {
+	scaled := false
+	for _, owner := range res.GetOwnerReferences() {
+		if owner.UID == manualScalar.GetUID() {
+			scaled = true
+		}
+	}
+	if !scaled {
+		return false, 0
+	}
+	current, found, err := unstructured.NestedInt64(res.Object, "spec", "replicas")
+	if err != nil || !found {
+		return false, 0
+	}
+	return current != int64(manualScalar.Spec.ReplicaCount), current
+}
+
+// replicasDiffer checks if applying the replica count changes the desired replicas of a resource
+func replicasDiffer(res *unstructured.Unstructured, replicaCount int32) bool {
+	current, found, err := unstructured.NestedInt64(res.Object, "spec", "replicas")
+	return err != nil || !found || current != int64(replicaCount)
+}
+
+// watchResource starts to watch a kind of resources that we scaled if we are not watching it already
+func (r *Reconciler) watchResource(gvk schema.GroupVersionKind) error {
+	r.watchLock.Lock()
+	defer r.watchLock.Unlock()
+	if r.controller == nil || r.watched[gvk] {
+		return nil
+	}
+	res := &unstructured.Unstructured{}
+	res.SetGroupVersionKind(gvk)
+	// only the resources that are owned by a trait are enqueued, the owner reference is not a controller one
+	if err := r.controller.Watch(&source.Kind{Type: res},
+		&handler.EnqueueRequestForOwner{OwnerType: &oamv1alpha2.ManualScalerTrait{}, IsController: false},
+		replicasChangedPredicate()); err != nil {
+		return err
+	}
+	if r.watched == nil {
+		r.watched = make(map[schema.GroupVersionKind]bool)
+	}
+	r.watched[gvk] = true
+	r.log.Info("Start to watch the scaled resource kind", "resource GVK", gvk.String())
+	return nil
+}
+
+// replicasChangedPredicate only lets through the updates that change the desired or ready replicas
+func replicasChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ctrlevent.CreateEvent) bool { return false },
+		DeleteFunc: func(ctrlevent.DeleteEvent) bool { return false },
+		UpdateFunc: func(e ctrlevent.UpdateEvent) bool {
+			return replicasChanged(e.ObjectOld, e.ObjectNew)
+		},
+		GenericFunc: func(ctrlevent.GenericEvent) bool { return false },
+	}
+}
+
+func replicasChanged(oldObj, newObj runtime.Object) bool {
+	oldRes, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
 		return false
 	}
-	// we also verify that it is of type integer to further narrow down the candidates
-	replicaField, ok := field.(*proto.Primitive)
-	if !ok || replicaField.Type != "integer" {
+	newRes, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
 		return false
 	}
-	return true
+	for _, path := range [][]string{{"spec", "replicas"}, {"status", "readyReplicas"}} {
+		oldReplicas, oldFound, _ := unstructured.NestedInt64(oldRes.Object, path...)
+		newReplicas, newFound, _ := unstructured.NestedInt64(newRes.Object, path...)
+		if oldFound != newFound || oldReplicas != newReplicas {
+			return true
+		}
+	}
+	return false
 }
 
 //SetupWithManager to setup k8s controller.
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 	name := "oam/" + strings.ToLower(oamv1alpha2.ManualScalerTraitKind)
-	return ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		For(&oamv1alpha2.ManualScalerTrait{}).
-		Complete(r)
+		// the traits are re-checked against the replica bounds policies when they change
+		Watches(&source.Kind{Type: &extendv1alpha1.ReplicaBoundsPolicy{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.mapPolicyToTraits)}).
+		Build(r)
+	if err != nil {
+		return err
+	}
+	// the kinds of the scaled resources are only known at runtime, we add watches for them as we scale them
+	r.controller = c
+	return nil
 }
@@ -12,14 +12,19 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam/util"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
 )
 
 func TestManualscalertrait(t *testing.T) {
@@ -142,4 +147,221 @@ var _ = Describe("Manualscalar Trait Controller Test", func() {
 			Expect(tc.want.result).Should(Equal(result))
 		}
 	})
+
+	It("Test detect the replica drift of a scaled resource", func() {
+		manualScalar := oamv1alpha2.ManualScalerTrait{
+			ObjectMeta: metav1.ObjectMeta{
+				UID: "trait-uid",
+			},
+			Spec: oamv1alpha2.ManualScalerTraitSpec{
+				ReplicaCount: 3,
+			},
+		}
+		newResource := func(replicas int64, owner types.UID) *unstructured.Unstructured {
+			res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			res.SetKind("Deployment")
+			res.SetOwnerReferences([]metav1.OwnerReference{{UID: owner}})
+			unstructured.SetNestedField(res.Object, replicas, "spec", "replicas")
+			return res
+		}
+		type want struct {
+			drifted bool
+			current int64
+		}
+		cases := map[string]struct {
+			res  *unstructured.Unstructured
+			want want
+		}{
+			"Not drifted when the resource has the desired replicas": {
+				res:  newResource(3, "trait-uid"),
+				want: want{drifted: false, current: 3},
+			},
+			"Drifted when a scaled resource has different replicas": {
+				res:  newResource(5, "trait-uid"),
+				want: want{drifted: true, current: 5},
+			},
+			"Not drifted when the resource is not scaled by the trait yet": {
+				res:  newResource(5, "other-uid"),
+				want: want{drifted: false, current: 0},
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			drifted, current := replicaDrifted(tc.res, manualScalar)
+			Expect(drifted).Should(Equal(tc.want.drifted))
+			Expect(current).Should(Equal(tc.want.current))
+		}
+	})
+
+	It("Test only replica changes pass the predicate", func() {
+		newResource := func(replicas int64, image string) *unstructured.Unstructured {
+			res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			unstructured.SetNestedField(res.Object, replicas, "spec", "replicas")
+			unstructured.SetNestedField(res.Object, image, "spec", "image")
+			return res
+		}
+		cases := map[string]struct {
+			oldObj runtime.Object
+			newObj runtime.Object
+			want   bool
+		}{
+			"Replicas changed": {
+				oldObj: newResource(3, "nginx"),
+				newObj: newResource(5, "nginx"),
+				want:   true,
+			},
+			"Ready replicas changed": {
+				oldObj: newResource(3, "nginx"),
+				newObj: func() runtime.Object {
+					res := newResource(3, "nginx")
+					unstructured.SetNestedField(res.Object, int64(3), "status", "readyReplicas")
+					return res
+				}(),
+				want: true,
+			},
+			"Other fields changed": {
+				oldObj: newResource(3, "nginx"),
+				newObj: newResource(3, "nginx:latest"),
+				want:   false,
+			},
+			"Not an unstructured object": {
+				oldObj: &oamv1alpha2.ManualScalerTrait{},
+				newObj: &oamv1alpha2.ManualScalerTrait{},
+				want:   false,
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			Expect(replicasChanged(tc.oldObj, tc.newObj)).Should(Equal(tc.want))
+		}
+	})
+
+	It("Test render the apply configuration of a scaled resource", func() {
+		manualScalar := oamv1alpha2.ManualScalerTrait{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "example-trait",
+				UID:  "trait-uid",
+			},
+		}
+		res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		res.SetAPIVersion("apps/v1")
+		res.SetKind("Deployment")
+		res.SetName("example-deploy")
+		res.SetNamespace("default")
+		res.SetLabels(map[string]string{"app": "example"})
+		res.SetOwnerReferences([]metav1.OwnerReference{{UID: "workload-uid"}})
+		unstructured.SetNestedField(res.Object, "nginx", "spec", "template", "spec", "containers", "image")
+		scaled := traitutil.RenderScaledResource(res, traitOwnerReference(manualScalar), 5)
+		Expect(scaled.Object).Should(Equal(map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "example-deploy",
+				"namespace": "default",
+				"ownerReferences": []interface{}{
+					map[string]interface{}{
+						"apiVersion":         "core.oam.dev/v1alpha2",
+						"kind":               "ManualScalerTrait",
+						"name":               "example-trait",
+						"uid":                "trait-uid",
+						"controller":         false,
+						"blockOwnerDeletion": true,
+					},
+				},
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(5),
+			},
+		}))
+		Expect(fieldManager(manualScalar)).Should(Equal("manualscalertrait/example-trait"))
+	})
+
+	It("Test correct the drift of a resource whose replicas another field manager took over", func() {
+		manualScalar := oamv1alpha2.ManualScalerTrait{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-trait", UID: "trait-uid"},
+			Spec:       oamv1alpha2.ManualScalerTraitSpec{ReplicaCount: 3},
+		}
+		newDeployment := func(replicas int64, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+			res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			res.SetAPIVersion("apps/v1")
+			res.SetKind("Deployment")
+			res.SetName("example-deploy")
+			res.SetNamespace("default")
+			res.SetOwnerReferences(owners)
+			unstructured.SetNestedField(res.Object, replicas, "spec", "replicas")
+			return res
+		}
+		// the api server keeps the replicas of `kubectl scale`, they are owned by the kubectl field manager
+		var stored *unstructured.Unstructured
+		reconciler := &Reconciler{
+			log: ctrl.Log.WithName("ManualScalarTraitReconciler"),
+			Client: &test.MockClient{MockPatch: func(_ context.Context, obj runtime.Object, patch client.Patch,
+				opts ...client.PatchOption) error {
+				Expect(patch).Should(Equal(client.Apply))
+				po := &client.PatchOptions{}
+				po.ApplyOptions(opts)
+				Expect(po.FieldManager).Should(Equal("manualscalertrait/example-trait"))
+				if po.Force == nil || !*po.Force {
+					return kerrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"},
+						"example-deploy", errors.New(`conflict with "kubectl" using apps/v1: .spec.replicas`))
+				}
+				replicas, _, _ := unstructured.NestedInt64(obj.(*unstructured.Unstructured).Object, "spec", "replicas")
+				Expect(unstructured.SetNestedField(stored.Object, replicas, "spec", "replicas")).Should(Succeed())
+				return nil
+			}},
+		}
+		ctx := context.Background()
+		ownerRef := traitOwnerReference(manualScalar)
+
+		By("Forcing the ownership back from `kubectl scale` on a resource the trait scaled")
+		stored = newDeployment(5, ownerRef)
+		_, drifted, current, err := reconciler.applyReplicas(ctx, stored.DeepCopy(), ownerRef, manualScalar)
+		Expect(err).Should(BeNil())
+		Expect(drifted).Should(BeTrue())
+		Expect(current).Should(BeEquivalentTo(5))
+		replicas, _, _ := unstructured.NestedInt64(stored.Object, "spec", "replicas")
+		Expect(replicas).Should(BeEquivalentTo(3))
+
+		By("Surfacing the conflict of a resource the trait never scaled")
+		stored = newDeployment(5)
+		_, drifted, _, err = reconciler.applyReplicas(ctx, stored.DeepCopy(), ownerRef, manualScalar)
+		Expect(drifted).Should(BeFalse())
+		Expect(kerrors.IsConflict(err)).Should(BeTrue())
+		replicas, _, _ = unstructured.NestedInt64(stored.Object, "spec", "replicas")
+		Expect(replicas).Should(BeEquivalentTo(5))
+	})
+
+	It("Test only count the resources whose replicas the trait changes", func() {
+		newDeployment := func(replicas ...int64) *unstructured.Unstructured {
+			res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			res.SetAPIVersion("apps/v1")
+			res.SetKind("Deployment")
+			res.SetName("example-deploy")
+			for _, r := range replicas {
+				unstructured.SetNestedField(res.Object, r, "spec", "replicas")
+			}
+			return res
+		}
+		cases := map[string]struct {
+			res     *unstructured.Unstructured
+			changed bool
+		}{
+			"the replicas are already the replica count": {
+				res:     newDeployment(3),
+				changed: false,
+			},
+			"the replicas are different": {
+				res:     newDeployment(5),
+				changed: true,
+			},
+			"the replicas are not set": {
+				res:     newDeployment(),
+				changed: true,
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			Expect(replicasDiffer(tc.res, 3)).Should(Equal(tc.changed))
+		}
+	})
 })
@@ -0,0 +1,120 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manualscalertrait
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+const errReportTargets = "cannot report the scaled resources"
+
+// ReasonTargetsNotScaled reports that the trait could not scale its targets, they can't be ready.
+const ReasonTargetsNotScaled cpv1alpha1.ConditionReason = "TargetsNotScaled"
+
+// newScaledTarget returns the observed state of a resource scaled by the trait, resources that do not report
+// their ready replicas are treated as not ready
+func newScaledTarget(res *unstructured.Unstructured, desired int32) extendv1alpha1.ScaledTarget {
+	ready, _, _ := unstructured.NestedInt64(res.Object, "status", "readyReplicas")
+	return extendv1alpha1.ScaledTarget{
+		APIVersion:      res.GetAPIVersion(),
+		Kind:            res.GetKind(),
+		Name:            res.GetName(),
+		UID:             res.GetUID(),
+		DesiredReplicas: desired,
+		ReadyReplicas:   ready,
+	}
+}
+
+// targetsReadyCondition returns a Ready condition that is only true if all the scaled targets report the
+// desired number of ready replicas. The targets themselves are listed in the trait's ScaleReport
+func targetsReadyCondition(manualScalar oamv1alpha2.ManualScalerTrait, targets []extendv1alpha1.ScaledTarget) cpv1alpha1.Condition {
+	ready := 0
+	for _, t := range targets {
+		if t.ReadyReplicas == int64(t.DesiredReplicas) {
+			ready++
+		}
+	}
+	msg := fmt.Sprintf("%d of %d scaled resources are ready, see %s %s", ready, len(targets),
+		extendv1alpha1.ScaleReportKind, manualScalar.GetName())
+	if ready == len(targets) {
+		return cpv1alpha1.Available().WithMessage(msg)
+	}
+	return cpv1alpha1.Unavailable().WithMessage(msg)
+}
+
+// targetsNotReadyCondition returns a Ready condition that is false because the trait failed to scale its
+// targets, it replaces the readiness observed by a previous reconcile
+func targetsNotReadyCondition(err error) cpv1alpha1.Condition {
+	c := cpv1alpha1.Unavailable()
+	c.Reason = ReasonTargetsNotScaled
+	return c.WithMessage(err.Error())
+}
+
+// reportTargets records the scaled targets in the ScaleReport of the trait, the report is created the first
+// time the trait scales anything and is garbage collected with the trait
+func (r *Reconciler) reportTargets(ctx context.Context, manualScalar oamv1alpha2.ManualScalerTrait,
+	targets []extendv1alpha1.ScaledTarget, ready cpv1alpha1.Condition) error {
+	report := &extendv1alpha1.ScaleReport{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: manualScalar.GetNamespace(), Name: manualScalar.GetName()}, report)
+	if apierrors.IsNotFound(err) {
+		report = newScaleReport(manualScalar)
+		err = r.Create(ctx, report)
+	}
+	if err != nil {
+		return errors.Wrap(err, errReportTargets)
+	}
+	observed := report.Status.DeepCopy()
+	report.Status.Targets = targets
+	report.SetConditions(ready)
+	if reflect.DeepEqual(observed, &report.Status) {
+		return nil
+	}
+	return errors.Wrap(r.Status().Update(ctx, report), errReportTargets)
+}
+
+// newScaleReport returns an empty ScaleReport controlled by the trait
+func newScaleReport(manualScalar oamv1alpha2.ManualScalerTrait) *extendv1alpha1.ScaleReport {
+	ref := cpv1alpha1.TypedReference{
+		APIVersion: oamv1alpha2.SchemeGroupVersion.String(),
+		Kind:       oamv1alpha2.ManualScalerTraitKind,
+		Name:       manualScalar.GetName(),
+		UID:        manualScalar.GetUID(),
+	}
+	return &extendv1alpha1.ScaleReport{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: manualScalar.GetNamespace(),
+			Name:      manualScalar.GetName(),
+			OwnerReferences: []metav1.OwnerReference{meta.AsController(&corev1.ObjectReference{
+				APIVersion: ref.APIVersion, Kind: ref.Kind, Name: ref.Name, UID: ref.UID,
+			})},
+		},
+		Spec: extendv1alpha1.ScaleReportSpec{TraitReference: ref},
+	}
+}
@@ -0,0 +1,127 @@
+package manualscalertrait
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	oamv1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+var _ = Describe("Manualscalar Trait scale report Test", func() {
+	manualScalar := oamv1alpha2.ManualScalerTrait{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "scaler", UID: "trait-uid"},
+		Spec:       oamv1alpha2.ManualScalerTraitSpec{ReplicaCount: 3},
+	}
+	newTarget := func(name string, ready int64) extendv1alpha1.ScaledTarget {
+		res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		res.SetAPIVersion("apps/v1")
+		res.SetKind("Deployment")
+		res.SetName(name)
+		res.SetUID(types.UID(name + "-uid"))
+		unstructured.SetNestedField(res.Object, ready, "status", "readyReplicas")
+		return newScaledTarget(res, 3)
+	}
+
+	It("Test the observed state of a scaled target", func() {
+		Expect(newTarget("api", 2)).Should(Equal(extendv1alpha1.ScaledTarget{
+			APIVersion: "apps/v1", Kind: "Deployment", Name: "api", UID: "api-uid", DesiredReplicas: 3, ReadyReplicas: 2,
+		}))
+		res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		Expect(newScaledTarget(res, 3).ReadyReplicas).Should(BeZero())
+	})
+
+	It("Test the ready condition of the scaled targets", func() {
+		cases := map[string]struct {
+			targets []extendv1alpha1.ScaledTarget
+			want    runtimev1alpha1.Condition
+		}{
+			"Ready when all the targets are ready": {
+				targets: []extendv1alpha1.ScaledTarget{newTarget("api", 3), newTarget("worker", 3)},
+				want:    runtimev1alpha1.Available().WithMessage("2 of 2 scaled resources are ready, see ScaleReport scaler"),
+			},
+			"Not ready when any target is not ready": {
+				targets: []extendv1alpha1.ScaledTarget{newTarget("api", 3), newTarget("worker", 1)},
+				want:    runtimev1alpha1.Unavailable().WithMessage("1 of 2 scaled resources are ready, see ScaleReport scaler"),
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			got := targetsReadyCondition(manualScalar, tc.targets)
+			Expect(got.Equal(tc.want)).Should(BeTrue())
+		}
+	})
+
+	It("Test the ready condition of targets the trait failed to scale", func() {
+		ready := runtimev1alpha1.ConditionedStatus{}
+		ready.SetConditions(runtimev1alpha1.Available())
+		ready.SetConditions(targetsNotReadyCondition(errors.New(errNoTargetMatched)))
+		got := ready.GetCondition(runtimev1alpha1.TypeReady)
+		Expect(got.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(got.Reason).Should(Equal(ReasonTargetsNotScaled))
+		Expect(got.Message).Should(Equal(errNoTargetMatched))
+	})
+
+	It("Test report the scaled targets in the scale report of the trait", func() {
+		var report *extendv1alpha1.ScaleReport
+		updates := 0
+		r := Reconciler{Client: &test.MockClient{
+			MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+				Expect(key).Should(Equal(client.ObjectKey{Namespace: "default", Name: "scaler"}))
+				if report == nil {
+					return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+				}
+				report.DeepCopyInto(obj.(*extendv1alpha1.ScaleReport))
+				return nil
+			},
+			MockCreate: func(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+				report = obj.(*extendv1alpha1.ScaleReport).DeepCopy()
+				return nil
+			},
+			MockStatusUpdate: func(_ context.Context, obj runtime.Object, _ ...client.UpdateOption) error {
+				updates++
+				report = obj.(*extendv1alpha1.ScaleReport).DeepCopy()
+				return nil
+			},
+		}}
+		targets := []extendv1alpha1.ScaledTarget{newTarget("api", 3), newTarget("worker", 1)}
+		ready := targetsReadyCondition(manualScalar, targets)
+
+		Expect(r.reportTargets(context.Background(), manualScalar, targets, ready)).Should(Succeed())
+		Expect(updates).Should(Equal(1))
+		Expect(report.Spec.TraitReference).Should(Equal(runtimev1alpha1.TypedReference{
+			APIVersion: "core.oam.dev/v1alpha2", Kind: "ManualScalerTrait", Name: "scaler", UID: "trait-uid",
+		}))
+		Expect(report.GetOwnerReferences()).Should(HaveLen(1))
+		Expect(report.GetOwnerReferences()[0].UID).Should(Equal(types.UID("trait-uid")))
+		Expect(*report.GetOwnerReferences()[0].Controller).Should(BeTrue())
+		Expect(report.Status.Targets).Should(Equal(targets))
+		Expect(report.GetCondition(runtimev1alpha1.TypeReady).Status).Should(Equal(corev1.ConditionFalse))
+
+		By("Not writing a report that did not change")
+		Expect(r.reportTargets(context.Background(), manualScalar, targets, ready)).Should(Succeed())
+		Expect(updates).Should(Equal(1))
+
+		By("Updating the report once the targets are ready")
+		targets[1] = newTarget("worker", 3)
+		Expect(r.reportTargets(context.Background(), manualScalar, targets, targetsReadyCondition(manualScalar, targets))).Should(Succeed())
+		Expect(updates).Should(Equal(2))
+		Expect(report.Status.Targets[1].ReadyReplicas).Should(BeEquivalentTo(3))
+		Expect(report.GetCondition(runtimev1alpha1.TypeReady).Status).Should(Equal(corev1.ConditionTrue))
+	})
+})
@@ -0,0 +1,159 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manualscalertrait
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// The child resources of the workload a trait scales. All of them are optional and a resource has to match all
+// the ones that are set.
+const (
+	// AnnotationTargetKind selects the child resources of a kind, e.g. "Deployment"
+	AnnotationTargetKind = "manualscalertrait.extend.oam.dev/target-kind"
+	// AnnotationTargetName selects the child resources whose name matches a shell pattern, e.g. "*-worker"
+	AnnotationTargetName = "manualscalertrait.extend.oam.dev/target-name"
+	// AnnotationTargetSelector selects the child resources with a label selector, e.g. "tier=api"
+	AnnotationTargetSelector = "manualscalertrait.extend.oam.dev/target-selector"
+)
+
+// TypeTargetsSelected indicates if the target selector matched any of the workload child resources
+const TypeTargetsSelected cpv1alpha1.ConditionType = "TargetsSelected"
+
+// Reasons a trait's targets are or are not selected.
+const (
+	ReasonTargetsMatched   cpv1alpha1.ConditionReason = "TargetSelectorMatched"
+	ReasonNoTargetsMatched cpv1alpha1.ConditionReason = "NoTargetMatched"
+)
+
+// Selector error strings.
+const (
+	errInvalidTargetName     = "invalid target name pattern"
+	errInvalidTargetSelector = "invalid target label selector"
+	errNoTargetMatched       = "the target selector does not match any child resource"
+)
+
+// targetSelector chooses which child resources of a workload the trait scales
+type targetSelector struct {
+	kind        string
+	namePattern string
+	labels      labels.Selector
+}
+
+// parseTargetSelector builds the selector from the trait annotations, a nil selector matches everything
+func parseTargetSelector(annotations map[string]string) (*targetSelector, error) {
+	kind := strings.TrimSpace(annotations[AnnotationTargetKind])
+	namePattern := strings.TrimSpace(annotations[AnnotationTargetName])
+	labelSelector := strings.TrimSpace(annotations[AnnotationTargetSelector])
+	if len(kind) == 0 && len(namePattern) == 0 && len(labelSelector) == 0 {
+		return nil, nil
+	}
+	sel := &targetSelector{
+		kind:        kind,
+		namePattern: namePattern,
+		labels:      labels.Everything(),
+	}
+	if len(namePattern) != 0 {
+		// path.Match only returns an error for a malformed pattern
+		if _, err := path.Match(namePattern, ""); err != nil {
+			return nil, errors.Wrap(err, errInvalidTargetName)
+		}
+	}
+	if len(labelSelector) != 0 {
+		ls, err := labels.Parse(labelSelector)
+		if err != nil {
+			return nil, errors.Wrap(err, errInvalidTargetSelector)
+		}
+		sel.labels = ls
+	}
+	return sel, nil
+}
+
+// ValidateAnnotations returns an error for each target selector annotation of a trait that cannot be parsed. The
+// controller does not scale a trait whose target selector is invalid.
+func ValidateAnnotations(annotations map[string]string) field.ErrorList {
+	path := field.NewPath("metadata", "annotations")
+	var errs field.ErrorList
+	for _, key := range []string{AnnotationTargetName, AnnotationTargetSelector} {
+		if _, err := parseTargetSelector(map[string]string{key: annotations[key]}); err != nil {
+			errs = append(errs, field.Invalid(path.Key(key), annotations[key], err.Error()))
+		}
+	}
+	return errs
+}
+
+func (s *targetSelector) matches(res *unstructured.Unstructured) bool {
+	if s == nil {
+		return true
+	}
+	if len(s.kind) != 0 && !strings.EqualFold(s.kind, res.GetKind()) {
+		return false
+	}
+	if len(s.namePattern) != 0 {
+		if matched, _ := path.Match(s.namePattern, res.GetName()); !matched {
+			return false
+		}
+	}
+	return s.labels.Matches(labels.Set(res.GetLabels()))
+}
+
+// selectTargets splits the resources into the ones that are matched by the selector and the ones that are skipped
+func selectTargets(sel *targetSelector,
+	resources []*unstructured.Unstructured) (matched, skipped []*unstructured.Unstructured) {
+	for _, res := range resources {
+		if sel.matches(res) {
+			matched = append(matched, res)
+		} else {
+			skipped = append(skipped, res)
+		}
+	}
+	return matched, skipped
+}
+
+// targetsSelectedCondition reports the matched and skipped resources of a selection
+func targetsSelectedCondition(matched, skipped []*unstructured.Unstructured) cpv1alpha1.Condition {
+	c := cpv1alpha1.Condition{
+		Type:               TypeTargetsSelected,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonTargetsMatched,
+		Message: fmt.Sprintf("the target selector matched %d of %d child resources, matched: [%s], skipped: [%s]",
+			len(matched), len(matched)+len(skipped), resourceNames(matched), resourceNames(skipped)),
+	}
+	if len(matched) == 0 {
+		c.Status = corev1.ConditionFalse
+		c.Reason = ReasonNoTargetsMatched
+	}
+	return c
+}
+
+func resourceNames(resources []*unstructured.Unstructured) string {
+	names := make([]string, 0, len(resources))
+	for _, res := range resources {
+		names = append(names, res.GetKind()+"/"+res.GetName())
+	}
+	return strings.Join(names, ", ")
+}
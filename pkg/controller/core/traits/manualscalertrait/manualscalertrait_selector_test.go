@@ -0,0 +1,118 @@
+package manualscalertrait
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Manualscalar Trait target selector Test", func() {
+	newResource := func(kind, name string, labels map[string]string) *unstructured.Unstructured {
+		res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		res.SetKind(kind)
+		res.SetName(name)
+		res.SetLabels(labels)
+		return res
+	}
+	api := newResource("Deployment", "app-api", map[string]string{"tier": "api"})
+	worker := newResource("Deployment", "app-worker", map[string]string{"tier": "worker"})
+	db := newResource("StatefulSet", "app-db", nil)
+	resources := []*unstructured.Unstructured{api, worker, db}
+
+	It("Test select the resources to scale", func() {
+		type want struct {
+			matched []*unstructured.Unstructured
+			skipped []*unstructured.Unstructured
+			err     bool
+		}
+		cases := map[string]struct {
+			annotations map[string]string
+			want        want
+		}{
+			"Select everything without a selector": {
+				annotations: map[string]string{"other": "annotation"},
+				want:        want{matched: resources},
+			},
+			"Select by kind": {
+				annotations: map[string]string{AnnotationTargetKind: "deployment"},
+				want: want{
+					matched: []*unstructured.Unstructured{api, worker},
+					skipped: []*unstructured.Unstructured{db},
+				},
+			},
+			"Select by name pattern": {
+				annotations: map[string]string{AnnotationTargetName: "*-worker"},
+				want: want{
+					matched: []*unstructured.Unstructured{worker},
+					skipped: []*unstructured.Unstructured{api, db},
+				},
+			},
+			"Select by label selector and kind": {
+				annotations: map[string]string{AnnotationTargetKind: "Deployment", AnnotationTargetSelector: "tier in (api)"},
+				want: want{
+					matched: []*unstructured.Unstructured{api},
+					skipped: []*unstructured.Unstructured{worker, db},
+				},
+			},
+			"Select nothing": {
+				annotations: map[string]string{AnnotationTargetKind: "DaemonSet"},
+				want: want{
+					skipped: resources,
+				},
+			},
+			"Invalid name pattern": {
+				annotations: map[string]string{AnnotationTargetName: "[app"},
+				want:        want{err: true},
+			},
+			"Invalid label selector": {
+				annotations: map[string]string{AnnotationTargetSelector: "tier in api"},
+				want:        want{err: true},
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			sel, err := parseTargetSelector(tc.annotations)
+			if tc.want.err {
+				Expect(err).Should(HaveOccurred())
+				continue
+			}
+			Expect(err).ShouldNot(HaveOccurred())
+			matched, skipped := selectTargets(sel, resources)
+			Expect(matched).Should(Equal(tc.want.matched))
+			Expect(skipped).Should(Equal(tc.want.skipped))
+		}
+	})
+
+	It("Test the target selection condition", func() {
+		c := targetsSelectedCondition([]*unstructured.Unstructured{api}, []*unstructured.Unstructured{worker, db})
+		Expect(c.Type).Should(Equal(TypeTargetsSelected))
+		Expect(c.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(c.Message).Should(Equal("the target selector matched 1 of 3 child resources, " +
+			"matched: [Deployment/app-api], skipped: [Deployment/app-worker, StatefulSet/app-db]"))
+		Expect(c.Reason).Should(Equal(ReasonTargetsMatched))
+
+		c = targetsSelectedCondition(nil, resources)
+		Expect(c.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(c.Reason).Should(Equal(ReasonNoTargetsMatched))
+	})
+
+	It("Test validating the target selector annotations", func() {
+		Expect(ValidateAnnotations(map[string]string{
+			AnnotationTargetKind:     "Deployment",
+			AnnotationTargetName:     "*-worker",
+			AnnotationTargetSelector: "tier=api",
+		})).Should(BeEmpty())
+
+		errs := ValidateAnnotations(map[string]string{
+			AnnotationTargetName:     "[app",
+			AnnotationTargetSelector: "tier in api",
+		})
+		Expect(errs).Should(HaveLen(2))
+		Expect(errs[0].Field).Should(Equal("metadata.annotations[" + AnnotationTargetName + "]"))
+		Expect(errs[1].Field).Should(Equal("metadata.annotations[" + AnnotationTargetSelector + "]"))
+	})
+})
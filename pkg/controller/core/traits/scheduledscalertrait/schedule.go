@@ -0,0 +1,136 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduledscalertrait
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+// Schedule error strings.
+const (
+	errInvalidTimeZone = "invalid time zone %q"
+	errInvalidSchedule = "invalid schedule of window %q"
+	errInvalidDuration = "the duration of window %q must be positive"
+)
+
+// lookAhead is how far we look for the next change of the state, windows that are always hidden by other
+// windows would make us look forever otherwise
+const lookAhead = 366 * 24 * time.Hour
+
+// window is a parsed scaling window
+type window struct {
+	name     string
+	schedule cron.Schedule
+	duration time.Duration
+	replicas int32
+}
+
+// timetable decides how many replicas a workload should have at any point in time
+type timetable struct {
+	location        *time.Location
+	windows         []window
+	defaultReplicas int32
+}
+
+// state is the outcome of the timetable at a point in time, the window is empty outside of all the windows
+type state struct {
+	window   string
+	replicas int32
+}
+
+// newTimetable parses the windows of a trait
+func newTimetable(spec v1alpha1.ScheduledScalerTraitSpec) (*timetable, error) {
+	loc, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return nil, errors.Wrapf(err, errInvalidTimeZone, spec.TimeZone)
+	}
+	tt := &timetable{location: loc, defaultReplicas: spec.DefaultReplicaCount}
+	for _, w := range spec.Windows {
+		s, err := cron.ParseStandard(w.Schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, errInvalidSchedule, w.Name)
+		}
+		if w.Duration.Duration <= 0 {
+			return nil, errors.Errorf(errInvalidDuration, w.Name)
+		}
+		tt.windows = append(tt.windows, window{
+			name:     w.Name,
+			schedule: s,
+			duration: w.Duration.Duration,
+			replicas: w.ReplicaCount,
+		})
+	}
+	return tt, nil
+}
+
+// active checks if a window is active at the given time. A window is active from each activation of its
+// schedule (inclusive) until the duration has passed (exclusive).
+func (w window) active(t time.Time) bool {
+	// the last activation that may still be running is the first one after t - duration
+	start := w.schedule.Next(t.Add(-w.duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// nextBoundary returns the first time after t that the window starts or ends
+func (w window) nextBoundary(t time.Time) time.Time {
+	next := w.schedule.Next(t)
+	if w.active(t) {
+		if end := w.schedule.Next(t.Add(-w.duration)).Add(w.duration); next.IsZero() || end.Before(next) {
+			return end
+		}
+	}
+	return next
+}
+
+// at returns the state of the timetable at the given time, the first active window wins
+func (tt *timetable) at(t time.Time) state {
+	t = t.In(tt.location)
+	for _, w := range tt.windows {
+		if w.active(t) {
+			return state{window: w.name, replicas: w.replicas}
+		}
+	}
+	return state{replicas: tt.defaultReplicas}
+}
+
+// next returns the first time after t that the state of the timetable changes and the state after that.
+// The returned time is zero if the state never changes.
+func (tt *timetable) next(t time.Time) (time.Time, state) {
+	t = t.In(tt.location)
+	current := tt.at(t)
+	horizon := t.Add(lookAhead)
+	for {
+		var boundary time.Time
+		for _, w := range tt.windows {
+			if b := w.nextBoundary(t); !b.IsZero() && (boundary.IsZero() || b.Before(boundary)) {
+				boundary = b
+			}
+		}
+		if boundary.IsZero() || boundary.After(horizon) {
+			return time.Time{}, current
+		}
+		// a window may start or end while it is hidden by an overlapping window, skip these boundaries
+		if s := tt.at(boundary); s != current {
+			return boundary, s
+		}
+		t = boundary
+	}
+}
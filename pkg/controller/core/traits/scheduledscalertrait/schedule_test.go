@@ -0,0 +1,149 @@
+package scheduledscalertrait
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+var _ = Describe("Scheduled scaler timetable Test", func() {
+	// business hours on weekdays and a lunch peak that wins over them
+	spec := v1alpha1.ScheduledScalerTraitSpec{
+		Windows: []v1alpha1.ScalingWindow{
+			{
+				Name:         "lunch",
+				Schedule:     "0 12 * * 1-5",
+				Duration:     metav1.Duration{Duration: time.Hour},
+				ReplicaCount: 10,
+			},
+			{
+				Name:         "business-hours",
+				Schedule:     "0 8 * * 1-5",
+				Duration:     metav1.Duration{Duration: 10 * time.Hour},
+				ReplicaCount: 5,
+			},
+		},
+		DefaultReplicaCount: 1,
+		TimeZone:            "Europe/Berlin",
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	// 2020-06-15 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 6, day, hour, minute, 0, 0, berlin)
+	}
+
+	It("Test compute the current and the next state", func() {
+		tt, err := newTimetable(spec)
+		Expect(err).ShouldNot(HaveOccurred())
+		type want struct {
+			current  state
+			nextTime time.Time
+			next     state
+		}
+		cases := map[string]struct {
+			now  time.Time
+			want want
+		}{
+			"Before the business hours": {
+				now: at(15, 7, 30),
+				want: want{
+					current:  state{replicas: 1},
+					nextTime: at(15, 8, 0),
+					next:     state{window: "business-hours", replicas: 5},
+				},
+			},
+			"Exactly at the start of the business hours": {
+				now: at(15, 8, 0),
+				want: want{
+					current:  state{window: "business-hours", replicas: 5},
+					nextTime: at(15, 12, 0),
+					next:     state{window: "lunch", replicas: 10},
+				},
+			},
+			"During the lunch peak": {
+				now: at(15, 12, 30),
+				want: want{
+					current:  state{window: "lunch", replicas: 10},
+					nextTime: at(15, 13, 0),
+					next:     state{window: "business-hours", replicas: 5},
+				},
+			},
+			"Exactly at the end of the business hours": {
+				now: at(15, 18, 0),
+				want: want{
+					current:  state{replicas: 1},
+					nextTime: at(16, 8, 0),
+					next:     state{window: "business-hours", replicas: 5},
+				},
+			},
+			"On a Friday evening": {
+				now: at(19, 20, 0),
+				want: want{
+					current:  state{replicas: 1},
+					nextTime: at(22, 8, 0),
+					next:     state{window: "business-hours", replicas: 5},
+				},
+			},
+			"The time zone of now does not matter": {
+				now: at(15, 7, 30).UTC(),
+				want: want{
+					current:  state{replicas: 1},
+					nextTime: at(15, 8, 0),
+					next:     state{window: "business-hours", replicas: 5},
+				},
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			Expect(tt.at(tc.now)).Should(Equal(tc.want.current))
+			nextTime, next := tt.next(tc.now)
+			Expect(nextTime.Equal(tc.want.nextTime)).Should(BeTrue(), "got next time %s", nextTime)
+			Expect(next).Should(Equal(tc.want.next))
+		}
+	})
+
+	It("Test skip the boundaries of hidden windows", func() {
+		tt, err := newTimetable(v1alpha1.ScheduledScalerTraitSpec{
+			Windows: []v1alpha1.ScalingWindow{
+				{Name: "day", Schedule: "0 6 * * *", Duration: metav1.Duration{Duration: 16 * time.Hour}, ReplicaCount: 3},
+				{Name: "morning", Schedule: "0 7 * * *", Duration: metav1.Duration{Duration: time.Hour}, ReplicaCount: 9},
+			},
+			DefaultReplicaCount: 1,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		nextTime, next := tt.next(time.Date(2020, 6, 15, 6, 30, 0, 0, time.UTC))
+		Expect(nextTime).Should(Equal(time.Date(2020, 6, 15, 22, 0, 0, 0, time.UTC)))
+		Expect(next).Should(Equal(state{replicas: 1}))
+	})
+
+	It("Test never changing timetables", func() {
+		tt, err := newTimetable(v1alpha1.ScheduledScalerTraitSpec{DefaultReplicaCount: 2})
+		Expect(err).ShouldNot(HaveOccurred())
+		nextTime, next := tt.next(time.Now())
+		Expect(nextTime.IsZero()).Should(BeTrue())
+		Expect(next).Should(Equal(state{replicas: 2}))
+	})
+
+	It("Test reject invalid windows", func() {
+		cases := map[string]v1alpha1.ScheduledScalerTraitSpec{
+			"Invalid time zone": {TimeZone: "Mars/Olympus"},
+			"Invalid schedule": {Windows: []v1alpha1.ScalingWindow{
+				{Name: "bad", Schedule: "every day", Duration: metav1.Duration{Duration: time.Hour}},
+			}},
+			"Invalid duration": {Windows: []v1alpha1.ScalingWindow{
+				{Name: "bad", Schedule: "0 8 * * *"},
+			}},
+		}
+		for name, spec := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			_, err := newTimetable(spec)
+			Expect(err).Should(HaveOccurred())
+		}
+	})
+})
@@ -0,0 +1,213 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduledscalertrait
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam/util"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
+)
+
+// Reconcile error strings.
+const (
+	errParseWindows        = "cannot parse the scaling windows"
+	errLocateWorkload      = traitutil.ErrLocateWorkload
+	errFetchChildResources = traitutil.ErrFetchChildResources
+	errScaleResource       = "cannot scale the resource"
+	errReplicasConflict    = "the replicas of the resource is managed by another field manager"
+	errUpdateStatus        = "cannot update the scheduled scaler trait status"
+)
+
+// Reconcile event reasons.
+const (
+	reasonScheduledScaling = "Scheduled scalar applied"
+)
+
+// Setup adds a controller that reconciles ScheduledScalerTrait.
+func Setup(mgr ctrl.Manager, log logging.Logger) error {
+	reconciler := Reconciler{
+		Client:          mgr.GetClient(),
+		DiscoveryClient: *discovery.NewDiscoveryClientForConfigOrDie(mgr.GetConfig()),
+		log:             ctrl.Log.WithName("ScheduledScalerTrait"),
+		record:          event.NewAPIRecorder(mgr.GetEventRecorderFor("ScheduledScalerTrait")),
+		Scheme:          mgr.GetScheme(),
+		now:             time.Now,
+	}
+	return reconciler.SetupWithManager(mgr)
+}
+
+// Reconciler reconciles a ScheduledScalerTrait object
+type Reconciler struct {
+	client.Client
+	discovery.DiscoveryClient
+	log    logr.Logger
+	record event.Recorder
+	Scheme *runtime.Scheme
+	now    func() time.Time
+}
+
+// Reconcile to reconcile scheduled scaler trait.
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=scheduledscalertraits,verbs=get;list;watch
+// +kubebuilder:rbac:groups=extend.oam.dev,resources=scheduledscalertraits/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=containerizedworkloads,verbs=get;list;
+// +kubebuilder:rbac:groups=core.oam.dev,resources=workloaddefinition,verbs=get;list;
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
+func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	mLog := r.log.WithValues("scheduledscaler trait", req.NamespacedName)
+
+	mLog.Info("Reconcile scheduledscaler trait")
+
+	var trait v1alpha1.ScheduledScalerTrait
+	if err := r.Get(ctx, req.NamespacedName, &trait); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// find the resource object to record the event to, default is the parent appConfig.
+	eventObj, err := util.LocateParentAppConfig(ctx, r.Client, &trait)
+	if eventObj == nil {
+		// fallback to the trait itself
+		mLog.Error(err, "scheduledScaler", trait.Name)
+		eventObj = &trait
+	}
+
+	tt, err := newTimetable(trait.Spec)
+	if err != nil {
+		r.record.Event(eventObj, event.Warning(errParseWindows, err))
+		return util.ReconcileWaitResult,
+			util.PatchCondition(ctx, r, &trait, cpv1alpha1.ReconcileError(errors.Wrap(err, errParseWindows)))
+	}
+	now := r.now()
+	current := tt.at(now)
+	nextTime, next := tt.next(now)
+	mLog.Info("Computed the scaling window", "current window", current.window, "replicas", current.replicas,
+		"next window", next.window, "next transition", nextTime)
+
+	// Fetch the workload instance this trait is referring to
+	workload, result, err := traitutil.FetchWorkload(ctx, r, mLog, &trait)
+	if err != nil {
+		r.record.Event(eventObj, event.Warning(errLocateWorkload, err))
+		return result, err
+	}
+	if workload == nil {
+		return result, nil
+	}
+
+	// Fetch the child resources list from the corresponding workload
+	resources, err := traitutil.FetchScaleCandidates(ctx, mLog, r, workload)
+	if err != nil {
+		mLog.Error(err, "Error while fetching the workload child resources", "workload", workload.UnstructuredContent())
+		r.record.Event(eventObj, event.Warning(errFetchChildResources, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait,
+			cpv1alpha1.ReconcileError(errors.Wrap(err, errFetchChildResources)))
+	}
+	if err := r.scaleResources(ctx, mLog, trait, resources, current.replicas); err != nil {
+		r.record.Event(eventObj, event.Warning(errScaleResource, err))
+		return util.ReconcileWaitResult, util.PatchCondition(ctx, r, &trait, cpv1alpha1.ReconcileError(err))
+	}
+	if trait.Status.CurrentWindow != current.window || trait.Status.CurrentReplicaCount != current.replicas {
+		r.record.Event(eventObj, event.Normal(reasonScheduledScaling,
+			fmt.Sprintf("Trait `%s` successfully scaled the workload to %d instances for window `%s`",
+				trait.Name, current.replicas, current.window)))
+	}
+
+	trait.Status.CurrentWindow = current.window
+	trait.Status.CurrentReplicaCount = current.replicas
+	trait.Status.NextWindow = next.window
+	trait.Status.NextReplicaCount = next.replicas
+	trait.Status.NextTransitionTime = nil
+	result = ctrl.Result{}
+	if !nextTime.IsZero() {
+		trait.Status.NextTransitionTime = &metav1.Time{Time: nextTime}
+		// come back exactly when the next window starts or ends
+		result.RequeueAfter = nextTime.Sub(now)
+	}
+	trait.SetConditions(cpv1alpha1.ReconcileSuccess())
+	return result, errors.Wrap(r.Status().Update(ctx, &trait), errUpdateStatus)
+}
+
+// scale all the resources that we can scale to the given replicas
+func (r *Reconciler) scaleResources(ctx context.Context, mLog logr.Logger, trait v1alpha1.ScheduledScalerTrait,
+	resources []*unstructured.Unstructured, replicas int32) error {
+	isController := false
+	bod := true
+	ownerRef := metav1.OwnerReference{
+		APIVersion:         v1alpha1.SchemeGroupVersion.String(),
+		Kind:               v1alpha1.ScheduledScalerTraitKind,
+		Name:               trait.Name,
+		UID:                trait.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &bod,
+	}
+	document, err := traitutil.FetchOpenAPIDocument(&r.DiscoveryClient)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, res := range resources {
+		if !traitutil.LocateReplicaField(document, res) {
+			continue
+		}
+		found = true
+		scaled := traitutil.RenderScaledResource(res, ownerRef, replicas)
+		// server side apply, conflicts with other field managers are not silently overwritten
+		if err := r.Patch(ctx, scaled, client.Apply, client.FieldOwner(fieldManager(trait))); err != nil {
+			mLog.Error(err, "Failed to scale a resource", "resource name", res.GetName(), "UID", res.GetUID())
+			if apierrors.IsConflict(err) {
+				return errors.Wrap(err, errReplicasConflict)
+			}
+			return errors.Wrap(err, errScaleResource)
+		}
+		mLog.Info("Successfully scaled a resource", "resource GVK", res.GroupVersionKind().String(),
+			"res UID", res.GetUID(), "target replica", replicas)
+	}
+	if !found {
+		mLog.Info("Cannot locate any resource", "total resources", len(resources))
+		return errors.New(errScaleResource)
+	}
+	return nil
+}
+
+// fieldManager is the stable name the trait uses to own the fields it applies
+func fieldManager(trait v1alpha1.ScheduledScalerTrait) string {
+	return strings.ToLower(v1alpha1.ScheduledScalerTraitKind) + "/" + trait.GetName()
+}
+
+// SetupWithManager to setup k8s controller.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	name := "oam/" + strings.ToLower(v1alpha1.ScheduledScalerTraitKind)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&v1alpha1.ScheduledScalerTrait{}).
+		Complete(r)
+}
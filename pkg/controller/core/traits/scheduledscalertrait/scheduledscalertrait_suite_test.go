@@ -0,0 +1,13 @@
+package scheduledscalertrait
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestScheduledscalertrait(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scheduledscalertrait Suite")
+}
@@ -0,0 +1,132 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traitutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+// Replica bounds error strings.
+const (
+	ErrListReplicaBounds    = "cannot list the replica bounds policies"
+	errInvalidTraitSelector = "invalid trait selector of replica bounds policy %s"
+	errBelowMinReplicas     = "%d replicas is below the minimum of %d allowed by replica bounds policy %s"
+	errAboveMaxReplicas     = "%d replicas is above the maximum of %d allowed by replica bounds policy %s"
+	errConflictingBounds    = "replica bounds policies conflict, the minimum of %d of policy %s is above the maximum of %d of policy %s"
+)
+
+// ReplicaBounds are the replicas allowed by the ReplicaBoundsPolicies that
+// apply to a trait, the tightest bounds of all of them.
+type ReplicaBounds struct {
+	// Min and Max are nil if no policy sets them.
+	Min *int32
+	Max *int32
+	// MinPolicy and MaxPolicy name the policies that set Min and Max.
+	MinPolicy string
+	MaxPolicy string
+	// Policies are the names of all the policies that apply.
+	Policies []string
+}
+
+// FetchReplicaBounds returns the bounds of the ReplicaBoundsPolicies in the
+// namespace of the trait whose trait selector matches the trait's labels.
+func FetchReplicaBounds(ctx context.Context, c client.Reader, trait metav1.Object) (ReplicaBounds, error) {
+	l := &v1alpha1.ReplicaBoundsPolicyList{}
+	if err := c.List(ctx, l, client.InNamespace(trait.GetNamespace())); err != nil {
+		return ReplicaBounds{}, errors.Wrap(err, ErrListReplicaBounds)
+	}
+	return ReplicaBoundsOf(l.Items, trait.GetLabels())
+}
+
+// ReplicaBoundsOf returns the bounds of the supplied policies that apply to a
+// trait with the supplied labels.
+func ReplicaBoundsOf(policies []v1alpha1.ReplicaBoundsPolicy, traitLabels map[string]string) (ReplicaBounds, error) {
+	// the policies are evaluated in a stable order so that ties are reported consistently
+	sort.Slice(policies, func(i, j int) bool { return policies[i].GetName() < policies[j].GetName() })
+	var b ReplicaBounds
+	for _, p := range policies {
+		if p.Spec.TraitSelector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(p.Spec.TraitSelector)
+			if err != nil {
+				return ReplicaBounds{}, errors.Wrapf(err, errInvalidTraitSelector, p.GetName())
+			}
+			if !sel.Matches(labels.Set(traitLabels)) {
+				continue
+			}
+		}
+		b.Policies = append(b.Policies, p.GetName())
+		if p.Spec.MinReplicas != nil && (b.Min == nil || *p.Spec.MinReplicas > *b.Min) {
+			min := *p.Spec.MinReplicas
+			b.Min, b.MinPolicy = &min, p.GetName()
+		}
+		if p.Spec.MaxReplicas != nil && (b.Max == nil || *p.Spec.MaxReplicas < *b.Max) {
+			max := *p.Spec.MaxReplicas
+			b.Max, b.MaxPolicy = &max, p.GetName()
+		}
+	}
+	return b, nil
+}
+
+// Conflict returns an error naming the policies whose bounds allow no replica
+// count at all, or nil if they don't conflict.
+func (b ReplicaBounds) Conflict() error {
+	if b.Min != nil && b.Max != nil && *b.Min > *b.Max {
+		return errors.Errorf(errConflictingBounds, *b.Min, b.MinPolicy, *b.Max, b.MaxPolicy)
+	}
+	return nil
+}
+
+// Check returns an error explaining which policy the replicas violate, or nil
+// if they are within the bounds.
+func (b ReplicaBounds) Check(replicas int32) error {
+	if err := b.Conflict(); err != nil {
+		return err
+	}
+	if b.Min != nil && replicas < *b.Min {
+		return errors.Errorf(errBelowMinReplicas, replicas, *b.Min, b.MinPolicy)
+	}
+	if b.Max != nil && replicas > *b.Max {
+		return errors.Errorf(errAboveMaxReplicas, replicas, *b.Max, b.MaxPolicy)
+	}
+	return nil
+}
+
+func (b ReplicaBounds) String() string {
+	if len(b.Policies) == 0 {
+		return "no replica bounds policy applies"
+	}
+	bounds := make([]string, 0, 2)
+	if b.Min != nil {
+		bounds = append(bounds, fmt.Sprintf("min %d (%s)", *b.Min, b.MinPolicy))
+	}
+	if b.Max != nil {
+		bounds = append(bounds, fmt.Sprintf("max %d (%s)", *b.Max, b.MaxPolicy))
+	}
+	if len(bounds) == 0 {
+		bounds = append(bounds, "unbounded")
+	}
+	return fmt.Sprintf("%s; policies: [%s]", strings.Join(bounds, ", "), strings.Join(b.Policies, ", "))
+}
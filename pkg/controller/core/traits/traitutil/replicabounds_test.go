@@ -0,0 +1,199 @@
+package traitutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+)
+
+var _ = Describe("Replica bounds", func() {
+	int32Ptr := func(i int32) *int32 { return &i }
+	policy := func(name string, min, max *int32, selector map[string]string) v1alpha1.ReplicaBoundsPolicy {
+		p := v1alpha1.ReplicaBoundsPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       v1alpha1.ReplicaBoundsPolicySpec{MinReplicas: min, MaxReplicas: max},
+		}
+		if selector != nil {
+			p.Spec.TraitSelector = &metav1.LabelSelector{MatchLabels: selector}
+		}
+		return p
+	}
+
+	It("Test the bounds of the policies that apply to a trait", func() {
+		type want struct {
+			min, max             *int32
+			minPolicy, maxPolicy string
+			policies             []string
+			str                  string
+		}
+		cases := map[string]struct {
+			policies []v1alpha1.ReplicaBoundsPolicy
+			labels   map[string]string
+			want     want
+		}{
+			"No policy": {
+				want: want{str: "no replica bounds policy applies"},
+			},
+			"A policy without bounds": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{policy("open", nil, nil, nil)},
+				want:     want{policies: []string{"open"}, str: "unbounded; policies: [open]"},
+			},
+			"Min only": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{policy("floor", int32Ptr(2), nil, nil)},
+				want: want{min: int32Ptr(2), minPolicy: "floor", policies: []string{"floor"},
+					str: "min 2 (floor); policies: [floor]"},
+			},
+			"Max only": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{policy("ceiling", nil, int32Ptr(10), nil)},
+				want: want{max: int32Ptr(10), maxPolicy: "ceiling", policies: []string{"ceiling"},
+					str: "max 10 (ceiling); policies: [ceiling]"},
+			},
+			"Min and max": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{policy("range", int32Ptr(2), int32Ptr(10), nil)},
+				want: want{min: int32Ptr(2), minPolicy: "range", max: int32Ptr(10), maxPolicy: "range",
+					policies: []string{"range"}, str: "min 2 (range), max 10 (range); policies: [range]"},
+			},
+			"The tightest bounds of several policies win": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{
+					policy("wide", int32Ptr(1), int32Ptr(20), nil),
+					policy("floor", int32Ptr(3), nil, nil),
+					policy("ceiling", int32Ptr(2), int32Ptr(8), nil),
+				},
+				want: want{min: int32Ptr(3), minPolicy: "floor", max: int32Ptr(8), maxPolicy: "ceiling",
+					policies: []string{"ceiling", "floor", "wide"},
+					str:      "min 3 (floor), max 8 (ceiling); policies: [ceiling, floor, wide]"},
+			},
+			"Ties are reported for the first policy by name": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{
+					policy("b", int32Ptr(2), int32Ptr(5), nil),
+					policy("a", int32Ptr(2), int32Ptr(5), nil),
+				},
+				want: want{min: int32Ptr(2), minPolicy: "a", max: int32Ptr(5), maxPolicy: "a",
+					policies: []string{"a", "b"}, str: "min 2 (a), max 5 (a); policies: [a, b]"},
+			},
+			"Conflicting policies keep their bounds": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{
+					policy("floor", int32Ptr(5), nil, nil),
+					policy("ceiling", nil, int32Ptr(3), nil),
+				},
+				want: want{min: int32Ptr(5), minPolicy: "floor", max: int32Ptr(3), maxPolicy: "ceiling",
+					policies: []string{"ceiling", "floor"}, str: "min 5 (floor), max 3 (ceiling); policies: [ceiling, floor]"},
+			},
+			"Only the policies selecting the trait apply": {
+				policies: []v1alpha1.ReplicaBoundsPolicy{
+					policy("api", int32Ptr(2), nil, map[string]string{"tier": "api"}),
+					policy("worker", nil, int32Ptr(1), map[string]string{"tier": "worker"}),
+				},
+				labels: map[string]string{"tier": "api"},
+				want: want{min: int32Ptr(2), minPolicy: "api", policies: []string{"api"},
+					str: "min 2 (api); policies: [api]"},
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			b, err := ReplicaBoundsOf(tc.policies, tc.labels)
+			Expect(err).Should(BeNil(), name)
+			Expect(b.Min).Should(Equal(tc.want.min), name)
+			Expect(b.Max).Should(Equal(tc.want.max), name)
+			Expect(b.MinPolicy).Should(Equal(tc.want.minPolicy), name)
+			Expect(b.MaxPolicy).Should(Equal(tc.want.maxPolicy), name)
+			Expect(b.Policies).Should(Equal(tc.want.policies), name)
+			Expect(b.String()).Should(Equal(tc.want.str), name)
+		}
+	})
+
+	It("Test rejecting a policy with an invalid trait selector", func() {
+		p := policy("broken", int32Ptr(1), nil, nil)
+		p.Spec.TraitSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "tier", Operator: "Near", Values: []string{"api"}},
+		}}
+		_, err := ReplicaBoundsOf([]v1alpha1.ReplicaBoundsPolicy{p}, nil)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(HavePrefix("invalid trait selector of replica bounds policy broken"))
+	})
+
+	It("Test checking replicas against the bounds", func() {
+		cases := map[string]struct {
+			bounds   ReplicaBounds
+			replicas int32
+			want     string
+		}{
+			"Unbounded": {
+				replicas: 1000,
+			},
+			"Min only, within": {
+				bounds:   ReplicaBounds{Min: int32Ptr(2), MinPolicy: "floor"},
+				replicas: 2,
+			},
+			"Min only, below": {
+				bounds:   ReplicaBounds{Min: int32Ptr(2), MinPolicy: "floor"},
+				replicas: 1,
+				want:     "1 replicas is below the minimum of 2 allowed by replica bounds policy floor",
+			},
+			"Max only, within": {
+				bounds:   ReplicaBounds{Max: int32Ptr(10), MaxPolicy: "ceiling"},
+				replicas: 10,
+			},
+			"Max only, above": {
+				bounds:   ReplicaBounds{Max: int32Ptr(10), MaxPolicy: "ceiling"},
+				replicas: 11,
+				want:     "11 replicas is above the maximum of 10 allowed by replica bounds policy ceiling",
+			},
+			"Min and max, below": {
+				bounds:   ReplicaBounds{Min: int32Ptr(2), MinPolicy: "floor", Max: int32Ptr(10), MaxPolicy: "ceiling"},
+				replicas: 0,
+				want:     "0 replicas is below the minimum of 2 allowed by replica bounds policy floor",
+			},
+			"Min and max, above": {
+				bounds:   ReplicaBounds{Min: int32Ptr(2), MinPolicy: "floor", Max: int32Ptr(10), MaxPolicy: "ceiling"},
+				replicas: 500,
+				want:     "500 replicas is above the maximum of 10 allowed by replica bounds policy ceiling",
+			},
+			"Min above max": {
+				bounds:   ReplicaBounds{Min: int32Ptr(5), MinPolicy: "floor", Max: int32Ptr(3), MaxPolicy: "ceiling"},
+				replicas: 4,
+				want: "replica bounds policies conflict, the minimum of 5 of policy floor is above the maximum of 3 " +
+					"of policy ceiling",
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			err := tc.bounds.Check(tc.replicas)
+			if len(tc.want) == 0 {
+				Expect(err).Should(BeNil(), name)
+				continue
+			}
+			Expect(err).Should(MatchError(tc.want), name)
+		}
+	})
+
+	It("Test fetching the bounds of the policies in the namespace of a trait", func() {
+		trait := &metav1.ObjectMeta{Name: "scaler", Namespace: "default", Labels: map[string]string{"tier": "api"}}
+		c := &test.MockClient{MockList: func(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			Expect(lo.Namespace).Should(Equal("default"))
+			list.(*v1alpha1.ReplicaBoundsPolicyList).Items = []v1alpha1.ReplicaBoundsPolicy{
+				policy("api", int32Ptr(2), nil, map[string]string{"tier": "api"}),
+			}
+			return nil
+		}}
+		b, err := FetchReplicaBounds(context.Background(), c, trait)
+		Expect(err).Should(BeNil())
+		Expect(b.Policies).Should(Equal([]string{"api"}))
+
+		c.MockList = test.NewMockListFn(errors.New("boom"))
+		_, err = FetchReplicaBounds(context.Background(), c, trait)
+		Expect(err).Should(MatchError(ErrListReplicaBounds + ": boom"))
+	})
+})
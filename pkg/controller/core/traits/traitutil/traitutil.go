@@ -0,0 +1,138 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package traitutil contains the workload lookup and replica field discovery that are shared by the scaler traits.
+package traitutil
+
+import (
+	"context"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam"
+	"github.com/crossplane/oam-kubernetes-runtime/pkg/oam/util"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"k8s.io/kubectl/pkg/explain"
+	"k8s.io/kubectl/pkg/util/openapi"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Error strings.
+const (
+	ErrLocateWorkload      = "cannot find workload"
+	ErrFetchChildResources = "failed to fetch workload child resources"
+	ErrQueryOpenAPI        = "failed to query openAPI"
+)
+
+// FetchWorkload fetches the workload a trait is referring to, the trait condition is patched along with the
+// given conditions if it can't be found
+func FetchWorkload(ctx context.Context, c client.Client, mLog logr.Logger,
+	oamTrait oam.Trait, conditions ...cpv1alpha1.Condition) (*unstructured.Unstructured, ctrl.Result, error) {
+	var workload unstructured.Unstructured
+	workload.SetAPIVersion(oamTrait.GetWorkloadReference().APIVersion)
+	workload.SetKind(oamTrait.GetWorkloadReference().Kind)
+	wn := client.ObjectKey{Name: oamTrait.GetWorkloadReference().Name, Namespace: oamTrait.GetNamespace()}
+	if err := c.Get(ctx, wn, &workload); err != nil {
+		mLog.Error(err, "Workload not find", "kind", oamTrait.GetWorkloadReference().Kind,
+			"workload name", oamTrait.GetWorkloadReference().Name)
+		return nil, util.ReconcileWaitResult,
+			util.PatchCondition(ctx, c, oamTrait, append([]cpv1alpha1.Condition{
+				cpv1alpha1.ReconcileError(errors.Wrap(err, ErrLocateWorkload))}, conditions...)...)
+	}
+	mLog.Info("Get the workload the trait is pointing to", "workload name", workload.GetName(),
+		"workload APIVersion", workload.GetAPIVersion(), "workload Kind", workload.GetKind(), "workload UID",
+		workload.GetUID())
+	return &workload, ctrl.Result{}, nil
+}
+
+// FetchScaleCandidates returns the child resources of a workload, or the workload itself if it has no child
+// resources. These are the resources a scaler trait may scale if they have a replica field.
+func FetchScaleCandidates(ctx context.Context, mLog logr.Logger, r client.Reader,
+	workload *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	resources, err := util.FetchWorkloadChildResources(ctx, mLog, r, workload)
+	if err != nil {
+		return nil, err
+	}
+	// include the workload itself if there is no child resources
+	if len(resources) == 0 {
+		resources = append(resources, workload)
+	}
+	return resources, nil
+}
+
+// FetchOpenAPIDocument fetches the openAPI schema of all the resources the api server knows
+func FetchOpenAPIDocument(dc discovery.OpenAPISchemaInterface) (openapi.Resources, error) {
+	schemaDoc, err := dc.OpenAPISchema()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrQueryOpenAPI)
+	}
+	document, err := openapi.NewOpenAPIData(schemaDoc)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrQueryOpenAPI)
+	}
+	return document, nil
+}
+
+// LocateReplicaField call openapi RESTFUL end point to fetch the schema of a given resource and try to see
+// 	if it has a spec.replicas filed that is of type integer. We will apply duck typing to modify the fields there
+//  assuming that the fields is used to control the number of instances of this resource
+//  NOTE: This only works if the resource CRD has a structural schema, all `apiextensions.k8s.io/v1` CRDs do
+// https://kubernetes.io/docs/tasks/extend-kubernetes/custom-resources/custom-resource-definitions/#specifying-a-structural-schema
+func LocateReplicaField(document openapi.Resources, res *unstructured.Unstructured) bool {
+	// this is the most common path for replicas fields
+	replicaFieldPath := []string{"spec", "replicas"}
+	g, v := util.APIVersion2GroupVersion(res.GetAPIVersion())
+	// we look up the resource schema definition by its GVK
+	schema := document.LookupResource(schema.GroupVersionKind{
+		Group:   g,
+		Version: v,
+		Kind:    res.GetKind(),
+	})
+	// kinds without a published schema, e.g. CRDs without a structural schema, have no replica field we know of
+	if schema == nil {
+		return false
+	}
+	// we try to see if there is a spec.replicas fields in its definition
+	field, err := explain.LookupSchemaForField(schema, replicaFieldPath)
+	if err != nil || field == nil {
+		return false
+	}
+	// we also verify that it is of type integer to further narrow down the candidates
+	replicaField, ok := field.(*proto.Primitive)
+	if !ok || replicaField.Type != "integer" {
+		return false
+	}
+	return true
+}
+
+// RenderScaledResource returns the apply configuration of a resource we scale, it only has the fields we manage
+func RenderScaledResource(res *unstructured.Unstructured, ownerRef metav1.OwnerReference,
+	replicas int32) *unstructured.Unstructured {
+	scaled := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	scaled.SetAPIVersion(res.GetAPIVersion())
+	scaled.SetKind(res.GetKind())
+	scaled.SetName(res.GetName())
+	scaled.SetNamespace(res.GetNamespace())
+	// the owner references are merged by their uid, other owners are left untouched
+	scaled.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+	_ = unstructured.SetNestedField(scaled.Object, int64(replicas), "spec", "replicas")
+	return scaled
+}
@@ -0,0 +1,13 @@
+package traitutil
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTraitutil(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Traitutil Suite")
+}
@@ -0,0 +1,230 @@
+package traitutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cpv1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// fakeDocument serves the schemas of the kinds it has, like the OpenAPI
+// document of an API server.
+type fakeDocument map[schema.GroupVersionKind]proto.Schema
+
+func (d fakeDocument) LookupResource(gvk schema.GroupVersionKind) proto.Schema {
+	return d[gvk]
+}
+
+func specSchema(fields map[string]proto.Schema) proto.Schema {
+	return &proto.Kind{Fields: map[string]proto.Schema{"spec": &proto.Kind{Fields: fields}}}
+}
+
+func resource(apiVersion, kind, name string) *unstructured.Unstructured {
+	res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	res.SetAPIVersion(apiVersion)
+	res.SetKind(kind)
+	res.SetName(name)
+	res.SetNamespace("default")
+	return res
+}
+
+var _ = Describe("Trait utilities", func() {
+	ctx := context.Background()
+
+	It("Test locating the replica field of a resource", func() {
+		document := fakeDocument{
+			{Group: "apps", Version: "v1", Kind: "Deployment"}: specSchema(map[string]proto.Schema{
+				"replicas": &proto.Primitive{Type: "integer"},
+			}),
+			{Group: "core.oam.dev", Version: "v1alpha2", Kind: "ContainerizedWorkload"}: specSchema(map[string]proto.Schema{
+				"containers": &proto.Array{SubType: &proto.Kind{}},
+			}),
+			{Group: "example.com", Version: "v1", Kind: "Game"}: specSchema(map[string]proto.Schema{
+				"replicas": &proto.Primitive{Type: "string"},
+			}),
+			{Group: "example.com", Version: "v1", Kind: "Shard"}: specSchema(map[string]proto.Schema{
+				"replicas": &proto.Kind{Fields: map[string]proto.Schema{"count": &proto.Primitive{Type: "integer"}}},
+			}),
+			{Version: "v1", Kind: "ConfigMap"}: &proto.Kind{Fields: map[string]proto.Schema{
+				"data": &proto.Map{SubType: &proto.Primitive{Type: "string"}},
+			}},
+		}
+		cases := map[string]struct {
+			res  *unstructured.Unstructured
+			want bool
+		}{
+			"An integer replica field": {
+				res:  resource("apps/v1", "Deployment", "app"),
+				want: true,
+			},
+			"No replica field": {
+				res:  resource("core.oam.dev/v1alpha2", "ContainerizedWorkload", "app"),
+				want: false,
+			},
+			"A string replica field": {
+				res:  resource("example.com/v1", "Game", "app"),
+				want: false,
+			},
+			"An object replica field": {
+				res:  resource("example.com/v1", "Shard", "app"),
+				want: false,
+			},
+			"No spec of a core kind": {
+				res:  resource("v1", "ConfigMap", "app"),
+				want: false,
+			},
+			"A kind without a schema": {
+				res:  resource("example.com/v1", "Unknown", "app"),
+				want: false,
+			},
+			"A version without a schema": {
+				res:  resource("apps/v1beta1", "Deployment", "app"),
+				want: false,
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			Expect(LocateReplicaField(document, tc.res)).Should(Equal(tc.want), name)
+		}
+	})
+
+	It("Test rendering the fields of a scaled resource", func() {
+		res := resource("apps/v1", "Deployment", "app")
+		res.SetLabels(map[string]string{"app": "shop"})
+		_ = unstructured.SetNestedField(res.Object, "image", "spec", "template", "spec", "image")
+		owner := metav1.OwnerReference{APIVersion: "core.oam.dev/v1alpha2", Kind: "ManualScalerTrait", Name: "scaler",
+			UID: "trait-uid"}
+
+		scaled := RenderScaledResource(res, owner, 3)
+		Expect(scaled.Object).Should(Equal(map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      "app",
+				"namespace": "default",
+				"ownerReferences": []interface{}{map[string]interface{}{
+					"apiVersion": "core.oam.dev/v1alpha2",
+					"kind":       "ManualScalerTrait",
+					"name":       "scaler",
+					"uid":        "trait-uid",
+				}},
+			},
+			"spec": map[string]interface{}{"replicas": int64(3)},
+		}))
+		By("Leaving the resource alone")
+		_, found, _ := unstructured.NestedFieldNoCopy(res.Object, "spec", "replicas")
+		Expect(found).Should(BeFalse())
+	})
+
+	It("Test fetching the resources a trait may scale", func() {
+		workload := resource("core.oam.dev/v1alpha2", "ContainerizedWorkload", "app")
+		workload.SetUID("workload-uid")
+		child := func(name string, owner types.UID) unstructured.Unstructured {
+			res := resource("apps/v1", "Deployment", name)
+			res.SetOwnerReferences([]metav1.OwnerReference{{UID: owner}})
+			return *res
+		}
+		children := []unstructured.Unstructured{child("owned", "workload-uid"), child("other", "other-uid")}
+		definition := func(childKinds ...v1alpha2.ChildResourceKind) test.MockGetFn {
+			return func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+				Expect(key.Name).Should(Equal("containerizedworkloads.core.oam.dev"))
+				obj.(*v1alpha2.WorkloadDefinition).Spec.ChildResourceKinds = childKinds
+				return nil
+			}
+		}
+		list := func(_ context.Context, obj runtime.Object, _ ...client.ListOption) error {
+			obj.(*unstructured.UnstructuredList).Items = children
+			return nil
+		}
+		errBoom := errors.New("boom")
+
+		cases := map[string]struct {
+			c       *test.MockClient
+			want    []string
+			wantErr error
+		}{
+			"The child resources the workload owns": {
+				c: &test.MockClient{
+					MockGet:  definition(v1alpha2.ChildResourceKind{APIVersion: "apps/v1", Kind: "Deployment"}),
+					MockList: list,
+				},
+				want: []string{"owned"},
+			},
+			"The workload without child resources": {
+				c:    &test.MockClient{MockGet: definition()},
+				want: []string{"app"},
+			},
+			"No WorkloadDefinition": {
+				c:       &test.MockClient{MockGet: test.NewMockGetFn(errBoom)},
+				wantErr: errBoom,
+			},
+		}
+		for name, tc := range cases {
+			By(fmt.Sprint("Running test: ", name))
+			resources, err := FetchScaleCandidates(ctx, logf.Log, tc.c, workload)
+			if tc.wantErr != nil {
+				Expect(err).Should(MatchError(tc.wantErr), name)
+				continue
+			}
+			Expect(err).Should(BeNil(), name)
+			names := make([]string, 0, len(resources))
+			for _, res := range resources {
+				names = append(names, res.GetName())
+			}
+			Expect(names).Should(Equal(tc.want), name)
+		}
+	})
+
+	It("Test fetching the workload of a trait", func() {
+		trait := &v1alpha2.ManualScalerTrait{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+			Spec: v1alpha2.ManualScalerTraitSpec{WorkloadReference: cpv1alpha1.TypedReference{
+				APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload", Name: "app"}},
+		}
+		c := &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+			Expect(key).Should(Equal(client.ObjectKey{Namespace: "default", Name: "app"}))
+			obj.(*unstructured.Unstructured).SetUID("workload-uid")
+			return nil
+		}}
+		workload, _, err := FetchWorkload(ctx, c, logf.Log, trait)
+		Expect(err).Should(BeNil())
+		Expect(workload.GetUID()).Should(BeEquivalentTo("workload-uid"))
+		Expect(workload.GetKind()).Should(Equal("ContainerizedWorkload"))
+
+		By("Reporting a missing workload on the trait")
+		notFound := kerrors.NewNotFound(schema.GroupResource{Resource: "containerizedworkloads"}, "app")
+		c = &test.MockClient{
+			MockGet:         test.NewMockGetFn(notFound),
+			MockStatusPatch: test.NewMockStatusPatchFn(nil),
+		}
+		workload, result, err := FetchWorkload(ctx, c, logf.Log, trait)
+		Expect(err).Should(BeNil())
+		Expect(workload).Should(BeNil())
+		Expect(result.RequeueAfter).ShouldNot(BeZero())
+		cond := trait.GetCondition(cpv1alpha1.TypeSynced)
+		Expect(cond.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(cond.Message).Should(ContainSubstring(ErrLocateWorkload))
+
+		By("Patching the given conditions along with the reconcile error")
+		_, _, err = FetchWorkload(ctx, c, logf.Log, trait, cpv1alpha1.Unavailable())
+		Expect(err).Should(BeNil())
+		Expect(trait.GetCondition(cpv1alpha1.TypeSynced).Status).Should(Equal(corev1.ConditionFalse))
+		Expect(trait.GetCondition(cpv1alpha1.TypeReady).Status).Should(Equal(corev1.ConditionFalse))
+	})
+})
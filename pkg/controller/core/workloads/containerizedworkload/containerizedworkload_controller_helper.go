@@ -34,7 +34,8 @@ func (r *Reconciler) renderDeployment(ctx context.Context,
 	deploy.Namespace = workload.Namespace
 	// make sure we don't have opinion on the replica count
 	deploy.Spec.Replicas = nil
-	// k8s server-side patch complains if the protocol is not set
+	// k8s server-side patch complains if the protocol is not set, the
+	// defaulting webhook sets it but workloads admitted before it may lack it
 	for i := 0; i < len(deploy.Spec.Template.Spec.Containers); i++ {
 		for j := 0; j < len(deploy.Spec.Template.Spec.Containers[i].Ports); j++ {
 			if len(deploy.Spec.Template.Spec.Containers[i].Ports[j].Protocol) == 0 {
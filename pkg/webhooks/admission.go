@@ -0,0 +1,345 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	adminv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// A ValidateFunc validates an object decoded from an admission request. The
+// old object is nil when the object is created, and the new object is nil
+// when it is deleted.
+type ValidateFunc func(ctx context.Context, oldObj, newObj runtime.Object) field.ErrorList
+
+// A MutateFunc mutates an object decoded from an admission request in place.
+// The old object is nil when the object is created.
+type MutateFunc func(ctx context.Context, oldObj, newObj runtime.Object) error
+
+// A Validator is a validating webhook for one kind of object. Each operation
+// is validated by its own function, an operation without one is allowed.
+type Validator struct {
+	// Object is an empty object of the validated kind, e.g. &v1alpha2.ManualScalerTrait{}
+	Object runtime.Object
+	// Path is served instead of the one generated from the object's kind if set.
+	Path string
+	Log  logr.Logger
+
+	OnCreate ValidateFunc
+	OnUpdate ValidateFunc
+	OnDelete ValidateFunc
+
+	gvk schema.GroupVersionKind
+	gvr metav1.GroupVersionResource
+}
+
+// A Mutator is a mutating webhook for one kind of object. Each operation is
+// mutated by its own function, an operation without one is left unchanged.
+type Mutator struct {
+	// Object is an empty object of the mutated kind, e.g. &v1alpha2.ManualScalerTrait{}
+	Object runtime.Object
+	// Path is served instead of the one generated from the object's kind if set.
+	Path string
+	Log  logr.Logger
+
+	OnCreate MutateFunc
+	OnUpdate MutateFunc
+
+	gvk schema.GroupVersionKind
+	gvr metav1.GroupVersionResource
+}
+
+// SetupWebhookWithManager registers the validator at its path, by default
+// validate_path_prefix followed by the path generated from its kind.
+func (v *Validator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := v.complete(mgr.GetScheme()); err != nil {
+		return err
+	}
+	path := v.Path
+	if len(path) == 0 {
+		path = validate_path_prefix + generatePath(v.gvk)
+	}
+	return RegisterWebhookWithManager(mgr, path, v)
+}
+
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	convertToHttpHandler(v.validate, v.Log)(w, r)
+}
+
+// complete derives the kind and the expected resource from the scheme.
+func (v *Validator) complete(s *runtime.Scheme) error {
+	var err error
+	v.gvk, v.gvr, err = kindAndResource(v.Object, s)
+	return err
+}
+
+func (v *Validator) validate(ctx context.Context, ar adminv1.AdmissionReview) *adminv1.AdmissionResponse {
+	if ar.Request == nil {
+		return toErrAdmissionResponse(errNoRequest, http.StatusBadRequest)
+	}
+	log := v.Log.WithValues("name", ar.Request.Name, "Operation", ar.Request.Operation)
+	log.Info("Start to validate", "kind", v.gvk.Kind)
+
+	oldObj, newObj, err := decodeRequest(v.Object, v.gvr, ar.Request)
+	if err != nil {
+		log.Error(err, "cannot admit the request")
+		return toErrAdmissionResponse(err, http.StatusBadRequest)
+	}
+
+	var warnings []string
+	ctx = context.WithValue(ctx, warningsKey{}, &warnings)
+	var errs field.ErrorList
+	switch ar.Request.Operation {
+	case adminv1.Create:
+		if v.OnCreate != nil {
+			errs = v.OnCreate(ctx, nil, newObj)
+		}
+	case adminv1.Update:
+		if v.OnUpdate != nil {
+			errs = v.OnUpdate(ctx, oldObj, newObj)
+		}
+	case adminv1.Delete:
+		if v.OnDelete != nil {
+			errs = v.OnDelete(ctx, oldObj, nil)
+		}
+	}
+	if len(errs) > 0 {
+		log.Info("object not valid", "errors", errs.ToAggregate().Error())
+		status := apierrors.NewInvalid(v.gvk.GroupKind(), ar.Request.Name, errs).Status()
+		return &adminv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &status,
+		}
+	}
+	resp := allowedResponse()
+	if len(warnings) > 0 {
+		log.Info("object admitted with warnings", "warnings", warnings)
+		resp.AuditAnnotations = map[string]string{
+			"warnings": strings.Join(warnings, "; "),
+		}
+	}
+	return resp
+}
+
+// SetupWebhookWithManager registers the mutator at its path, by default
+// mutate_path_prefix followed by the path generated from its kind.
+func (m *Mutator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := m.complete(mgr.GetScheme()); err != nil {
+		return err
+	}
+	path := m.Path
+	if len(path) == 0 {
+		path = mutate_path_prefix + generatePath(m.gvk)
+	}
+	return RegisterWebhookWithManager(mgr, path, m)
+}
+
+func (m *Mutator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	convertToHttpHandler(m.mutate, m.Log)(w, r)
+}
+
+// complete derives the kind and the expected resource from the scheme.
+func (m *Mutator) complete(s *runtime.Scheme) error {
+	var err error
+	m.gvk, m.gvr, err = kindAndResource(m.Object, s)
+	return err
+}
+
+func (m *Mutator) mutate(ctx context.Context, ar adminv1.AdmissionReview) *adminv1.AdmissionResponse {
+	if ar.Request == nil {
+		return toErrMutateResponse(errNoRequest, http.StatusBadRequest)
+	}
+	log := m.Log.WithValues("name", ar.Request.Name, "Operation", ar.Request.Operation)
+	log.Info("Start to mutate", "kind", m.gvk.Kind)
+
+	oldObj, newObj, err := decodeRequest(m.Object, m.gvr, ar.Request)
+	if err != nil {
+		log.Error(err, "cannot admit the request")
+		return toErrMutateResponse(err, http.StatusBadRequest)
+	}
+
+	var defaulted []string
+	ctx = context.WithValue(ctx, defaultedKey{}, &defaulted)
+	switch ar.Request.Operation {
+	case adminv1.Create:
+		if m.OnCreate != nil {
+			err = m.OnCreate(ctx, nil, newObj)
+		}
+	case adminv1.Update:
+		if m.OnUpdate != nil {
+			err = m.OnUpdate(ctx, oldObj, newObj)
+		}
+	default:
+		return allowedResponse()
+	}
+	if err != nil {
+		log.Error(err, "failed to mutate")
+		return toErrMutateResponse(err, http.StatusBadRequest)
+	}
+
+	mutated, err := json.Marshal(newObj)
+	if err != nil {
+		log.Error(err, "failed to marshal the mutated object")
+		return toErrMutateResponse(err, http.StatusInternalServerError)
+	}
+	// generate the patch using a lib
+	patches, err := patchResponseFromRaw(ar.Request.Object.Raw, mutated)
+	if err != nil {
+		log.Error(err, "failed to generate the patch")
+		return toErrMutateResponse(err, http.StatusInternalServerError)
+	}
+	resp := allowedResponse()
+	resp.AuditAnnotations = map[string]string{
+		"mutator": generatePath(m.gvk),
+	}
+	if len(defaulted) > 0 {
+		log.Info("object defaulted", "fields", defaulted)
+		resp.AuditAnnotations["defaulted"] = strings.Join(defaulted, ", ")
+	}
+	if len(patches) == 0 {
+		return resp
+	}
+	patchBytes, err := json.Marshal(patches)
+	if err != nil {
+		log.Error(err, "failed to marshal the patch")
+		return toErrMutateResponse(err, http.StatusInternalServerError)
+	}
+	resp.Patch = patchBytes
+	resp.PatchType = &pT
+	return resp
+}
+
+var errNoRequest = fmt.Errorf("admission review has no request")
+
+type warningsKey struct{}
+
+// warn records a warning about the object a ValidateFunc is validating. The
+// warnings do not deny the request, they are logged and added to its audit
+// annotations. The client that sent the request never sees them: the
+// admission.k8s.io/v1 AdmissionResponse of the Kubernetes API we build
+// against has no warnings field, so they only show in the webhook's log and
+// the API server's audit log.
+func warn(ctx context.Context, format string, args ...interface{}) {
+	if warnings, ok := ctx.Value(warningsKey{}).(*[]string); ok {
+		*warnings = append(*warnings, fmt.Sprintf(format, args...))
+	}
+}
+
+type defaultedKey struct{}
+
+// setDefault records that a MutateFunc defaulted the field at the supplied
+// path, the defaulted fields are added to the audit annotations of the request.
+func setDefault(ctx context.Context, fldPath *field.Path) {
+	if defaulted, ok := ctx.Value(defaultedKey{}).(*[]string); ok {
+		*defaulted = append(*defaulted, fldPath.String())
+	}
+}
+
+// validateAnnotations validates the annotations of an object with the supplied
+// function. An update is only denied for the errors it introduces, so that an
+// object that was stored before the webhook was installed can still be
+// updated, e.g. by its controller.
+func validateAnnotations(validate func(map[string]string) field.ErrorList, oldObj, newObj runtime.Object) field.ErrorList {
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return field.ErrorList{field.InternalError(field.NewPath("metadata"), err)}
+	}
+	errs := validate(newMeta.GetAnnotations())
+	oldMeta, err := meta.Accessor(oldObj)
+	if oldObj == nil || err != nil || len(errs) == 0 {
+		return errs
+	}
+	return introducedErrors(errs, validate(oldMeta.GetAnnotations()))
+}
+
+// introducedErrors returns the errors of an updated object that the old
+// object did not have.
+func introducedErrors(errs, oldErrs field.ErrorList) field.ErrorList {
+	known := make(map[field.Error]bool)
+	for _, e := range oldErrs {
+		known[*e] = true
+	}
+	var introduced field.ErrorList
+	for _, e := range errs {
+		if !known[*e] {
+			introduced = append(introduced, e)
+		}
+	}
+	return introduced
+}
+
+// kindAndResource returns the kind of the supplied object registered with
+// the scheme, and the resource admission requests for it are expected for.
+func kindAndResource(obj runtime.Object, s *runtime.Scheme) (schema.GroupVersionKind, metav1.GroupVersionResource, error) {
+	if obj == nil {
+		return schema.GroupVersionKind{}, metav1.GroupVersionResource{}, fmt.Errorf("webhook has no object")
+	}
+	gvk, err := apiutil.GVKForObject(obj, s)
+	if err != nil {
+		return schema.GroupVersionKind{}, metav1.GroupVersionResource{}, err
+	}
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return gvk, metav1.GroupVersionResource{Group: plural.Group, Version: plural.Version, Resource: plural.Resource}, nil
+}
+
+// decodeRequest checks the request is for the expected resource and decodes
+// its old and new object into copies of the supplied empty object. An object
+// the request does not carry is nil.
+func decodeRequest(empty runtime.Object, expected metav1.GroupVersionResource,
+	req *adminv1.AdmissionRequest) (oldObj, newObj runtime.Object, err error) {
+	if req.Resource != expected {
+		return nil, nil, fmt.Errorf("wrong resource, expected %+v, got %+v ", expected, req.Resource)
+	}
+	deserializer := codecs.UniversalDeserializer()
+	if len(req.Object.Raw) != 0 {
+		newObj = empty.DeepCopyObject()
+		if _, _, err := deserializer.Decode(req.Object.Raw, nil, newObj); err != nil {
+			return nil, nil, err
+		}
+	} else if req.Operation == adminv1.Create || req.Operation == adminv1.Update {
+		return nil, nil, fmt.Errorf("%s request has no object", req.Operation)
+	}
+	if len(req.OldObject.Raw) != 0 {
+		oldObj = empty.DeepCopyObject()
+		if _, _, err := deserializer.Decode(req.OldObject.Raw, nil, oldObj); err != nil {
+			return nil, nil, err
+		}
+	}
+	return oldObj, newObj, nil
+}
+
+func allowedResponse() *adminv1.AdmissionResponse {
+	return &adminv1.AdmissionResponse{
+		Allowed: true,
+		Result: &metav1.Status{
+			Status: metav1.StatusSuccess,
+		},
+	}
+}
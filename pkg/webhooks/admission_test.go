@@ -0,0 +1,182 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	oamapi "github.com/crossplane/oam-kubernetes-runtime/apis/core"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"gomodules.xyz/jsonpatch/v2"
+	adminv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var traitResource = metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha2", Resource: "manualscalertraits"}
+
+func oamScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	Expect(oamapi.AddToScheme(s)).Should(Succeed())
+	return s
+}
+
+func traitRaw(replicas int32, ref v1alpha1.TypedReference) []byte {
+	t := v1alpha2.ManualScalerTrait{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "core.oam.dev/v1alpha2", Kind: "ManualScalerTrait"},
+		ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: "default"},
+		Spec:       v1alpha2.ManualScalerTraitSpec{ReplicaCount: replicas, WorkloadReference: ref},
+	}
+	raw, err := json.Marshal(t)
+	Expect(err).Should(BeNil())
+	return raw
+}
+
+func review(op adminv1.Operation, oldRaw, newRaw []byte) adminv1.AdmissionReview {
+	return adminv1.AdmissionReview{
+		Request: &adminv1.AdmissionRequest{
+			UID:       types.UID("uid"),
+			Name:      "scaler",
+			Namespace: "default",
+			Resource:  traitResource,
+			Operation: op,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		},
+	}
+}
+
+var _ = Describe("Typed admission webhooks", func() {
+	ctx := context.Background()
+	ref := v1alpha1.TypedReference{APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload", Name: "wl"}
+
+	It("derives the kind and expected resource from the scheme", func() {
+		v := &Validator{Object: &v1alpha2.ManualScalerTrait{}, Log: logf.Log}
+		Expect(v.complete(oamScheme())).Should(Succeed())
+		Expect(v.gvk).Should(Equal(v1alpha2.ManualScalerTraitGroupVersionKind))
+		Expect(v.gvr).Should(Equal(traitResource))
+
+		Expect((&Validator{Object: &v1alpha2.ManualScalerTrait{}}).complete(runtime.NewScheme())).ShouldNot(Succeed())
+		Expect((&Mutator{}).complete(oamScheme())).ShouldNot(Succeed())
+	})
+
+	It("dispatches each operation with the decoded objects", func() {
+		var called adminv1.Operation
+		var gotOld, gotNew runtime.Object
+		record := func(op adminv1.Operation) ValidateFunc {
+			return func(_ context.Context, oldObj, newObj runtime.Object) field.ErrorList {
+				called, gotOld, gotNew = op, oldObj, newObj
+				return nil
+			}
+		}
+		v := &Validator{Object: &v1alpha2.ManualScalerTrait{}, Log: logf.Log,
+			OnCreate: record(adminv1.Create), OnUpdate: record(adminv1.Update), OnDelete: record(adminv1.Delete)}
+		Expect(v.complete(oamScheme())).Should(Succeed())
+
+		resp := v.validate(ctx, review(adminv1.Create, nil, traitRaw(3, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(called).Should(Equal(adminv1.Create))
+		Expect(gotOld).Should(BeNil())
+		Expect(gotNew.(*v1alpha2.ManualScalerTrait).Spec.ReplicaCount).Should(BeEquivalentTo(3))
+
+		resp = v.validate(ctx, review(adminv1.Update, traitRaw(3, ref), traitRaw(5, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(called).Should(Equal(adminv1.Update))
+		Expect(gotOld.(*v1alpha2.ManualScalerTrait).Spec.ReplicaCount).Should(BeEquivalentTo(3))
+		Expect(gotNew.(*v1alpha2.ManualScalerTrait).Spec.ReplicaCount).Should(BeEquivalentTo(5))
+
+		resp = v.validate(ctx, review(adminv1.Delete, traitRaw(5, ref), nil))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(called).Should(Equal(adminv1.Delete))
+		Expect(gotOld.(*v1alpha2.ManualScalerTrait).Spec.ReplicaCount).Should(BeEquivalentTo(5))
+		Expect(gotNew).Should(BeNil())
+	})
+
+	It("rejects requests it cannot admit", func() {
+		v := &Validator{Object: &v1alpha2.ManualScalerTrait{}, Log: logf.Log}
+		Expect(v.complete(oamScheme())).Should(Succeed())
+
+		ar := review(adminv1.Create, nil, traitRaw(3, ref))
+		ar.Request.Resource.Resource = "containerizedworkloads"
+		resp := v.validate(ctx, ar)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+
+		resp = v.validate(ctx, review(adminv1.Create, nil, nil))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+
+		resp = v.validate(ctx, review(adminv1.Create, nil, []byte("{not json")))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+
+		resp = v.validate(ctx, adminv1.AdmissionReview{})
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("reports field errors as an invalid object", func() {
+		v := ManualScalerTraitValidator{Log: logf.Log}.validator()
+		Expect(v.complete(oamScheme())).Should(Succeed())
+
+		resp := v.validate(ctx, review(adminv1.Create, nil, traitRaw(3, v1alpha1.TypedReference{Name: "wl"})))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+		Expect(resp.Result.Reason).Should(Equal(metav1.StatusReasonInvalid))
+		Expect(resp.Result.Message).Should(ContainSubstring("spec.workloadRef"))
+		Expect(resp.Result.Details.Causes).Should(HaveLen(1))
+		Expect(resp.Result.Details.Causes[0].Field).Should(Equal("spec.workloadRef"))
+
+		resp = v.validate(ctx, review(adminv1.Update, traitRaw(3, ref), traitRaw(5, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+	})
+
+	It("patches the mutated object", func() {
+		m := ManualScalerTraitMutater{Log: logf.Log}.mutator()
+		Expect(m.complete(oamScheme())).Should(Succeed())
+
+		resp := m.mutate(ctx, review(adminv1.Create, nil, traitRaw(3, v1alpha1.TypedReference{Name: "wl"})))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.PatchType).ShouldNot(BeNil())
+		Expect(*resp.PatchType).Should(Equal(adminv1.PatchTypeJSONPatch))
+		Expect(resp.AuditAnnotations).Should(HaveKeyWithValue("mutator", "core-oam-dev-v1alpha2-manualscalertrait"))
+		var patches []jsonpatch.Operation
+		Expect(json.Unmarshal(resp.Patch, &patches)).Should(Succeed())
+		Expect(patches).Should(ConsistOf(
+			jsonpatch.Operation{Operation: "replace", Path: "/spec/workloadRef/kind", Value: "ContainerizedWorkload"},
+			jsonpatch.Operation{Operation: "replace", Path: "/spec/workloadRef/apiVersion", Value: "core.oam.dev/v1alpha2"},
+		))
+
+		By("Leaving an object that needs no mutation unpatched")
+		resp = m.mutate(ctx, review(adminv1.Update, traitRaw(3, ref), traitRaw(5, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Patch).Should(BeEmpty())
+		Expect(resp.PatchType).Should(BeNil())
+	})
+
+	It("serves admission reviews over HTTP", func() {
+		v := ManualScalerTraitValidator{Log: logf.Log}.validator()
+		Expect(v.complete(oamScheme())).Should(Succeed())
+
+		body, err := json.Marshal(review(adminv1.Create, nil, traitRaw(3, ref)))
+		Expect(err).Should(BeNil())
+		r := httptest.NewRequest(http.MethodPost, "/validate-core-oam-dev-v1alpha2-manualscalertrait", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		v.ServeHTTP(w, r)
+
+		got := adminv1.AdmissionReview{}
+		Expect(json.Unmarshal(w.Body.Bytes(), &got)).Should(Succeed())
+		Expect(got.Response).ShouldNot(BeNil())
+		Expect(got.Response.UID).Should(Equal(types.UID("uid")))
+		Expect(got.Response.Allowed).Should(BeTrue())
+	})
+})
@@ -0,0 +1,440 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	admregv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The names of the webhook configurations of the helm chart, whose caBundle
+// the CertManager patches by default.
+const (
+	ValidatingWebhookConfigurationName = "validating-webhook-configuration"
+	MutatingWebhookConfigurationName   = "mutating-webhook-configuration"
+)
+
+// The defaults of the CertManager.
+const (
+	defaultCertValidity  = 365 * 24 * time.Hour
+	defaultRotateBefore  = 30 * 24 * time.Hour
+	defaultCheckInterval = time.Hour
+	certKeySize          = 2048
+)
+
+// The keys of the Secret the certificates are stored in, the same a
+// cert-manager Certificate uses.
+const (
+	caCertKey = "ca.crt"
+	certKey   = corev1.TLSCertKey
+	keyKey    = corev1.TLSPrivateKeyKey
+)
+
+// Cert manager error strings.
+const (
+	errGetCertSecret      = "cannot get the webhook certificate secret"
+	errStoreCertSecret    = "cannot store the webhook certificate secret"
+	errGenerateCerts      = "cannot generate the webhook certificates"
+	errWriteCertFile      = "cannot write the webhook certificate file %s"
+	errPatchCABundle      = "cannot patch the caBundle of webhook configuration %s"
+	errNoWebhookService   = "the webhook service name and namespace are required to generate its certificate"
+	errCertPEMBlockAbsent = "no PEM encoded certificate found"
+)
+
+// A CertManager generates the certificates of the webhook server in process,
+// so that the webhooks can be served without cert-manager. It generates a
+// self-signed CA and a serving certificate for the webhook service, stores
+// them in a Secret shared by all the replicas, writes them to the directory
+// the webhook server reads them from, and patches the caBundle of the webhook
+// configurations. Both are regenerated before the serving certificate expires,
+// the caBundle keeps trusting the previous CA until it expires so that the
+// replicas that have not yet read the new certificate are still trusted.
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations;mutatingwebhookconfigurations,verbs=get;update
+type CertManager struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Service and Namespace are the name and namespace of the webhook service.
+	// The Secret is stored in the same namespace.
+	Service   string
+	Namespace string
+	// Secret is the name of the Secret the certificates are stored in.
+	Secret string
+	// CertDir is the directory the webhook server reads tls.crt and tls.key from.
+	CertDir string
+
+	// ValidatingWebhookConfigurations and MutatingWebhookConfigurations are
+	// the configurations whose caBundle is patched, those of the helm chart
+	// unless set.
+	ValidatingWebhookConfigurations []string
+	MutatingWebhookConfigurations   []string
+
+	// Validity of the generated certificates, a year unless set.
+	Validity time.Duration
+	// RotateBefore is how long before the serving certificate expires it is
+	// regenerated, 30 days unless set.
+	RotateBefore time.Duration
+	// CheckInterval is how often the certificates are checked, an hour unless set.
+	CheckInterval time.Duration
+
+	now func() time.Time
+}
+
+// Start keeps the certificates up to date until the stop channel is closed.
+// Provision should be called once before the webhook server starts so that
+// it has certificates to serve.
+func (m *CertManager) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(m.checkInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := m.Provision(ctx); err != nil {
+				m.Log.Error(err, "cannot provision the webhook certificates, will retry", "interval", m.checkInterval())
+			}
+			cancel()
+		}
+	}
+}
+
+// NeedLeaderElection is false because every replica serves the webhooks and
+// needs the certificate files.
+func (m *CertManager) NeedLeaderElection() bool {
+	return false
+}
+
+// Provision makes sure the Secret holds certificates that are not about to
+// expire, patches the caBundle of the webhook configurations and writes the
+// serving certificate files, in that order so that the API server trusts a
+// certificate before it is served.
+func (m *CertManager) Provision(ctx context.Context) error {
+	if len(m.Service) == 0 || len(m.Namespace) == 0 {
+		return errors.New(errNoWebhookService)
+	}
+	var secret *corev1.Secret
+	// the replicas race to create and rotate the secret, the loser adopts the winner's one
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(errors.Cause(err)) || apierrors.IsAlreadyExists(errors.Cause(err))
+	}, func() error {
+		var err error
+		secret, err = m.ensureSecret(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	caBundle := secret.Data[caCertKey]
+	for _, name := range m.validatingWebhookConfigurations() {
+		if err := m.patchValidatingCABundle(ctx, name, caBundle); err != nil {
+			return errors.Wrapf(err, errPatchCABundle, name)
+		}
+	}
+	for _, name := range m.mutatingWebhookConfigurations() {
+		if err := m.patchMutatingCABundle(ctx, name, caBundle); err != nil {
+			return errors.Wrapf(err, errPatchCABundle, name)
+		}
+	}
+	for _, file := range []string{keyKey, certKey} {
+		if err := writeFileIfChanged(filepath.Join(m.CertDir, file), secret.Data[file]); err != nil {
+			return errors.Wrapf(err, errWriteCertFile, file)
+		}
+	}
+	return nil
+}
+
+// ensureSecret returns the Secret, after creating it or rotating its
+// certificates if they are missing, invalid or about to expire.
+func (m *CertManager) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := m.Client.Get(ctx, client.ObjectKey{Namespace: m.Namespace, Name: m.Secret}, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		data, err := m.generate(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, errGenerateCerts)
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: m.Namespace, Name: m.Secret},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+		m.Log.Info("Generated the webhook certificates", "secret", m.Secret)
+		return secret, errors.Wrap(m.Client.Create(ctx, secret), errStoreCertSecret)
+	case err != nil:
+		return nil, errors.Wrap(err, errGetCertSecret)
+	}
+
+	reason := m.rotationReason(secret.Data)
+	if len(reason) == 0 {
+		return secret, nil
+	}
+	data, err := m.generate(secret.Data[caCertKey])
+	if err != nil {
+		return nil, errors.Wrap(err, errGenerateCerts)
+	}
+	secret.Data = data
+	m.Log.Info("Rotated the webhook certificates", "secret", m.Secret, "reason", reason)
+	return secret, errors.Wrap(m.Client.Update(ctx, secret), errStoreCertSecret)
+}
+
+// rotationReason explains why the certificates need to be regenerated, it is
+// empty if they don't.
+func (m *CertManager) rotationReason(data map[string][]byte) string {
+	cert, err := parseCertificate(data[certKey])
+	if err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+	if _, err := tls.X509KeyPair(data[certKey], data[keyKey]); err != nil {
+		return fmt.Sprintf("invalid serving key: %v", err)
+	}
+	if len(data[caCertKey]) == 0 {
+		return "no CA certificate"
+	}
+	if err := cert.VerifyHostname(m.dnsNames()[0]); err != nil {
+		return err.Error()
+	}
+	if expiry := cert.NotAfter; m.clock().Add(m.rotateBefore()).After(expiry) {
+		return fmt.Sprintf("the serving certificate expires at %s", expiry.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// generate returns a new CA and a serving certificate signed by it. The
+// returned CA bundle also holds the certificates of the previous bundle that
+// have not yet expired.
+func (m *CertManager) generate(previousBundle []byte) (map[string][]byte, error) {
+	now := m.clock()
+	notAfter := now.Add(m.validity())
+
+	caKey, err := rsa.GenerateKey(rand.Reader, certKeySize)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serialNumber(now),
+		Subject:               pkix.Name{CommonName: m.Service + "-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, certKeySize)
+	if err != nil {
+		return nil, err
+	}
+	dnsNames := m.dnsNames()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(now.Add(time.Nanosecond)),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	for rest := previousBundle; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil && now.Before(c.NotAfter) {
+			bundle = append(bundle, pem.EncodeToMemory(block)...)
+		}
+	}
+	return map[string][]byte{
+		caCertKey: bundle,
+		certKey:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyKey:    pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}, nil
+}
+
+func (m *CertManager) patchValidatingCABundle(ctx context.Context, name string, caBundle []byte) error {
+	config := &admregv1beta1.ValidatingWebhookConfiguration{}
+	return m.patchCABundle(ctx, name, caBundle, config, func() []*admregv1beta1.WebhookClientConfig {
+		clientConfigs := make([]*admregv1beta1.WebhookClientConfig, 0, len(config.Webhooks))
+		for i := range config.Webhooks {
+			clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
+		}
+		return clientConfigs
+	})
+}
+
+func (m *CertManager) patchMutatingCABundle(ctx context.Context, name string, caBundle []byte) error {
+	config := &admregv1beta1.MutatingWebhookConfiguration{}
+	return m.patchCABundle(ctx, name, caBundle, config, func() []*admregv1beta1.WebhookClientConfig {
+		clientConfigs := make([]*admregv1beta1.WebhookClientConfig, 0, len(config.Webhooks))
+		for i := range config.Webhooks {
+			clientConfigs = append(clientConfigs, &config.Webhooks[i].ClientConfig)
+		}
+		return clientConfigs
+	})
+}
+
+// patchCABundle sets the caBundle of the client configs of the webhooks of
+// the named configuration. A configuration that does not exist is skipped.
+func (m *CertManager) patchCABundle(ctx context.Context, name string, caBundle []byte, config runtime.Object,
+	clientConfigs func() []*admregv1beta1.WebhookClientConfig) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := m.Client.Get(ctx, client.ObjectKey{Name: name}, config); err != nil {
+			if apierrors.IsNotFound(err) {
+				m.Log.Info("Skip patching the caBundle of a webhook configuration that does not exist", "name", name)
+				return nil
+			}
+			return err
+		}
+		changed := false
+		for _, cc := range clientConfigs() {
+			if !bytes.Equal(cc.CABundle, caBundle) {
+				cc.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		m.Log.Info("Patching the caBundle of a webhook configuration", "name", name)
+		return m.Client.Update(ctx, config)
+	})
+}
+
+// dnsNames are the names the API server may reach the webhook service at.
+func (m *CertManager) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", m.Service, m.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", m.Service, m.Namespace),
+	}
+}
+
+func (m *CertManager) validatingWebhookConfigurations() []string {
+	if m.ValidatingWebhookConfigurations == nil {
+		return []string{ValidatingWebhookConfigurationName}
+	}
+	return m.ValidatingWebhookConfigurations
+}
+
+func (m *CertManager) mutatingWebhookConfigurations() []string {
+	if m.MutatingWebhookConfigurations == nil {
+		return []string{MutatingWebhookConfigurationName}
+	}
+	return m.MutatingWebhookConfigurations
+}
+
+func (m *CertManager) validity() time.Duration {
+	if m.Validity == 0 {
+		return defaultCertValidity
+	}
+	return m.Validity
+}
+
+func (m *CertManager) rotateBefore() time.Duration {
+	if m.RotateBefore == 0 {
+		return defaultRotateBefore
+	}
+	return m.RotateBefore
+}
+
+func (m *CertManager) checkInterval() time.Duration {
+	if m.CheckInterval == 0 {
+		return defaultCheckInterval
+	}
+	return m.CheckInterval
+}
+
+func (m *CertManager) clock() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+	return m.now()
+}
+
+func serialNumber(t time.Time) *big.Int {
+	return big.NewInt(t.UnixNano())
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New(errCertPEMBlockAbsent)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// writeFileIfChanged replaces the file by renaming a temporary one over it, so
+// that the webhook server never reads a partially written certificate.
+func writeFileIfChanged(path string, data []byte) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,175 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	admregv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Webhook certificate manager", func() {
+	ctx := context.Background()
+	var dir string
+	var now time.Time
+	var c client.Client
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "webhook-certs")
+		Expect(err).Should(BeNil())
+		now = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).Should(Succeed())
+		c = fake.NewFakeClientWithScheme(s,
+			&admregv1beta1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: ValidatingWebhookConfigurationName},
+				Webhooks: []admregv1beta1.ValidatingWebhook{
+					{Name: "a.validate.core.oam.dev", ClientConfig: admregv1beta1.WebhookClientConfig{CABundle: []byte("\n")}},
+					{Name: "b.validate.core.oam.dev", ClientConfig: admregv1beta1.WebhookClientConfig{CABundle: []byte("\n")}},
+				},
+			},
+			&admregv1beta1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: MutatingWebhookConfigurationName},
+				Webhooks: []admregv1beta1.MutatingWebhook{
+					{Name: "a.mutate.core.oam.dev", ClientConfig: admregv1beta1.WebhookClientConfig{CABundle: []byte("\n")}},
+				},
+			},
+		)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).Should(Succeed())
+	})
+
+	certManager := func(certDir string) *CertManager {
+		return &CertManager{
+			Client:    c,
+			Log:       logf.Log,
+			Service:   "oam",
+			Namespace: "oam-system",
+			Secret:    "webhook-server-cert",
+			CertDir:   certDir,
+			now:       func() time.Time { return now },
+		}
+	}
+
+	secret := func() *corev1.Secret {
+		s := &corev1.Secret{}
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "oam-system", Name: "webhook-server-cert"}, s)).Should(Succeed())
+		return s
+	}
+
+	caBundles := func() [][]byte {
+		vwc := &admregv1beta1.ValidatingWebhookConfiguration{}
+		Expect(c.Get(ctx, client.ObjectKey{Name: ValidatingWebhookConfigurationName}, vwc)).Should(Succeed())
+		mwc := &admregv1beta1.MutatingWebhookConfiguration{}
+		Expect(c.Get(ctx, client.ObjectKey{Name: MutatingWebhookConfigurationName}, mwc)).Should(Succeed())
+		return [][]byte{vwc.Webhooks[0].ClientConfig.CABundle, vwc.Webhooks[1].ClientConfig.CABundle,
+			mwc.Webhooks[0].ClientConfig.CABundle}
+	}
+
+	// expectProvisioned checks the files and the caBundles match the secret,
+	// and that the serving certificate is trusted by the caBundle.
+	expectProvisioned := func(certDir string) *corev1.Secret {
+		s := secret()
+		for _, file := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+			data, err := ioutil.ReadFile(filepath.Join(certDir, file))
+			Expect(err).Should(BeNil())
+			Expect(data).Should(Equal(s.Data[file]), file)
+		}
+		for _, caBundle := range caBundles() {
+			Expect(caBundle).Should(Equal(s.Data["ca.crt"]))
+		}
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(s.Data["ca.crt"])).Should(BeTrue())
+		cert, err := parseCertificate(s.Data[corev1.TLSCertKey])
+		Expect(err).Should(BeNil())
+		for _, name := range []string{"oam.oam-system.svc", "oam.oam-system.svc.cluster.local"} {
+			_, err = cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: now})
+			Expect(err).Should(BeNil(), name)
+		}
+		return s
+	}
+
+	bundleSize := func(bundle []byte) int {
+		n := 0
+		for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+			n++
+		}
+		return n
+	}
+
+	It("generates the certificates and patches the caBundles", func() {
+		m := certManager(dir)
+		Expect(m.Provision(ctx)).Should(Succeed())
+		s := expectProvisioned(dir)
+		Expect(s.Type).Should(Equal(corev1.SecretTypeTLS))
+		Expect(bundleSize(s.Data["ca.crt"])).Should(Equal(1))
+
+		By("Leaving certificates that are not about to expire alone")
+		Expect(m.Provision(ctx)).Should(Succeed())
+		Expect(secret().Data).Should(Equal(s.Data))
+
+		By("Sharing the certificates with the other replicas")
+		other := filepath.Join(dir, "other")
+		Expect(certManager(other).Provision(ctx)).Should(Succeed())
+		Expect(expectProvisioned(other).Data).Should(Equal(s.Data))
+	})
+
+	It("rotates the certificates before they expire", func() {
+		m := certManager(dir)
+		Expect(m.Provision(ctx)).Should(Succeed())
+		first := expectProvisioned(dir)
+
+		now = now.Add(defaultCertValidity - defaultRotateBefore + time.Hour)
+		Expect(m.Provision(ctx)).Should(Succeed())
+		second := expectProvisioned(dir)
+		Expect(second.Data[corev1.TLSCertKey]).ShouldNot(Equal(first.Data[corev1.TLSCertKey]))
+		By("Trusting the previous CA until it expires")
+		Expect(bundleSize(second.Data["ca.crt"])).Should(Equal(2))
+		Expect(string(second.Data["ca.crt"])).Should(HaveSuffix(string(first.Data["ca.crt"])))
+
+		now = now.Add(defaultCertValidity - defaultRotateBefore + time.Hour)
+		Expect(m.Provision(ctx)).Should(Succeed())
+		third := expectProvisioned(dir)
+		Expect(bundleSize(third.Data["ca.crt"])).Should(Equal(2))
+		Expect(string(third.Data["ca.crt"])).ShouldNot(ContainSubstring(string(first.Data["ca.crt"])))
+	})
+
+	It("regenerates invalid certificates", func() {
+		m := certManager(dir)
+		Expect(m.Provision(ctx)).Should(Succeed())
+		s := secret()
+		s.Data[corev1.TLSPrivateKeyKey] = []byte("garbage")
+		Expect(c.Update(ctx, s)).Should(Succeed())
+		Expect(m.rotationReason(s.Data)).Should(HavePrefix("invalid serving key"))
+
+		Expect(m.Provision(ctx)).Should(Succeed())
+		Expect(expectProvisioned(dir).Data[corev1.TLSPrivateKeyKey]).ShouldNot(Equal([]byte("garbage")))
+
+		By("Regenerating the certificate of a renamed service")
+		m.Service = "renamed"
+		Expect(m.rotationReason(secret().Data)).Should(ContainSubstring("renamed.oam-system.svc"))
+	})
+
+	It("requires the webhook service", func() {
+		m := certManager(dir)
+		m.Service = ""
+		Expect(m.Provision(ctx)).Should(MatchError(errNoWebhookService))
+	})
+})
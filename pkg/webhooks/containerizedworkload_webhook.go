@@ -0,0 +1,332 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// maxImageNameLength is the longest repository name an image reference may have.
+const maxImageNameLength = 255
+
+// imageReference matches an image reference, e.g. "registry:5000/team/app:v1"
+// or "app@sha256:<digest>", following the grammar of the docker distribution
+// reference package.
+var imageReference = func() *regexp.Regexp {
+	domainComponent := `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domain := domainComponent + `(?:\.` + domainComponent + `)*(?::[0-9]+)?`
+	nameComponent := `[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*`
+	name := `(?:` + domain + `/)?` + nameComponent + `(?:/` + nameComponent + `)*`
+	tag := `[\w][\w.-]{0,127}`
+	digest := `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[[:xdigit:]]{32,}`
+	return regexp.MustCompile(`^(` + name + `)(?::` + tag + `)?(?:@` + digest + `)?$`)
+}()
+
+// ContainerizedWorkloadValidator rejects the ContainerizedWorkloads whose
+// containers the Deployment they are translated to would be rejected for.
+type ContainerizedWorkloadValidator struct {
+	Log logr.Logger
+}
+
+// this is the default way, we will generate the path given gvk
+func (v ContainerizedWorkloadValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return v.validator().SetupWebhookWithManager(mgr)
+}
+
+func (v ContainerizedWorkloadValidator) validator() *Validator {
+	return &Validator{
+		Object: &v1alpha2.ContainerizedWorkload{},
+		Log:    v.Log,
+		OnCreate: func(_ context.Context, _, obj runtime.Object) field.ErrorList {
+			return validateContainerizedWorkload(obj.(*v1alpha2.ContainerizedWorkload))
+		},
+		// An update is only denied for the errors it introduces, so that a
+		// workload stored before the webhook was installed can still be
+		// updated.
+		OnUpdate: func(_ context.Context, oldObj, obj runtime.Object) field.ErrorList {
+			errs := validateContainerizedWorkload(obj.(*v1alpha2.ContainerizedWorkload))
+			old, ok := oldObj.(*v1alpha2.ContainerizedWorkload)
+			if !ok || len(errs) == 0 {
+				return errs
+			}
+			return introducedErrors(errs, validateContainerizedWorkload(old))
+		},
+	}
+}
+
+// ContainerizedWorkloadMutater fills the defaults of the containers of a
+// ContainerizedWorkload into the stored object, so that its spec describes the
+// Deployment it is translated to. The v1alpha2 containers have no image pull
+// policy, the API server defaults the one of the Deployment's containers.
+type ContainerizedWorkloadMutater struct {
+	Log logr.Logger
+	// CPU and Memory are requested by the containers of a new workload that
+	// do not say how much they require. Nothing is requested unless they are
+	// set, and the containers of existing workloads are left as they are, so
+	// changing them never changes the resources of a running application.
+	CPU    resource.Quantity
+	Memory resource.Quantity
+}
+
+// this is the default way, we will generate the path given gvk
+func (m ContainerizedWorkloadMutater) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return m.mutator().SetupWebhookWithManager(mgr)
+}
+
+func (m ContainerizedWorkloadMutater) mutator() *Mutator {
+	return &Mutator{
+		Object: &v1alpha2.ContainerizedWorkload{},
+		Log:    m.Log,
+		OnCreate: func(ctx context.Context, _, obj runtime.Object) error {
+			m.defaultResources(ctx, obj.(*v1alpha2.ContainerizedWorkload))
+			defaultPorts(ctx, nil, obj.(*v1alpha2.ContainerizedWorkload))
+			return nil
+		},
+		OnUpdate: func(ctx context.Context, oldObj, obj runtime.Object) error {
+			old, _ := oldObj.(*v1alpha2.ContainerizedWorkload)
+			defaultPorts(ctx, old, obj.(*v1alpha2.ContainerizedWorkload))
+			return nil
+		},
+	}
+}
+
+// defaultResources requests the configured resources for the containers that
+// do not say how much they require.
+func (m ContainerizedWorkloadMutater) defaultResources(ctx context.Context, cw *v1alpha2.ContainerizedWorkload) {
+	fldPath := field.NewPath("spec", "containers")
+	for i := range cw.Spec.Containers {
+		c := &cw.Spec.Containers[i]
+		idxPath := fldPath.Index(i)
+		if c.Resources == nil && (!m.CPU.IsZero() || !m.Memory.IsZero()) {
+			c.Resources = &v1alpha2.ContainerResources{}
+		}
+		if !m.CPU.IsZero() && c.Resources.CPU.Required.IsZero() {
+			c.Resources.CPU.Required = m.CPU.DeepCopy()
+			setDefault(ctx, idxPath.Child("resources", "cpu", "required"))
+		}
+		if !m.Memory.IsZero() && c.Resources.Memory.Required.IsZero() {
+			c.Resources.Memory.Required = m.Memory.DeepCopy()
+			setDefault(ctx, idxPath.Child("resources", "memory", "required"))
+		}
+	}
+}
+
+// A containerPort is a port of a named container.
+type containerPort struct {
+	container string
+	port      int32
+}
+
+// defaultPorts defaults the protocols of the ports to TCP and names the ports
+// without a name after their protocol. The ports the old workload already had
+// are not named, naming them would rename the ports of the Service of a
+// running application.
+func defaultPorts(ctx context.Context, old, cw *v1alpha2.ContainerizedWorkload) {
+	existing := make(map[containerPort]bool)
+	if old != nil {
+		for _, c := range old.Spec.Containers {
+			for _, p := range c.Ports {
+				existing[containerPort{container: c.Name, port: p.Port}] = true
+			}
+		}
+	}
+	// port names are shared by the containers of a pod
+	portNames := make(map[string]bool)
+	for _, c := range cw.Spec.Containers {
+		for _, p := range c.Ports {
+			if len(p.Name) != 0 {
+				portNames[p.Name] = true
+			}
+		}
+	}
+
+	fldPath := field.NewPath("spec", "containers")
+	for i := range cw.Spec.Containers {
+		c := &cw.Spec.Containers[i]
+		for j := range c.Ports {
+			p := &c.Ports[j]
+			portPath := fldPath.Index(i).Child("ports").Index(j)
+			if p.Protocol == nil {
+				tcp := v1alpha2.TransportProtocolTCP
+				p.Protocol = &tcp
+				setDefault(ctx, portPath.Child("protocol"))
+			}
+			if len(p.Name) == 0 && !existing[containerPort{container: c.Name, port: p.Port}] {
+				p.Name = defaultPortName(*p.Protocol, portNames)
+				portNames[p.Name] = true
+				setDefault(ctx, portPath.Child("name"))
+			}
+		}
+	}
+}
+
+// defaultPortName names a port after its protocol, suffixed by letters if the
+// name is taken because port names may only contain lower case letters.
+func defaultPortName(protocol v1alpha2.TransportProtocol, taken map[string]bool) string {
+	base := strings.ToLower(string(protocol))
+	name := base
+	for i := 1; taken[name]; i++ {
+		var suffix []byte
+		for n := i; n > 0; n = (n - 1) / 26 {
+			suffix = append([]byte{byte('a' + (n-1)%26)}, suffix...)
+		}
+		name = base + string(suffix)
+	}
+	return name
+}
+
+// A podPort is a port of a container, ports are shared by the containers of a pod.
+type podPort struct {
+	port     int32
+	protocol v1alpha2.TransportProtocol
+}
+
+func validateContainerizedWorkload(cw *v1alpha2.ContainerizedWorkload) field.ErrorList {
+	var errs field.ErrorList
+	fldPath := field.NewPath("spec", "containers")
+	if len(cw.Spec.Containers) == 0 {
+		return append(errs, field.Required(fldPath, "at least one container is required"))
+	}
+
+	containers := make(map[string]bool, len(cw.Spec.Containers))
+	ports := make(map[podPort]string)
+	portNames := make(map[string]string)
+	for i, c := range cw.Spec.Containers {
+		idxPath := fldPath.Index(i)
+		switch {
+		case len(c.Name) == 0:
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		case containers[c.Name]:
+			errs = append(errs, field.Duplicate(idxPath.Child("name"), c.Name))
+		default:
+			for _, msg := range validation.IsDNS1123Label(c.Name) {
+				errs = append(errs, field.Invalid(idxPath.Child("name"), c.Name, msg))
+			}
+		}
+		containers[c.Name] = true
+
+		errs = append(errs, validateImage(idxPath.Child("image"), c.Image)...)
+		errs = append(errs, validateEnv(idxPath.Child("env"), c.Environment)...)
+		for j, cf := range c.ConfigFiles {
+			if cf.FromSecret != nil {
+				errs = append(errs, validateSecretKeySelector(idxPath.Child("config").Index(j).Child("fromSecret"), cf.FromSecret)...)
+			}
+		}
+
+		for j, p := range c.Ports {
+			portPath := idxPath.Child("ports").Index(j)
+			for _, msg := range validation.IsValidPortNum(int(p.Port)) {
+				errs = append(errs, field.Invalid(portPath.Child("containerPort"), p.Port, msg))
+			}
+			protocol := v1alpha2.TransportProtocolTCP
+			if p.Protocol != nil {
+				protocol = *p.Protocol
+			}
+			if protocol != v1alpha2.TransportProtocolTCP && protocol != v1alpha2.TransportProtocolUDP {
+				errs = append(errs, field.NotSupported(portPath.Child("protocol"), protocol,
+					[]string{string(v1alpha2.TransportProtocolTCP), string(v1alpha2.TransportProtocolUDP)}))
+			}
+			pp := podPort{port: p.Port, protocol: protocol}
+			if owner, ok := ports[pp]; ok {
+				errs = append(errs, field.Invalid(portPath.Child("containerPort"), p.Port,
+					fmt.Sprintf("port %d/%s is already used by container %q", p.Port, protocol, owner)))
+			} else {
+				ports[pp] = c.Name
+			}
+
+			if len(p.Name) == 0 {
+				continue
+			}
+			for _, msg := range validation.IsValidPortName(p.Name) {
+				errs = append(errs, field.Invalid(portPath.Child("name"), p.Name, msg))
+			}
+			if owner, ok := portNames[p.Name]; ok {
+				errs = append(errs, field.Invalid(portPath.Child("name"), p.Name,
+					fmt.Sprintf("port name is already used by container %q", owner)))
+			} else {
+				portNames[p.Name] = c.Name
+			}
+		}
+	}
+	return errs
+}
+
+func validateImage(fldPath *field.Path, image string) field.ErrorList {
+	if len(image) == 0 {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	m := imageReference.FindStringSubmatch(image)
+	if m == nil {
+		return field.ErrorList{field.Invalid(fldPath, image,
+			"must be a valid image reference, e.g. 'registry.example.com/team/app:v1'; "+
+				"repository names are lower case")}
+	}
+	if len(m[1]) > maxImageNameLength {
+		return field.ErrorList{field.TooLong(fldPath, image, maxImageNameLength)}
+	}
+	return nil
+}
+
+func validateEnv(fldPath *field.Path, env []v1alpha2.ContainerEnvVar) field.ErrorList {
+	var errs field.ErrorList
+	for i, ev := range env {
+		idxPath := fldPath.Index(i)
+		if len(ev.Name) == 0 {
+			errs = append(errs, field.Required(idxPath.Child("name"), ""))
+		} else {
+			for _, msg := range validation.IsEnvVarName(ev.Name) {
+				errs = append(errs, field.Invalid(idxPath.Child("name"), ev.Name, msg))
+			}
+		}
+		if ev.Value != nil && ev.FromSecret != nil {
+			errs = append(errs, field.Forbidden(idxPath.Child("fromSecret"), "may not be set when value is set"))
+		}
+		if ev.FromSecret != nil {
+			errs = append(errs, validateSecretKeySelector(idxPath.Child("fromSecret"), ev.FromSecret)...)
+		}
+	}
+	return errs
+}
+
+func validateSecretKeySelector(fldPath *field.Path, s *v1alpha2.SecretKeySelector) field.ErrorList {
+	var errs field.ErrorList
+	if len(s.Name) == 0 {
+		errs = append(errs, field.Required(fldPath.Child("name"), "the secret to read from is required"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(s.Name) {
+			errs = append(errs, field.Invalid(fldPath.Child("name"), s.Name, msg))
+		}
+	}
+	if len(s.Key) == 0 {
+		errs = append(errs, field.Required(fldPath.Child("key"), "the key of the secret to read is required"))
+	} else {
+		for _, msg := range validation.IsConfigMapKey(s.Key) {
+			errs = append(errs, field.Invalid(fldPath.Child("key"), s.Key, msg))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,338 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	adminv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func containerizedWorkload(containers ...v1alpha2.Container) *v1alpha2.ContainerizedWorkload {
+	return &v1alpha2.ContainerizedWorkload{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "core.oam.dev/v1alpha2", Kind: "ContainerizedWorkload"},
+		ObjectMeta: metav1.ObjectMeta{Name: "wl", Namespace: "default"},
+		Spec:       v1alpha2.ContainerizedWorkloadSpec{Containers: containers},
+	}
+}
+
+func errorFields(errs field.ErrorList) []string {
+	fields := make([]string, 0, len(errs))
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+var _ = Describe("ContainerizedWorkload validating webhook", func() {
+	udp := v1alpha2.TransportProtocolUDP
+	sctp := v1alpha2.TransportProtocol("SCTP")
+	value := "v"
+
+	It("accepts a valid workload", func() {
+		cw := containerizedWorkload(
+			v1alpha2.Container{
+				Name:  "app",
+				Image: "registry.example.com:5000/team/app:v1.2",
+				Environment: []v1alpha2.ContainerEnvVar{
+					{Name: "MODE", Value: &value},
+					{Name: "PASSWORD", FromSecret: &v1alpha2.SecretKeySelector{Name: "db", Key: "password"}},
+				},
+				Ports: []v1alpha2.ContainerPort{{Name: "http", Port: 8080}, {Name: "dns", Port: 8080, Protocol: &udp}},
+			},
+			v1alpha2.Container{
+				Name:  "sidecar",
+				Image: "nginx@sha256:" + strings.Repeat("a", 64),
+				Ports: []v1alpha2.ContainerPort{{Port: 9090}},
+			},
+		)
+		Expect(validateContainerizedWorkload(cw)).Should(BeEmpty())
+	})
+
+	It("rejects invalid workloads with the path of each invalid field", func() {
+		testCases := map[string]struct {
+			cw     *v1alpha2.ContainerizedWorkload
+			fields []string
+		}{
+			"no containers": {
+				cw:     containerizedWorkload(),
+				fields: []string{"spec.containers"},
+			},
+			"duplicate container names": {
+				cw: containerizedWorkload(
+					v1alpha2.Container{Name: "app", Image: "app"},
+					v1alpha2.Container{Name: "app", Image: "app"},
+				),
+				fields: []string{"spec.containers[1].name"},
+			},
+			"invalid container name": {
+				cw:     containerizedWorkload(v1alpha2.Container{Name: "App_1", Image: "app"}),
+				fields: []string{"spec.containers[0].name"},
+			},
+			"port collisions across containers": {
+				cw: containerizedWorkload(
+					v1alpha2.Container{Name: "a", Image: "app", Ports: []v1alpha2.ContainerPort{{Name: "http", Port: 80}}},
+					v1alpha2.Container{Name: "b", Image: "app", Ports: []v1alpha2.ContainerPort{{Name: "http", Port: 80}}},
+				),
+				fields: []string{"spec.containers[1].ports[0].containerPort", "spec.containers[1].ports[0].name"},
+			},
+			"invalid ports": {
+				cw: containerizedWorkload(v1alpha2.Container{Name: "a", Image: "app", Ports: []v1alpha2.ContainerPort{
+					{Port: 0}, {Name: "not_a_port_name", Port: 81}, {Port: 82, Protocol: &sctp},
+				}}),
+				fields: []string{
+					"spec.containers[0].ports[0].containerPort",
+					"spec.containers[0].ports[1].name",
+					"spec.containers[0].ports[2].protocol",
+				},
+			},
+			"invalid image references": {
+				cw: containerizedWorkload(
+					v1alpha2.Container{Name: "a"},
+					v1alpha2.Container{Name: "b", Image: "Team/App:v1"},
+					v1alpha2.Container{Name: "c", Image: "app:bad tag"},
+					v1alpha2.Container{Name: "d", Image: "app@sha256:short"},
+				),
+				fields: []string{
+					"spec.containers[0].image",
+					"spec.containers[1].image",
+					"spec.containers[2].image",
+					"spec.containers[3].image",
+				},
+			},
+			"invalid env var names": {
+				cw: containerizedWorkload(v1alpha2.Container{Name: "a", Image: "app", Environment: []v1alpha2.ContainerEnvVar{
+					{Name: "", Value: &value}, {Name: "1BAD", Value: &value}, {Name: "HAS=EQUALS", Value: &value},
+				}}),
+				fields: []string{
+					"spec.containers[0].env[0].name",
+					"spec.containers[0].env[1].name",
+					"spec.containers[0].env[2].name",
+				},
+			},
+			"secret refs without keys": {
+				cw: containerizedWorkload(v1alpha2.Container{
+					Name:  "a",
+					Image: "app",
+					Environment: []v1alpha2.ContainerEnvVar{
+						{Name: "PASSWORD", FromSecret: &v1alpha2.SecretKeySelector{Name: "db"}},
+						{Name: "TOKEN", Value: &value, FromSecret: &v1alpha2.SecretKeySelector{Key: "token"}},
+					},
+					ConfigFiles: []v1alpha2.ContainerConfigFile{
+						{Path: "/etc/app.conf", FromSecret: &v1alpha2.SecretKeySelector{Name: "conf"}},
+					},
+				}),
+				fields: []string{
+					"spec.containers[0].env[0].fromSecret.key",
+					"spec.containers[0].env[1].fromSecret",
+					"spec.containers[0].env[1].fromSecret.name",
+					"spec.containers[0].config[0].fromSecret.key",
+				},
+			},
+		}
+		for name, testCase := range testCases {
+			logf.Log.Info("Start to run test", "test", name)
+			Expect(errorFields(validateContainerizedWorkload(testCase.cw))).Should(ConsistOf(testCase.fields), name)
+		}
+	})
+
+	It("denies invalid workloads at admission", func() {
+		v := ContainerizedWorkloadValidator{Log: logf.Log}.validator()
+		Expect(v.complete(oamScheme())).Should(Succeed())
+		Expect(v.gvr.Resource).Should(Equal("containerizedworkloads"))
+
+		raw, err := json.Marshal(containerizedWorkload(
+			v1alpha2.Container{Name: "app", Image: "app"},
+			v1alpha2.Container{Name: "app", Image: "app"},
+		))
+		Expect(err).Should(BeNil())
+		admit := func(op adminv1.Operation, oldRaw, newRaw []byte) *adminv1.AdmissionResponse {
+			return v.validate(context.Background(), adminv1.AdmissionReview{Request: &adminv1.AdmissionRequest{
+				Name:      "wl",
+				Resource:  v.gvr,
+				Operation: op,
+				Object:    runtime.RawExtension{Raw: newRaw},
+				OldObject: runtime.RawExtension{Raw: oldRaw},
+			}})
+		}
+		resp := admit(adminv1.Create, nil, raw)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+		Expect(resp.Result.Message).Should(ContainSubstring(`spec.containers[1].name: Duplicate value: "app"`))
+
+		By("Admitting the updates of a workload that was invalid before the webhook was installed")
+		Expect(admit(adminv1.Update, raw, raw).Allowed).Should(BeTrue())
+
+		By("Denying the errors an update introduces")
+		updated, err := json.Marshal(containerizedWorkload(
+			v1alpha2.Container{Name: "app", Image: "app"},
+			v1alpha2.Container{Name: "app", Image: "app"},
+			v1alpha2.Container{Name: "Sidecar", Image: "sidecar"},
+		))
+		Expect(err).Should(BeNil())
+		resp = admit(adminv1.Update, raw, updated)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(`spec.containers[2].name: Invalid value: "Sidecar"`))
+		Expect(resp.Result.Message).ShouldNot(ContainSubstring("Duplicate"))
+	})
+})
+
+var _ = Describe("ContainerizedWorkload mutating webhook", func() {
+	udp := v1alpha2.TransportProtocolUDP
+	tcp := v1alpha2.TransportProtocolTCP
+
+	It("fills the defaults of the ports", func() {
+		cw := containerizedWorkload(
+			v1alpha2.Container{
+				Name:  "app",
+				Image: "app",
+				Ports: []v1alpha2.ContainerPort{{Port: 8080}, {Port: 53, Protocol: &udp}, {Name: "tcp", Port: 9090}},
+			},
+			v1alpha2.Container{
+				Name:  "sidecar",
+				Image: "sidecar",
+				Ports: []v1alpha2.ContainerPort{{Port: 9091}},
+			},
+		)
+		defaultPorts(context.Background(), nil, cw)
+
+		Expect(cw.Spec.Containers[0].Ports).Should(Equal([]v1alpha2.ContainerPort{
+			{Name: "tcpa", Port: 8080, Protocol: &tcp},
+			{Name: "udp", Port: 53, Protocol: &udp},
+			{Name: "tcp", Port: 9090, Protocol: &tcp},
+		}))
+		Expect(cw.Spec.Containers[1].Ports).Should(Equal([]v1alpha2.ContainerPort{{Name: "tcpb", Port: 9091, Protocol: &tcp}}))
+		Expect(validateContainerizedWorkload(cw)).Should(BeEmpty())
+
+		By("Only naming the ports an update adds")
+		old := containerizedWorkload(v1alpha2.Container{
+			Name:  "app",
+			Image: "app",
+			Ports: []v1alpha2.ContainerPort{{Port: 8080}},
+		})
+		cw = containerizedWorkload(v1alpha2.Container{
+			Name:  "app",
+			Image: "app",
+			Ports: []v1alpha2.ContainerPort{{Port: 8080}, {Port: 9090}},
+		})
+		defaultPorts(context.Background(), old, cw)
+		Expect(cw.Spec.Containers[0].Ports).Should(Equal([]v1alpha2.ContainerPort{
+			{Port: 8080, Protocol: &tcp},
+			{Name: "tcp", Port: 9090, Protocol: &tcp},
+		}))
+	})
+
+	It("requests the configured resources for the containers that do not say", func() {
+		newWorkload := func() *v1alpha2.ContainerizedWorkload {
+			return containerizedWorkload(
+				v1alpha2.Container{Name: "app", Image: "app"},
+				v1alpha2.Container{
+					Name:  "sidecar",
+					Image: "sidecar",
+					Resources: &v1alpha2.ContainerResources{
+						CPU: v1alpha2.CPUResources{Required: resource.MustParse("1")},
+					},
+				},
+			)
+		}
+
+		cw := newWorkload()
+		ContainerizedWorkloadMutater{Log: logf.Log}.defaultResources(context.Background(), cw)
+		Expect(cw).Should(Equal(newWorkload()))
+
+		cw = newWorkload()
+		ContainerizedWorkloadMutater{Log: logf.Log, Memory: resource.MustParse("1Gi")}.defaultResources(context.Background(), cw)
+		app := cw.Spec.Containers[0]
+		Expect(app.Resources.CPU.Required.IsZero()).Should(BeTrue())
+		Expect(app.Resources.Memory.Required.String()).Should(Equal("1Gi"))
+		sidecar := cw.Spec.Containers[1]
+		Expect(sidecar.Resources.CPU.Required.String()).Should(Equal("1"))
+		Expect(sidecar.Resources.Memory.Required.String()).Should(Equal("1Gi"))
+
+		cw = newWorkload()
+		ContainerizedWorkloadMutater{Log: logf.Log, CPU: resource.MustParse("100m"), Memory: resource.MustParse("128Mi")}.
+			defaultResources(context.Background(), cw)
+		Expect(cw.Spec.Containers[0].Resources.CPU.Required.String()).Should(Equal("100m"))
+		Expect(cw.Spec.Containers[0].Resources.Memory.Required.String()).Should(Equal("128Mi"))
+		Expect(cw.Spec.Containers[1].Resources.CPU.Required.String()).Should(Equal("1"))
+	})
+
+	It("generates port names of lower case letters", func() {
+		taken := map[string]bool{"tcp": true}
+		Expect(defaultPortName(tcp, taken)).Should(Equal("tcpa"))
+		for c := 'a'; c < 'z'; c++ {
+			taken["tcp"+string(c)] = true
+		}
+		Expect(defaultPortName(tcp, taken)).Should(Equal("tcpz"))
+		taken["tcpz"] = true
+		Expect(defaultPortName(tcp, taken)).Should(Equal("tcpaa"))
+		Expect(defaultPortName(udp, taken)).Should(Equal("udp"))
+	})
+
+	It("lists the defaulted fields in the audit annotations", func() {
+		m := ContainerizedWorkloadMutater{Log: logf.Log, CPU: resource.MustParse("100m")}.mutator()
+		Expect(m.complete(oamScheme())).Should(Succeed())
+		raw, err := json.Marshal(containerizedWorkload(v1alpha2.Container{
+			Name:      "app",
+			Image:     "app",
+			Resources: &v1alpha2.ContainerResources{Memory: v1alpha2.MemoryResources{Required: resource.MustParse("1Gi")}},
+			Ports:     []v1alpha2.ContainerPort{{Name: "http", Port: 8080}},
+		}))
+		Expect(err).Should(BeNil())
+		resp := m.mutate(context.Background(), adminv1.AdmissionReview{Request: &adminv1.AdmissionRequest{
+			Name:      "wl",
+			Resource:  m.gvr,
+			Operation: adminv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.AuditAnnotations).Should(HaveKeyWithValue("defaulted",
+			"spec.containers[0].resources.cpu.required, spec.containers[0].ports[0].protocol"))
+		Expect(string(resp.Patch)).Should(ContainSubstring(`"path":"/spec/containers/0/ports/0/protocol","value":"TCP"`))
+
+		By("Leaving the resources of an updated workload alone")
+		raw, err = json.Marshal(containerizedWorkload(v1alpha2.Container{
+			Name:  "app",
+			Image: "app",
+			Ports: []v1alpha2.ContainerPort{{Name: "http", Port: 8080}},
+		}))
+		Expect(err).Should(BeNil())
+		resp = m.mutate(context.Background(), adminv1.AdmissionReview{Request: &adminv1.AdmissionRequest{
+			Name:      "wl",
+			Resource:  m.gvr,
+			Operation: adminv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+			OldObject: runtime.RawExtension{Raw: raw},
+		}})
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.AuditAnnotations).Should(HaveKeyWithValue("defaulted", "spec.containers[0].ports[0].protocol"))
+		Expect(string(resp.Patch)).ShouldNot(ContainSubstring("resources"))
+
+		By("Leaving a defaulted workload unpatched")
+		cw := containerizedWorkload()
+		Expect(json.Unmarshal(raw, cw)).Should(Succeed())
+		defaultPorts(context.Background(), nil, cw)
+		raw, err = json.Marshal(cw)
+		Expect(err).Should(BeNil())
+		resp = m.mutate(context.Background(), adminv1.AdmissionReview{Request: &adminv1.AdmissionRequest{
+			Name:      "wl",
+			Resource:  m.gvr,
+			Operation: adminv1.Update,
+			Object:    runtime.RawExtension{Raw: raw},
+			OldObject: runtime.RawExtension{Raw: raw},
+		}})
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Patch).Should(BeNil())
+		Expect(resp.AuditAnnotations).ShouldNot(HaveKey("defaulted"))
+	})
+})
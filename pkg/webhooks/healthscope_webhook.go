@@ -0,0 +1,51 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/scopes/healthscope"
+)
+
+// HealthScopeValidator rejects the HealthScopes whose annotations the
+// HealthScope controller cannot use.
+type HealthScopeValidator struct {
+	Log logr.Logger
+}
+
+// this is the default way, we will generate the path given gvk
+func (v HealthScopeValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return v.validator().SetupWebhookWithManager(mgr)
+}
+
+func (v HealthScopeValidator) validator() *Validator {
+	validate := func(_ context.Context, oldObj, obj runtime.Object) field.ErrorList {
+		return validateAnnotations(healthscope.ValidateAnnotations, oldObj, obj)
+	}
+	return &Validator{
+		Object:   &v1alpha2.HealthScope{},
+		Log:      v.Log,
+		OnCreate: validate,
+		OnUpdate: validate,
+	}
+}
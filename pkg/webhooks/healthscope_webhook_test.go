@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	adminv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/scopes/healthscope"
+)
+
+var _ = Describe("HealthScope validating webhook", func() {
+	ctx := context.Background()
+	scopeRaw := func(annotations map[string]string) []byte {
+		hs := v1alpha2.HealthScope{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "core.oam.dev/v1alpha2", Kind: "HealthScope"},
+			ObjectMeta: metav1.ObjectMeta{Name: "scope", Namespace: "default", Annotations: annotations},
+		}
+		raw, err := json.Marshal(hs)
+		Expect(err).Should(BeNil())
+		return raw
+	}
+	var v *Validator
+	admit := func(op adminv1.Operation, oldRaw, newRaw []byte) *adminv1.AdmissionResponse {
+		return v.validate(ctx, adminv1.AdmissionReview{Request: &adminv1.AdmissionRequest{
+			Name:      "scope",
+			Namespace: "default",
+			Resource:  v.gvr,
+			Operation: op,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		}})
+	}
+
+	BeforeEach(func() {
+		v = HealthScopeValidator{Log: logf.Log}.validator()
+		Expect(v.complete(oamScheme())).Should(Succeed())
+		Expect(v.gvr.Resource).Should(Equal("healthscopes"))
+	})
+
+	It("denies scopes with invalid annotations", func() {
+		Expect(admit(adminv1.Create, nil, scopeRaw(map[string]string{healthscope.AnnotationProbe: "http"}))).
+			Should(Equal(allowedResponse()))
+
+		resp := admit(adminv1.Create, nil, scopeRaw(map[string]string{healthscope.AnnotationProbe: "udp"}))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+		Expect(resp.Result.Message).Should(ContainSubstring(`metadata.annotations[` + healthscope.AnnotationProbe + `]`))
+	})
+
+	It("only denies updates for the invalid annotations they introduce", func() {
+		invalid := map[string]string{healthscope.AnnotationEventHeartbeat: "hourly"}
+		withHistory := map[string]string{
+			healthscope.AnnotationEventHeartbeat: "hourly",
+			healthscope.AnnotationHealthHistory:  "1590998400:H",
+		}
+		By("Admitting the controller's updates of a scope stored before the webhook was installed")
+		Expect(admit(adminv1.Update, scopeRaw(invalid), scopeRaw(withHistory)).Allowed).Should(BeTrue())
+
+		By("Denying a change to another invalid value")
+		changed := map[string]string{healthscope.AnnotationEventHeartbeat: "daily"}
+		Expect(admit(adminv1.Update, scopeRaw(invalid), scopeRaw(changed)).Allowed).Should(BeFalse())
+
+		By("Denying a new invalid annotation")
+		added := map[string]string{
+			healthscope.AnnotationEventHeartbeat:    "hourly",
+			healthscope.AnnotationAggregationPolicy: "most",
+		}
+		resp := admit(adminv1.Update, scopeRaw(invalid), scopeRaw(added))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(healthscope.AnnotationAggregationPolicy))
+		Expect(resp.Result.Message).ShouldNot(ContainSubstring(healthscope.AnnotationEventHeartbeat))
+	})
+})
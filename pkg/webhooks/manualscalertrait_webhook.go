@@ -16,147 +16,236 @@ limitations under the License.
 package webhooks
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/go-logr/logr"
-	adminv1 "k8s.io/api/admission/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/manualscalertrait"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
 )
 
+const errDiscoverKind = "cannot discover whether the workload kind is scalable"
+
 type ManualScalerTraitValidator struct {
 	Log logr.Logger
-	gvk schema.GroupVersionKind
-}
-
-func (v ManualScalerTraitValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	convertToHttpHandler(v.validate, v.Log)(w, r)
+	// Client reads the workloads traits refer to and their WorkloadDefinitions.
+	// The manager's client is used if it is not set.
+	Client client.Reader
+	// Discovery finds whether the API server serves and can scale the kind of
+	// the workloads. A memory cached discovery client is used if it is not set.
+	Discovery ScaleDiscovery
 }
 
 // this is the default way, we will generate the path given gvk
 func (v ManualScalerTraitValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	var err error
-	v.gvk, err = apiutil.GVKForObject(&v1alpha2.ManualScalerTrait{}, mgr.GetScheme())
-	if err != nil {
-		return err
+	if v.Client == nil {
+		v.Client = mgr.GetClient()
+	}
+	if v.Discovery == nil {
+		dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		v.Discovery = memory.NewMemCacheClient(dc)
 	}
-	vPath := validate_path_prefix + generatePath(v.gvk)
-	return RegisterWebhookWithManager(mgr, vPath, &v)
+	return v.validator().SetupWebhookWithManager(mgr)
 }
 
-func (v ManualScalerTraitValidator) validate(ar adminv1.AdmissionReview) *adminv1.AdmissionResponse {
-	log := v.Log.WithValues("name", ar.Request.Name, "Operation", ar.Request.Operation)
-	log.Info("Start to validate a trait")
-	expectedResource := metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha2", Resource: "manualscalertraits"}
+func (v ManualScalerTraitValidator) validator() *Validator {
+	var checker *scaleChecker
+	if v.Discovery != nil {
+		checker = newScaleChecker(v.Discovery)
+	}
+	return v.validatorWith(checker)
+}
+
+// validatorWith returns the validator, the workload is checked with the
+// supplied checker unless it is nil.
+func (v ManualScalerTraitValidator) validatorWith(checker *scaleChecker) *Validator {
+	validate := func(ctx context.Context, oldObj, obj runtime.Object) field.ErrorList {
+		msTrait := obj.(*v1alpha2.ManualScalerTrait)
+		errs := v.validate(msTrait)
+		errs = append(errs, validateAnnotations(manualscalertrait.ValidateAnnotations, oldObj, obj)...)
+		if len(errs) > 0 {
+			return errs
+		}
+		if v.Client == nil {
+			return nil
+		}
+		if errs := v.validateReplicaBounds(ctx, oldObj, msTrait); len(errs) > 0 {
+			return errs
+		}
+		if checker == nil {
+			return nil
+		}
+		return v.validateWorkload(ctx, checker, msTrait)
+	}
+	return &Validator{
+		Object:   &v1alpha2.ManualScalerTrait{},
+		Log:      v.Log,
+		OnCreate: validate,
+		OnUpdate: validate,
+	}
+}
+
+func (v ManualScalerTraitValidator) validate(msTrait *v1alpha2.ManualScalerTrait) field.ErrorList {
+	ref := msTrait.Spec.WorkloadReference
+	if len(ref.Name) == 0 || len(ref.APIVersion) == 0 || len(ref.Kind) == 0 {
+		v.Log.Info("workload reference not valid", "workloadRef", ref)
+		return field.ErrorList{field.Invalid(field.NewPath("spec", "workloadRef"), ref,
+			"workload reference not valid, apiVersion, kind and name are required")}
+	}
+	return nil
+}
+
+// validateReplicaBounds checks the replica count satisfies the replica bounds
+// policies that apply to the trait. An update is only checked if it changes the
+// replica count or the labels the policies select traits by, so that a trait a
+// policy created after it rejects can still be edited otherwise.
+func (v ManualScalerTraitValidator) validateReplicaBounds(ctx context.Context, oldObj runtime.Object,
+	msTrait *v1alpha2.ManualScalerTrait) field.ErrorList {
+	if old, ok := oldObj.(*v1alpha2.ManualScalerTrait); ok && old.Spec.ReplicaCount == msTrait.Spec.ReplicaCount &&
+		reflect.DeepEqual(old.GetLabels(), msTrait.GetLabels()) {
+		return nil
+	}
+	replicasPath := field.NewPath("spec", "replicaCount")
+	bounds, err := traitutil.FetchReplicaBounds(ctx, v.Client, msTrait)
+	if err != nil {
+		return field.ErrorList{field.InternalError(replicasPath, err)}
+	}
+	if err := bounds.Check(msTrait.Spec.ReplicaCount); err != nil {
+		return field.ErrorList{field.Invalid(replicasPath, msTrait.Spec.ReplicaCount, err.Error())}
+	}
+	return nil
+}
 
-	if ar.Request.Resource != expectedResource {
-		err := fmt.Errorf("wrong resource, expected %+v, got %+v ", expectedResource, ar.Request.Resource)
-		log.Error(err, "expect resource mismatch")
-		return toErrAdmissionResponse(err, http.StatusBadRequest)
+// validateWorkload checks the API server serves the kind of the workload the
+// trait refers to, and that the workload or the kinds of its child resources
+// can be scaled. A workload that does not exist yet is admitted, it is
+// usually created together with the trait; that is only recorded in the audit
+// annotations of the request, see warn.
+func (v ManualScalerTraitValidator) validateWorkload(ctx context.Context, checker *scaleChecker,
+	msTrait *v1alpha2.ManualScalerTrait) field.ErrorList {
+	refPath := field.NewPath("spec", "workloadRef")
+	ref := msTrait.Spec.WorkloadReference
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return field.ErrorList{field.Invalid(refPath.Child("apiVersion"), ref.APIVersion, err.Error())}
+	}
+	gvk := gv.WithKind(ref.Kind)
+	res, scale, err := checker.resource(gvk)
+	if err != nil {
+		return field.ErrorList{field.InternalError(refPath, errors.Wrap(err, errDiscoverKind))}
+	}
+	if res == nil {
+		return field.ErrorList{field.Invalid(refPath.Child("kind"), ref.Kind,
+			fmt.Sprintf("kind %s is not served by the API server in %s", ref.Kind, ref.APIVersion))}
 	}
 
-	raw := ar.Request.Object.Raw
-	msTrait := v1alpha2.ManualScalerTrait{}
-	deserializer := codecs.UniversalDeserializer()
-	if _, _, err := deserializer.Decode(raw, nil, &msTrait); err != nil {
-		log.Error(err, "failed to decode")
-		return toErrAdmissionResponse(err, http.StatusOK)
+	if !scale {
+		if scale, err = checker.hasReplicaField(gvk); err != nil {
+			return field.ErrorList{field.InternalError(refPath, errors.Wrap(err, errDiscoverKind))}
+		}
+	}
+	if !scale {
+		scalableChild, children, err := v.scalableChildKind(ctx, checker, res.Name+"."+gv.Group)
+		if err != nil {
+			return field.ErrorList{field.InternalError(refPath, errors.Wrap(err, errDiscoverKind))}
+		}
+		if !scalableChild {
+			msg := fmt.Sprintf("%s is not scalable, it has neither a scale subresource nor an integer spec.replicas field",
+				gvk.GroupKind())
+			if len(children) == 0 {
+				msg += " and its WorkloadDefinition declares no child resource kinds"
+			} else {
+				msg += " and neither do the child resource kinds of its WorkloadDefinition: " + strings.Join(children, ", ")
+			}
+			return field.ErrorList{field.Invalid(refPath.Child("kind"), ref.Kind, msg)}
+		}
 	}
 
-	if len(msTrait.Spec.WorkloadReference.Name) == 0 ||
-		len(msTrait.Spec.WorkloadReference.APIVersion) == 0 || len(msTrait.Spec.WorkloadReference.Kind) == 0 {
-		log.Info("workload reference not valid", "replicaCount", msTrait.Spec.WorkloadReference)
-		return toErrAdmissionResponse(fmt.Errorf("workload reference not valid, workload reference = %+v",
-			msTrait.Spec.WorkloadReference), http.StatusForbidden)
+	workload := &unstructured.Unstructured{}
+	workload.SetGroupVersionKind(gvk)
+	err = v.Client.Get(ctx, types.NamespacedName{Namespace: msTrait.GetNamespace(), Name: ref.Name}, workload)
+	switch {
+	case apierrors.IsNotFound(err):
+		warn(ctx, "%s %q does not exist yet, it is scaled once it is created", ref.Kind, ref.Name)
+	case err != nil:
+		warn(ctx, "cannot verify %s %q exists: %s", ref.Kind, ref.Name, err)
+	}
+	return nil
+}
 
+// scalableChildKind returns whether any of the child resource kinds declared
+// by the named WorkloadDefinition are scalable, and the kinds it declares.
+func (v ManualScalerTraitValidator) scalableChildKind(ctx context.Context, checker *scaleChecker,
+	definition string) (bool, []string, error) {
+	wd := &v1alpha2.WorkloadDefinition{}
+	if err := v.Client.Get(ctx, types.NamespacedName{Name: definition}, wd); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil, nil
+		}
+		return false, nil, err
 	}
-	return &adminv1.AdmissionResponse{
-		Allowed: true,
-		Result: &metav1.Status{
-			Status: metav1.StatusSuccess,
-		},
+	children := make([]string, 0, len(wd.Spec.ChildResourceKinds))
+	for _, child := range wd.Spec.ChildResourceKinds {
+		gvk := schema.FromAPIVersionAndKind(child.APIVersion, child.Kind)
+		children = append(children, gvk.GroupKind().String())
+		scalable, err := checker.scalable(gvk)
+		if err != nil {
+			return false, nil, err
+		}
+		if scalable {
+			return true, children, nil
+		}
 	}
+	return false, children, nil
 }
 
 type ManualScalerTraitMutater struct {
 	Log logr.Logger
-	gvk schema.GroupVersionKind
-}
-
-func (m ManualScalerTraitMutater) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	convertToHttpHandler(m.mutate, m.Log)(w, r)
 }
 
 // this is the default way, we will generate the path given gvk
 func (m ManualScalerTraitMutater) SetupWebhookWithManager(mgr ctrl.Manager) error {
-	var err error
-	m.gvk, err = apiutil.GVKForObject(&v1alpha2.ManualScalerTrait{}, mgr.GetScheme())
-	if err != nil {
-		return err
-	}
-	vPath := mutate_path_prefix + generatePath(m.gvk)
-	return RegisterWebhookWithManager(mgr, vPath, &m)
+	return m.mutator().SetupWebhookWithManager(mgr)
 }
 
-func (m ManualScalerTraitMutater) mutate(ar adminv1.AdmissionReview) *adminv1.AdmissionResponse {
-	log := m.Log.WithValues("name", ar.Request.Name)
-	log.Info("admitting manual scaler trait")
-	expectedResource := metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha2", Resource: "manualscalertraits"}
-
-	if ar.Request.Resource != expectedResource {
-		err := fmt.Errorf("wrong resource, expected %+v, got %+v ", expectedResource, ar.Request.Resource)
-		log.Error(err, "expect resource mismatch")
-		return toErrMutateResponse(err, http.StatusBadRequest)
+func (m ManualScalerTraitMutater) mutator() *Mutator {
+	mutate := func(_ context.Context, _, obj runtime.Object) error {
+		m.mutate(obj.(*v1alpha2.ManualScalerTrait))
+		return nil
 	}
-
-	raw := ar.Request.Object.Raw
-	msTrait := v1alpha2.ManualScalerTrait{}
-	deserializer := codecs.UniversalDeserializer()
-	if _, _, err := deserializer.Decode(raw, nil, &msTrait); err != nil {
-		log.Error(err, "failed to decode")
-		return toErrMutateResponse(err, http.StatusBadRequest)
+	return &Mutator{
+		Object:   &v1alpha2.ManualScalerTrait{},
+		Log:      m.Log,
+		OnCreate: mutate,
+		OnUpdate: mutate,
 	}
+}
 
+func (m ManualScalerTraitMutater) mutate(msTrait *v1alpha2.ManualScalerTrait) {
 	if len(msTrait.Spec.WorkloadReference.Kind) == 0 {
 		msTrait.Spec.WorkloadReference.Kind = "ContainerizedWorkload"
-		log.Info("Default the WorkloadReference kind to ContainerizedWorkload")
+		m.Log.Info("Default the WorkloadReference kind to ContainerizedWorkload")
 	}
 	if len(msTrait.Spec.WorkloadReference.APIVersion) == 0 {
 		msTrait.Spec.WorkloadReference.APIVersion = msTrait.APIVersion
-		log.Info("Default the WorkloadReference", "apiVersion", msTrait.APIVersion)
-	}
-
-	marshaledTrait, err := json.Marshal(msTrait)
-	if err != nil {
-		log.Error(err, "failed to marshal the mutated trait")
-		return toErrMutateResponse(err, http.StatusInternalServerError)
-	}
-	// generate the patch using a lib
-	patches, err := patchResponseFromRaw(ar.Request.Object.Raw, marshaledTrait)
-	if err != nil {
-		log.Error(err, "failed to generate the patch")
-		return toErrMutateResponse(err, http.StatusInternalServerError)
-	}
-	patchBytes, err := json.Marshal(patches)
-	if err != nil {
-		log.Error(err, "failed to marshal the patch")
-		return toErrMutateResponse(err, http.StatusInternalServerError)
-	}
-
-	return &adminv1.AdmissionResponse{
-		Allowed: true,
-		Patch:   patchBytes,
-		Result: &metav1.Status{
-			Status: metav1.StatusSuccess,
-		},
-		PatchType: &pT,
-		AuditAnnotations: map[string]string{
-			"mutator": generatePath(m.gvk),
-		},
+		m.Log.Info("Default the WorkloadReference", "apiVersion", msTrait.APIVersion)
 	}
 }
@@ -0,0 +1,290 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	adminv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"k8s.io/kubectl/pkg/util/openapi"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	extendv1alpha1 "github.com/crossplane/oam-controllers/apis/extend/v1alpha1"
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/manualscalertrait"
+)
+
+// fakeDiscovery serves the supplied resource lists like the memory cached
+// discovery does, the OpenAPI schemas are served by a fakeDocument instead.
+// The installed resource lists are only served once the cache is invalidated.
+type fakeDiscovery struct {
+	discovery.CachedDiscoveryInterface
+	resources map[string]*metav1.APIResourceList
+	installed map[string]*metav1.APIResourceList
+	err       error
+
+	invalidations int
+}
+
+func (d *fakeDiscovery) ServerResourcesForGroupVersion(gv string) (*metav1.APIResourceList, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if l, ok := d.resources[gv]; ok {
+		return l, nil
+	}
+	return nil, memory.ErrCacheNotFound
+}
+
+func (d *fakeDiscovery) Invalidate() {
+	d.invalidations++
+	for gv, l := range d.installed {
+		d.resources[gv] = l
+	}
+	d.installed = nil
+}
+
+type fakeDocument map[schema.GroupVersionKind]proto.Schema
+
+func (d fakeDocument) LookupResource(gvk schema.GroupVersionKind) proto.Schema {
+	return d[gvk]
+}
+
+func withReplicas() proto.Schema {
+	return &proto.Kind{Fields: map[string]proto.Schema{
+		"spec": &proto.Kind{Fields: map[string]proto.Schema{
+			"replicas": &proto.Primitive{Type: "integer"},
+		}},
+	}}
+}
+
+var _ = Describe("ManualScalerTrait validating webhook", func() {
+	ctx := context.Background()
+	maxReplicas := int32(10)
+	oam := "core.oam.dev/v1alpha2"
+	d := &fakeDiscovery{resources: map[string]*metav1.APIResourceList{
+		oam: {APIResources: []metav1.APIResource{
+			{Name: "containerizedworkloads", Kind: "ContainerizedWorkload"},
+			{Name: "containerizedworkloads/status", Kind: "ContainerizedWorkload"},
+			{Name: "pluginworkloads", Kind: "PluginWorkload"},
+			{Name: "configworkloads", Kind: "ConfigWorkload"},
+		}},
+		"apps/v1": {APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment"},
+			{Name: "deployments/scale", Kind: "Scale"},
+		}},
+		"v1": {APIResources: []metav1.APIResource{
+			{Name: "services", Kind: "Service"},
+		}},
+	}}
+	definitions := map[string][]v1alpha2.ChildResourceKind{
+		"containerizedworkloads.core.oam.dev": {{APIVersion: "apps/v1", Kind: "Deployment"}, {APIVersion: "v1", Kind: "Service"}},
+		"configworkloads.core.oam.dev":        {{APIVersion: "v1", Kind: "Service"}},
+	}
+	c := &test.MockClient{MockGet: func(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+		switch o := obj.(type) {
+		case *v1alpha2.WorkloadDefinition:
+			children, ok := definitions[key.Name]
+			if !ok {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			o.Spec.ChildResourceKinds = children
+			return nil
+		case *unstructured.Unstructured:
+			if key.Name == "wl" {
+				return nil
+			}
+		}
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}}
+	policies := []extendv1alpha1.ReplicaBoundsPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: "default"},
+		Spec:       extendv1alpha1.ReplicaBoundsPolicySpec{MaxReplicas: &maxReplicas},
+	}}
+	c.MockList = func(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+		list.(*extendv1alpha1.ReplicaBoundsPolicyList).Items = policies
+		return nil
+	}
+	fetches := 0
+
+	validator := func() *Validator {
+		checker := newScaleChecker(d)
+		checker.fetch = func() (openapi.Resources, error) {
+			fetches++
+			return fakeDocument{{Group: "core.oam.dev", Version: "v1alpha2", Kind: "PluginWorkload"}: withReplicas()}, nil
+		}
+		v := ManualScalerTraitValidator{Log: logf.Log, Client: c, Discovery: d}.validatorWith(checker)
+		Expect(v.complete(oamScheme())).Should(Succeed())
+		return v
+	}
+
+	admit := func(v *Validator, ref v1alpha1.TypedReference) *adminv1.AdmissionResponse {
+		return v.validate(ctx, review(adminv1.Create, nil, traitRaw(3, ref)))
+	}
+
+	BeforeEach(func() {
+		d.err = nil
+		fetches = 0
+	})
+
+	It("admits traits aimed at workloads that can be scaled", func() {
+		v := validator()
+		for _, ref := range []v1alpha1.TypedReference{
+			{APIVersion: oam, Kind: "ContainerizedWorkload", Name: "wl"},
+			{APIVersion: oam, Kind: "PluginWorkload", Name: "wl"},
+			{APIVersion: "apps/v1", Kind: "Deployment", Name: "wl"},
+		} {
+			resp := admit(v, ref)
+			Expect(resp.Allowed).Should(BeTrue(), ref.Kind)
+			Expect(resp.AuditAnnotations).Should(BeEmpty(), ref.Kind)
+		}
+		By("Caching the OpenAPI document")
+		Expect(fetches).Should(Equal(1))
+	})
+
+	It("warns about workloads that do not exist yet", func() {
+		resp := admit(validator(), v1alpha1.TypedReference{APIVersion: oam, Kind: "ContainerizedWorkload", Name: "new"})
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.AuditAnnotations).Should(HaveKeyWithValue("warnings",
+			`ContainerizedWorkload "new" does not exist yet, it is scaled once it is created`))
+	})
+
+	It("rejects traits aimed at unknown or unscalable kinds", func() {
+		v := validator()
+		resp := admit(v, v1alpha1.TypedReference{APIVersion: oam, Kind: "UnknownWorkload", Name: "wl"})
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(
+			"spec.workloadRef.kind: Invalid value: \"UnknownWorkload\": kind UnknownWorkload is not served by the API server in core.oam.dev/v1alpha2"))
+
+		resp = admit(v, v1alpha1.TypedReference{APIVersion: oam, Kind: "ConfigWorkload", Name: "wl"})
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("ConfigWorkload.core.oam.dev is not scalable, it has neither a " +
+			"scale subresource nor an integer spec.replicas field and neither do the child resource kinds of its " +
+			"WorkloadDefinition: Service"))
+
+		resp = admit(v, v1alpha1.TypedReference{APIVersion: "v1", Kind: "Service", Name: "wl"})
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("its WorkloadDefinition declares no child resource kinds"))
+
+		d.err = errors.New("boom")
+		resp = admit(v, v1alpha1.TypedReference{APIVersion: oam, Kind: "ContainerizedWorkload", Name: "wl"})
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(errDiscoverKind))
+	})
+
+	It("discovers the kinds installed since the discovery was cached", func() {
+		d.installed = map[string]*metav1.APIResourceList{
+			"example.com/v1": {APIResources: []metav1.APIResource{
+				{Name: "games", Kind: "Game"},
+				{Name: "games/scale", Kind: "Scale"},
+			}},
+		}
+		v := validator()
+		resp := admit(v, v1alpha1.TypedReference{APIVersion: "example.com/v1", Kind: "Game", Name: "wl"})
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(d.resources).Should(HaveKey("example.com/v1"))
+		delete(d.resources, "example.com/v1")
+
+		By("Reporting the group versions that are still not served precisely")
+		resp = admit(v, v1alpha1.TypedReference{APIVersion: "unknown.example.com/v1", Kind: "Game", Name: "wl"})
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(
+			"kind Game is not served by the API server in unknown.example.com/v1"))
+	})
+
+	It("enforces the replica bounds policies", func() {
+		v := validator()
+		ref := v1alpha1.TypedReference{APIVersion: oam, Kind: "ContainerizedWorkload", Name: "wl"}
+		resp := v.validate(ctx, review(adminv1.Create, nil, traitRaw(500, ref)))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("spec.replicaCount: Invalid value: 500: " +
+			"500 replicas is above the maximum of 10 allowed by replica bounds policy limits"))
+
+		resp = v.validate(ctx, review(adminv1.Create, nil, traitRaw(10, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("Only checking the updates that change the replica count")
+		resp = v.validate(ctx, review(adminv1.Update, traitRaw(500, ref), traitRaw(500, ref)))
+		Expect(resp.Allowed).Should(BeTrue())
+		resp = v.validate(ctx, review(adminv1.Update, traitRaw(5, ref), traitRaw(500, ref)))
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("rejects invalid target selector annotations", func() {
+		ref := v1alpha1.TypedReference{APIVersion: oam, Kind: "ContainerizedWorkload", Name: "wl"}
+		withAnnotations := func(annotations map[string]string) []byte {
+			t := &v1alpha2.ManualScalerTrait{}
+			Expect(json.Unmarshal(traitRaw(3, ref), t)).Should(Succeed())
+			t.SetAnnotations(annotations)
+			raw, err := json.Marshal(t)
+			Expect(err).Should(BeNil())
+			return raw
+		}
+		v := ManualScalerTraitValidator{Log: logf.Log}.validatorWith(nil)
+		Expect(v.complete(oamScheme())).Should(Succeed())
+
+		valid := map[string]string{manualscalertrait.AnnotationTargetSelector: "tier=api"}
+		invalid := map[string]string{manualscalertrait.AnnotationTargetSelector: "tier in api"}
+		Expect(v.validate(ctx, review(adminv1.Create, nil, withAnnotations(valid))).Allowed).Should(BeTrue())
+		resp := v.validate(ctx, review(adminv1.Create, nil, withAnnotations(invalid)))
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(
+			"metadata.annotations[" + manualscalertrait.AnnotationTargetSelector + "]"))
+
+		By("Admitting the updates of a trait that was invalid before the webhook was installed")
+		resp = v.validate(ctx, review(adminv1.Update, withAnnotations(invalid), withAnnotations(invalid)))
+		Expect(resp.Allowed).Should(BeTrue())
+	})
+
+	It("rediscovers the served kinds at most once per OpenAPI document TTL", func() {
+		checker := newScaleChecker(d)
+		now := time.Now()
+		checker.now = func() time.Time { return now }
+		d.invalidations = 0
+		unknown := schema.GroupVersionKind{Group: "unknown.example.com", Version: "v1", Kind: "Game"}
+		for i := 0; i < 3; i++ {
+			res, _, err := checker.resource(unknown)
+			Expect(err).Should(BeNil())
+			Expect(res).Should(BeNil())
+		}
+		Expect(d.invalidations).Should(Equal(1))
+		now = now.Add(openAPITTL)
+		_, _, err := checker.resource(unknown)
+		Expect(err).Should(BeNil())
+		Expect(d.invalidations).Should(Equal(2))
+	})
+
+	It("refreshes the OpenAPI document once it is stale", func() {
+		checker := newScaleChecker(d)
+		now := time.Now()
+		checker.now = func() time.Time { return now }
+		checker.fetch = func() (openapi.Resources, error) {
+			fetches++
+			return fakeDocument{}, nil
+		}
+		_, err := checker.openAPIDocument()
+		Expect(err).Should(BeNil())
+		_, err = checker.openAPIDocument()
+		Expect(err).Should(BeNil())
+		Expect(fetches).Should(Equal(1))
+		now = now.Add(openAPITTL)
+		_, err = checker.openAPIDocument()
+		Expect(err).Should(BeNil())
+		Expect(fetches).Should(Equal(2))
+	})
+})
@@ -0,0 +1,175 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/kubectl/pkg/util/openapi"
+
+	"github.com/crossplane/oam-controllers/pkg/controller/core/traits/traitutil"
+)
+
+// openAPITTL is how long a fetched OpenAPI document is used before it is
+// fetched again, so that the schemas of newly installed CRDs are seen.
+const openAPITTL = 10 * time.Minute
+
+// ScaleDiscovery discovers the resources the API server serves, including
+// their scale subresources, and their OpenAPI schemas. A discovery client is
+// one, wrapping it in a memory cache saves a round trip per admission request.
+type ScaleDiscovery interface {
+	ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error)
+	discovery.OpenAPISchemaInterface
+}
+
+// A scaleChecker finds out whether the API server can scale a kind, either
+// through its scale subresource or an integer spec.replicas field, the field
+// the scaler traits set.
+type scaleChecker struct {
+	discovery ScaleDiscovery
+
+	lock        sync.Mutex
+	fetch       func() (openapi.Resources, error)
+	document    openapi.Resources
+	fetched     time.Time
+	invalidated time.Time
+	now         func() time.Time
+}
+
+func newScaleChecker(d ScaleDiscovery) *scaleChecker {
+	return &scaleChecker{
+		discovery: d,
+		fetch:     func() (openapi.Resources, error) { return traitutil.FetchOpenAPIDocument(d) },
+		now:       time.Now,
+	}
+}
+
+// resource returns the resource the API server serves the supplied kind as,
+// or nil if it does not serve the kind, and whether it has a scale subresource.
+func (c *scaleChecker) resource(gvk schema.GroupVersionKind) (*metav1.APIResource, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		list, err := c.discovery.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+		if err != nil && !groupVersionNotServed(err) {
+			return nil, false, err
+		}
+		if res, scale := findResource(list, gvk.Kind); res != nil {
+			return res, scale, nil
+		}
+		// the kind may have been installed since the cached discovery was populated
+		if !c.invalidate() {
+			break
+		}
+	}
+	return nil, false, nil
+}
+
+// invalidate invalidates the cached discovery at most once per openAPITTL, so
+// that a stream of requests for a kind that is not served does not turn into
+// a full rediscovery each. It returns false if the discovery was not
+// invalidated.
+func (c *scaleChecker) invalidate() bool {
+	cached, ok := c.discovery.(discovery.CachedDiscoveryInterface)
+	if !ok {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.invalidated.IsZero() && c.now().Sub(c.invalidated) < openAPITTL {
+		return false
+	}
+	cached.Invalidate()
+	c.invalidated = c.now()
+	return true
+}
+
+// groupVersionNotServed returns true if the error says the group version is
+// not served. The memory cached discovery returns a plain ErrCacheNotFound for
+// the group versions it has not seen instead of a NotFound API error.
+func groupVersionNotServed(err error) bool {
+	return apierrors.IsNotFound(err) || err == memory.ErrCacheNotFound
+}
+
+func findResource(list *metav1.APIResourceList, kind string) (*metav1.APIResource, bool) {
+	if list == nil {
+		return nil, false
+	}
+	var found *metav1.APIResource
+	for i := range list.APIResources {
+		if r := list.APIResources[i]; r.Kind == kind && !isSubresource(r.Name) {
+			found = &list.APIResources[i]
+			break
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	for _, r := range list.APIResources {
+		if r.Name == found.Name+"/scale" {
+			return found, true
+		}
+	}
+	return found, false
+}
+
+func isSubresource(name string) bool {
+	return strings.Contains(name, "/")
+}
+
+// hasReplicaField returns true if the OpenAPI schema of the kind has an
+// integer spec.replicas field.
+func (c *scaleChecker) hasReplicaField(gvk schema.GroupVersionKind) (bool, error) {
+	document, err := c.openAPIDocument()
+	if err != nil {
+		return false, err
+	}
+	res := &unstructured.Unstructured{}
+	res.SetGroupVersionKind(gvk)
+	return traitutil.LocateReplicaField(document, res), nil
+}
+
+func (c *scaleChecker) openAPIDocument() (openapi.Resources, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.document != nil && c.now().Sub(c.fetched) < openAPITTL {
+		return c.document, nil
+	}
+	document, err := c.fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.document, c.fetched = document, c.now()
+	return document, nil
+}
+
+// scalable returns true if the API server serves the kind and can scale it.
+func (c *scaleChecker) scalable(gvk schema.GroupVersionKind) (bool, error) {
+	res, scale, err := c.resource(gvk)
+	if err != nil || res == nil {
+		return false, err
+	}
+	if scale {
+		return true, nil
+	}
+	return c.hasReplicaField(gvk)
+}
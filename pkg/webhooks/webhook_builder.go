@@ -1,17 +1,18 @@
 package webhooks
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"reflect"
 	"strings"
 
 	"github.com/go-logr/logr"
 	"gomodules.xyz/jsonpatch/v2"
 	adminv1 "k8s.io/api/admission/v1"
+	adminv1beta1 "k8s.io/api/admission/v1beta1"
 	admregv1 "k8s.io/api/admissionregistration/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,13 +32,16 @@ var (
 	pT     = adminv1.PatchTypeJSONPatch //only thing they supported and golang can't reference a const
 )
 
+const admissionReviewKind = "AdmissionReview"
+
 func init() {
 	utilruntime.Must(adminv1.AddToScheme(scheme))
+	utilruntime.Must(adminv1beta1.AddToScheme(scheme))
 	utilruntime.Must(admregv1.AddToScheme(scheme))
 }
 
 // admitFunc is the internal type of function we use for all of our validators and mutators
-type admitFunc func(adminv1.AdmissionReview) *adminv1.AdmissionResponse
+type admitFunc func(context.Context, adminv1.AdmissionReview) *adminv1.AdmissionResponse
 
 // httpHandler is the type of function http server takes
 type httpHandler func(http.ResponseWriter, *http.Request)
@@ -52,7 +56,9 @@ func RegisterWebhookWithManager(mgr ctrl.Manager, path string, hook http.Handler
 }
 
 // convertToHttpHandler automatically creates httpHandler functions that
-//handle the http portion of a request prior to handing to an admitFunction that we implement
+//handle the http portion of a request prior to handing to an admitFunction that we implement.
+// Both admission.k8s.io/v1 and v1beta1 AdmissionReviews are admitted, the response is sent in
+// the version of the request.
 func convertToHttpHandler(admit admitFunc, logger logr.Logger) httpHandler {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var body []byte
@@ -70,42 +76,117 @@ func convertToHttpHandler(admit admitFunc, logger logr.Logger) httpHandler {
 
 		logger.Info("handling request", "body length", r.ContentLength)
 
-		// The AdmissionReview that was sent to the webhook
-		requestedAdmissionReview := adminv1.AdmissionReview{}
-
-		// The AdmissionReview that will be returned
-		responseAdmissionReview := adminv1.AdmissionReview{
-			TypeMeta: metav1.TypeMeta{
-				APIVersion: adminv1.SchemeGroupVersion.String(),
-				Kind:       reflect.TypeOf(adminv1.AdmissionReview{}).Name(),
-			},
-		}
-
-		deserializer := codecs.UniversalDeserializer()
-		if _, _, err := deserializer.Decode(body, nil, &requestedAdmissionReview); err != nil {
+		// The AdmissionReview that was sent to the webhook, in v1
+		requestedAdmissionReview, version, err := decodeAdmissionReview(body)
+		var response *adminv1.AdmissionResponse
+		if err != nil {
 			logger.Error(err, "Failed to deserialize the body", "body", body)
-			responseAdmissionReview.Response = toErrAdmissionResponse(err, http.StatusBadRequest)
+			response = toErrAdmissionResponse(err, http.StatusBadRequest)
 		} else {
 			// pass to admitFunc
-			responseAdmissionReview.Response = admit(requestedAdmissionReview)
+			response = admit(r.Context(), requestedAdmissionReview)
 		}
 
 		// Return the same UID
-		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
+		if requestedAdmissionReview.Request != nil {
+			response.UID = requestedAdmissionReview.Request.UID
+		}
 
 		logger.Info("sending response",
-			"allowed", responseAdmissionReview.Response.Allowed,
-			"http code", responseAdmissionReview.Response.Result.Code,
-			"status", responseAdmissionReview.Response.Result.Status,
-			"message", responseAdmissionReview.Response.Result.Message)
+			"version", version,
+			"allowed", response.Allowed,
+			"http code", response.Result.Code,
+			"status", response.Result.Status,
+			"message", response.Result.Message)
 
+		// The AdmissionReview that will be returned
 		encoder := json.NewEncoder(w)
-		if err := encoder.Encode(responseAdmissionReview); err != nil {
+		if err := encoder.Encode(encodeAdmissionReview(response, version)); err != nil {
 			logger.Error(err, "Failed to write the response")
 		}
 	}
 }
 
+// decodeAdmissionReview decodes an admission.k8s.io/v1 or v1beta1 AdmissionReview
+// into a v1 one, it also returns the version the review was sent in. A review that
+// does not say its version is a v1 one, as is a review that cannot be decoded.
+func decodeAdmissionReview(body []byte) (adminv1.AdmissionReview, schema.GroupVersion, error) {
+	v1 := adminv1.SchemeGroupVersion.WithKind(admissionReviewKind)
+	obj, gvk, err := codecs.UniversalDeserializer().Decode(body, &v1, nil)
+	if err != nil {
+		if gvk != nil && *gvk == adminv1beta1.SchemeGroupVersion.WithKind(admissionReviewKind) {
+			return adminv1.AdmissionReview{}, adminv1beta1.SchemeGroupVersion, err
+		}
+		return adminv1.AdmissionReview{}, adminv1.SchemeGroupVersion, err
+	}
+	switch ar := obj.(type) {
+	case *adminv1.AdmissionReview:
+		return *ar, adminv1.SchemeGroupVersion, nil
+	case *adminv1beta1.AdmissionReview:
+		return adminv1.AdmissionReview{Request: toV1AdmissionRequest(ar.Request)}, adminv1beta1.SchemeGroupVersion, nil
+	}
+	return adminv1.AdmissionReview{}, adminv1.SchemeGroupVersion, fmt.Errorf("unsupported admission review %s", gvk)
+}
+
+// encodeAdmissionReview wraps the response in an AdmissionReview of the supplied version.
+func encodeAdmissionReview(response *adminv1.AdmissionResponse, version schema.GroupVersion) runtime.Object {
+	if version == adminv1beta1.SchemeGroupVersion {
+		return &adminv1beta1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: adminv1beta1.SchemeGroupVersion.String(),
+				Kind:       admissionReviewKind,
+			},
+			Response: toV1beta1AdmissionResponse(response),
+		}
+	}
+	return &adminv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: adminv1.SchemeGroupVersion.String(),
+			Kind:       admissionReviewKind,
+		},
+		Response: response,
+	}
+}
+
+// the v1 admission types are identical to the v1beta1 ones
+func toV1AdmissionRequest(req *adminv1beta1.AdmissionRequest) *adminv1.AdmissionRequest {
+	if req == nil {
+		return nil
+	}
+	return &adminv1.AdmissionRequest{
+		UID:                req.UID,
+		Kind:               req.Kind,
+		Resource:           req.Resource,
+		SubResource:        req.SubResource,
+		RequestKind:        req.RequestKind,
+		RequestResource:    req.RequestResource,
+		RequestSubResource: req.RequestSubResource,
+		Name:               req.Name,
+		Namespace:          req.Namespace,
+		Operation:          adminv1.Operation(req.Operation),
+		UserInfo:           req.UserInfo,
+		Object:             req.Object,
+		OldObject:          req.OldObject,
+		DryRun:             req.DryRun,
+		Options:            req.Options,
+	}
+}
+
+func toV1beta1AdmissionResponse(resp *adminv1.AdmissionResponse) *adminv1beta1.AdmissionResponse {
+	r := &adminv1beta1.AdmissionResponse{
+		UID:              resp.UID,
+		Allowed:          resp.Allowed,
+		Result:           resp.Result,
+		Patch:            resp.Patch,
+		AuditAnnotations: resp.AuditAnnotations,
+	}
+	if resp.PatchType != nil {
+		pt := adminv1beta1.PatchType(*resp.PatchType)
+		r.PatchType = &pt
+	}
+	return r
+}
+
 // generate a unique path for each gvk
 func generatePath(gvk schema.GroupVersionKind) string {
 	return strings.Replace(gvk.Group, ".", "-", -1) + "-" +
@@ -1,10 +1,20 @@
 package webhooks
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	adminv1 "k8s.io/api/admission/v1"
+	adminv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -49,4 +59,65 @@ var _ = Describe("Webhook builder unit test", func() {
 			Expect(generatePath(testCase.gvk)).Should(BeIdenticalTo(testCase.result))
 		}
 	})
+
+	It("replies in the version of the admission review", func() {
+		var admitted adminv1.AdmissionReview
+		handler := convertToHttpHandler(func(_ context.Context, ar adminv1.AdmissionReview) *adminv1.AdmissionResponse {
+			admitted = ar
+			resp := allowedResponse()
+			resp.Patch = []byte(`[]`)
+			resp.PatchType = &pT
+			resp.AuditAnnotations = map[string]string{"mutator": "test"}
+			return resp
+		}, logf.Log)
+		serve := func(body string) map[string]interface{} {
+			r := httptest.NewRequest(http.MethodPost, "/mutate", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler(w, r)
+			reply := map[string]interface{}{}
+			Expect(json.Unmarshal(w.Body.Bytes(), &reply)).Should(Succeed())
+			return reply
+		}
+		request := func(version schema.GroupVersion) string {
+			b, err := json.Marshal(map[string]interface{}{
+				"apiVersion": version.String(),
+				"kind":       "AdmissionReview",
+				"request": adminv1beta1.AdmissionRequest{
+					UID:       types.UID("uid"),
+					Name:      "scaler",
+					Resource:  traitResource,
+					Operation: adminv1beta1.Update,
+				},
+			})
+			Expect(err).Should(BeNil())
+			return string(b)
+		}
+		response := map[string]interface{}{
+			"uid":              "uid",
+			"allowed":          true,
+			"status":           map[string]interface{}{"metadata": map[string]interface{}{}, "status": metav1.StatusSuccess},
+			"patch":            "W10=",
+			"patchType":        string(pT),
+			"auditAnnotations": map[string]interface{}{"mutator": "test"},
+		}
+
+		for _, version := range []schema.GroupVersion{adminv1.SchemeGroupVersion, adminv1beta1.SchemeGroupVersion} {
+			reply := serve(request(version))
+			Expect(reply).Should(HaveKeyWithValue("apiVersion", version.String()))
+			Expect(reply).Should(HaveKeyWithValue("kind", "AdmissionReview"))
+			Expect(reply).Should(HaveKeyWithValue("response", response), version.String())
+			Expect(admitted.Request.Name).Should(Equal("scaler"))
+			Expect(admitted.Request.Operation).Should(Equal(adminv1.Update))
+			Expect(admitted.Request.Resource).Should(Equal(traitResource))
+		}
+
+		By("Denying reviews that cannot be decoded")
+		reply := serve(`{"apiVersion":"admission.k8s.io/v1beta1","kind":"AdmissionReview","request":"bad"}`)
+		Expect(reply).Should(HaveKeyWithValue("apiVersion", "admission.k8s.io/v1beta1"))
+		Expect(reply["response"]).Should(HaveKeyWithValue("allowed", false))
+		reply = serve(`{"apiVersion":"admission.k8s.io/v2","kind":"AdmissionReview"}`)
+		Expect(reply).Should(HaveKeyWithValue("apiVersion", "admission.k8s.io/v1"))
+		Expect(reply["response"]).Should(HaveKeyWithValue("allowed", false))
+	})
 })